@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/resolver"
+)
+
+var corePerl string
+
+func newCoreCmd() *cobra.Command {
+	coreCmd := &cobra.Command{
+		Use:   "core",
+		Short: "List the modules treated as core (and never resolved) for a perl version",
+		RunE:  runCore,
+	}
+
+	coreCmd.Flags().StringVar(&corePerl, "perl", "", "Perl version, e.g. 5.36 (default: every module yacm treats as core)")
+
+	return coreCmd
+}
+
+func runCore(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	for _, module := range resolver.CoreModules(corePerl) {
+		if _, err := fmt.Fprintln(out, module); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunCore(t *testing.T) {
+	tests := []struct {
+		perl   string
+		module string
+		want   bool
+	}{
+		{perl: "5.36", module: "Sub::Util", want: true},
+		{perl: "5.20", module: "Sub::Util", want: false},
+		{perl: "5.20", module: "strict", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.perl+"_"+tt.module, func(t *testing.T) {
+			// Arrange
+			cmd := newCoreCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetArgs([]string{"--perl", tt.perl})
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			got := false
+			for _, line := range lines {
+				if line == tt.module {
+					got = true
+				}
+			}
+			if got != tt.want {
+				t.Errorf("%s listed for perl %s = %v, want %v", tt.module, tt.perl, got, tt.want)
+			}
+		})
+	}
+}
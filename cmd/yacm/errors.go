@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/resolver"
+)
+
+// errorJSON is the machine-readable failure report written with --json-errors.
+type errorJSON struct {
+	Kind   string `json:"kind"`
+	Module string `json:"module,omitempty"`
+	Detail string `json:"detail"`
+}
+
+func newErrorJSON(err error) errorJSON {
+	var resErr *resolver.Error
+	if errors.As(err, &resErr) {
+		return errorJSON{Kind: resErr.Kind, Module: resErr.Module, Detail: resErr.Err.Error()}
+	}
+	var statusErr *downloader.StatusError
+	if errors.As(err, &statusErr) {
+		return errorJSON{Kind: resolver.KindDownload, Detail: statusErr.Error()}
+	}
+	return errorJSON{Kind: "error", Detail: err.Error()}
+}
+
+// writeJSONError writes err as a single-line JSON object.
+func writeJSONError(w io.Writer, err error) error {
+	return json.NewEncoder(w).Encode(newErrorJSON(err))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/resolver"
+)
+
+func TestWriteJSONError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "unresolved module",
+			err: fmt.Errorf("resolving dependencies: %w", &resolver.Error{
+				Kind:   resolver.KindUnresolved,
+				Module: "No::Such::Module",
+				Err:    errors.New("module No::Such::Module version 0 not found"),
+			}),
+			want: `{"kind":"unresolved","module":"No::Such::Module","detail":"module No::Such::Module version 0 not found"}`,
+		},
+		{
+			name: "download failure",
+			err: &resolver.Error{
+				Kind:   resolver.KindDownload,
+				Module: "JSON",
+				Err:    &downloader.StatusError{URL: "https://cpan.example.org/JSON-2.0.tar.gz", StatusCode: 500},
+			},
+			want: `{"kind":"download","module":"JSON","detail":"downloading https://cpan.example.org/JSON-2.0.tar.gz: HTTP 500"}`,
+		},
+		{
+			name: "other error",
+			err:  errors.New("no requirements found in cpanfile"),
+			want: `{"kind":"error","detail":"no requirements found in cpanfile"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeJSONError(&buf, tt.err); err != nil {
+				t.Fatalf("writeJSONError() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want+"\n" {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
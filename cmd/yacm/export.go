@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/cpanfile"
+	"github.com/frederic-klein/yacm/internal/snapshot"
+)
+
+var exportOutput string
+
+func newExportCpanfileCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export-cpanfile",
+		Short: "Generate a cpanfile pinning the top-level modules of a snapshot",
+		RunE:  runExportCpanfile,
+	}
+
+	exportCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Input snapshot path")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "-", "Output cpanfile path (- for stdout)")
+
+	return exportCmd
+}
+
+func runExportCpanfile(cmd *cobra.Command, args []string) error {
+	dists, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	reqs := snapshot.TopLevel(dists)
+
+	if exportOutput == "-" {
+		return cpanfile.Write(cmd.OutOrStdout(), reqs)
+	}
+
+	outFile, err := os.Create(exportOutput)
+	if err != nil {
+		return fmt.Errorf("creating cpanfile: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := cpanfile.Write(outFile, reqs); err != nil {
+		return fmt.Errorf("writing cpanfile: %w", err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Generated %s with %d requirements\n", exportOutput, len(reqs))
+	return nil
+}
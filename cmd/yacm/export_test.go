@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunExportCpanfile(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "cpanfile.snapshot")
+	content := `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  Foo-1.0
+    pathname: A/AU/AUTHOR/Foo-1.0.tar.gz
+    provides:
+      Foo 1.0
+    requirements:
+      strict 0
+`
+	if err := os.WriteFile(snapshotFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outFile := filepath.Join(t.TempDir(), "cpanfile")
+
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{name: "stdout", output: "-", want: "requires 'Foo', '== 1.0';\n"},
+		{name: "file", output: outFile, want: "Generated " + outFile + " with 1 requirements\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			cmd := newExportCpanfileCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetArgs([]string{"--snapshot", snapshotFile, "--output", tt.output})
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
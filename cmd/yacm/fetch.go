@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/logger"
+)
+
+func newFetchCmd() *cobra.Command {
+	fetchCmd := &cobra.Command{
+		Use:   "fetch",
+		Short: "Download all tarballs of a cpanfile.snapshot into the cache",
+		RunE:  runFetch,
+	}
+
+	fetchCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Input snapshot path")
+	fetchCmd.Flags().StringVarP(&mirror, "mirror", "m", "https://cpan.metacpan.org", "CPAN mirror URL")
+	fetchCmd.Flags().IntVarP(&workers, "workers", "w", 5, "Parallel download workers")
+	fetchCmd.Flags().IntVar(&failFast, "fail-fast-threshold", 0, "Give up on the mirror after this many downloads fail with a connection error or HTTP 5xx status (0 for never)")
+
+	return fetchCmd
+}
+
+func runFetch(cmd *cobra.Command, args []string) error {
+	dists, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	cacheDir, err := resolveCacheDir()
+	if err != nil {
+		return err
+	}
+
+	client, err := newHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	log := newLogger()
+	dl := downloader.NewDownloader(workers, cacheDir)
+	dl.SetLogger(log)
+	dl.SetHTTPClient(client)
+	dl.SetFailFastThreshold(failFast)
+
+	return fetchJobs(cmd.OutOrStdout(), dl, dl.PlanJobs(mirrorURL(cmd), dists), log)
+}
+
+// fetchJobs downloads jobs in parallel and reports fetched vs cached counts
+// to w.
+func fetchJobs(w io.Writer, dl *downloader.Downloader, jobs []downloader.Job, log *logger.Logger) error {
+	var fetched, cached, failed int
+	for _, result := range dl.Download(jobs) {
+		switch {
+		case result.Error != nil:
+			log.Errorf("%v", result.Error)
+			failed++
+		case result.FromCache:
+			cached++
+		default:
+			fetched++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d downloads failed", failed, len(jobs))
+	}
+
+	fmt.Fprintf(w, "Fetched %d distributions, %d already cached in %s\n", fetched, cached, dl.CacheDir())
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/frederic-klein/yacm/internal/snapshot"
+)
+
+// checkFrozen compares the snapshot generated for --frozen with the one at
+// path. If their distributions differ, the differences are written to w and
+// an error is returned; path is never written.
+func checkFrozen(w io.Writer, path string, generated []byte) error {
+	if path == "-" {
+		return fmt.Errorf("--frozen needs a snapshot file to compare with, not standard output")
+	}
+	existing, err := readSnapshot(path)
+	if err != nil {
+		return fmt.Errorf("frozen: %w", err)
+	}
+	// Compare parsed distributions, so comments such as the provenance
+	// line do not count as changes
+	resolved, err := snapshot.NewParser(bytes.NewReader(generated)).Parse()
+	if err != nil {
+		return fmt.Errorf("frozen: parsing generated snapshot: %w", err)
+	}
+
+	changes := snapshot.Diff(existing, resolved)
+	if len(changes) == 0 {
+		_, err := fmt.Fprintf(w, "%s is up to date\n", path)
+		return err
+	}
+	for _, change := range changes {
+		if _, err := fmt.Fprintln(w, change); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("frozen: %s is out of date (%d changed distributions); run yacm snapshot to update it", path, len(changes))
+}
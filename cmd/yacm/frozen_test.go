@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSnapshot_Frozen(t *testing.T) {
+	// Arrange: a snapshot generated for a cpanfile requiring Foo
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { frozen = false })
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Baz\t1.0\tA/AU/AUTHOR/Baz-1.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`),
+		"/authors/id/A/AU/AUTHOR/Baz-1.0.tar.gz": tarball(t, "Baz-1.0/META.json",
+			`{"name":"Baz","version":"1.0","provides":{"Baz":{"file":"lib/Baz.pm","version":"1.0"}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cpanfile := filepath.Join(dir, "cpanfile")
+	snapshotFile := filepath.Join(dir, "cpanfile.snapshot")
+	backpan := t.TempDir()
+	args := []string{"-f", cpanfile, "-s", snapshotFile, "--mirror", server.URL, "--backpan-dir", backpan}
+	if err := os.WriteFile(cpanfile, []byte("requires 'Foo';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	generate := newSnapshotCmd()
+	generate.SetArgs(args)
+	if err := generate.Execute(); err != nil {
+		t.Fatalf("generating snapshot: %v", err)
+	}
+	committed, err := os.ReadFile(snapshotFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cpanfile string
+		wantErr  bool
+		wantOut  string
+	}{
+		{name: "unchanged", cpanfile: "requires 'Foo';\n", wantOut: snapshotFile + " is up to date\n"},
+		{name: "changed cpanfile", cpanfile: "requires 'Foo';\nrequires 'Baz';\n", wantErr: true, wantOut: "+ Baz-1.0 (A/AU/AUTHOR/Baz-1.0.tar.gz)\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(cpanfile, []byte(tt.cpanfile), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cmd := newSnapshotCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetArgs(append(args, "--frozen"))
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "out of date") {
+				t.Errorf("error = %v, want the snapshot reported out of date", err)
+			}
+			if out.String() != tt.wantOut {
+				t.Errorf("output =\n%s\nwant:\n%s", out.String(), tt.wantOut)
+			}
+			got, err := os.ReadFile(snapshotFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, committed) {
+				t.Errorf("--frozen rewrote the snapshot:\n%s", got)
+			}
+		})
+	}
+}
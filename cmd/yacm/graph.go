@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+var graphFormat string
+
+func newGraphCmd() *cobra.Command {
+	graphCmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Resolve a cpanfile and print the dependency graph of its distributions",
+		RunE:  runGraph,
+	}
+
+	addReportFlags(graphCmd)
+	graphCmd.Flags().StringVar(&graphFormat, "format", "json", "Output format: json (nodes and edges)")
+
+	return graphCmd
+}
+
+// graphJSON is the dependency graph written by the graph command.
+type graphJSON struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// graphNode is a resolved distribution.
+type graphNode struct {
+	Name         string            `json:"name"`
+	Pathname     string            `json:"pathname"`
+	TopLevel     bool              `json:"top_level,omitempty"`
+	Provides     map[string]string `json:"provides"`
+	Requirements map[string]string `json:"requirements"`
+}
+
+// graphEdge records that distribution From requires Module, which
+// distribution To provides.
+type graphEdge struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Module  string `json:"module"`
+	Version string `json:"version"`
+}
+
+func runGraph(cmd *cobra.Command, args []string) error {
+	if graphFormat != "json" {
+		return fmt.Errorf("unknown --format %q: want json", graphFormat)
+	}
+
+	result, err := resolveForReport(cmd)
+	if err != nil {
+		return err
+	}
+
+	return writeGraphJSON(cmd.OutOrStdout(), buildGraph(result.TopLevel, result.Distributions))
+}
+
+// buildGraph returns a node per distribution and an edge per requirement
+// of a distribution on a module another distribution provides. Modules
+// without a distribution, such as core modules, have no edge. Nodes are
+// sorted by name and edges by source, then module.
+func buildGraph(topLevel []string, dists []*dist.Dist) graphJSON {
+	byModule := distsByModule(dists)
+	direct := make(map[string]bool)
+	for _, module := range topLevel {
+		if d, ok := byModule[module]; ok {
+			direct[d.Name] = true
+		}
+	}
+
+	graph := graphJSON{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	for _, d := range dists {
+		node := graphNode{
+			Name:         d.Name,
+			Pathname:     d.Pathname,
+			TopLevel:     direct[d.Name],
+			Provides:     d.Provides,
+			Requirements: d.Requirements,
+		}
+		if node.Provides == nil {
+			node.Provides = map[string]string{}
+		}
+		if node.Requirements == nil {
+			node.Requirements = map[string]string{}
+		}
+		graph.Nodes = append(graph.Nodes, node)
+
+		for module, version := range d.Requirements {
+			to, ok := byModule[module]
+			if !ok || to.Name == d.Name {
+				continue
+			}
+			graph.Edges = append(graph.Edges, graphEdge{From: d.Name, To: to.Name, Module: module, Version: version})
+		}
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].Name < graph.Nodes[j].Name })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].Module < graph.Edges[j].Module
+	})
+	return graph
+}
+
+func writeGraphJSON(w io.Writer, graph graphJSON) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(graph)
+}
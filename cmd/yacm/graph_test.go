@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunGraph(t *testing.T) {
+	// Arrange: a mirror where Foo and Baz both require Bar, and Foo a core module
+	t.Setenv("HOME", t.TempDir())
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Bar\t2.0\tA/AU/AUTHOR/Bar-2.0.tar.gz\n" +
+		"Baz\t1.0\tA/AU/AUTHOR/Baz-1.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"1.5","strict":"0"}}}}`),
+		"/authors/id/A/AU/AUTHOR/Bar-2.0.tar.gz": tarball(t, "Bar-2.0/META.json",
+			`{"name":"Bar","version":"2.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"2.0"}}}`),
+		"/authors/id/A/AU/AUTHOR/Baz-1.0.tar.gz": tarball(t, "Baz-1.0/META.json",
+			`{"name":"Baz","version":"1.0","provides":{"Baz":{"file":"lib/Baz.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"0"}}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	cpanfile := filepath.Join(t.TempDir(), "cpanfile")
+	if err := os.WriteFile(cpanfile, []byte("requires 'Foo';\nrequires 'Baz';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newGraphCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"-f", cpanfile, "--format", "json", "--mirror", server.URL, "--backpan-dir", t.TempDir()})
+
+	// Act
+	err := cmd.Execute()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var graph graphJSON
+	if err := json.Unmarshal(out.Bytes(), &graph); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	wantEdges := []graphEdge{
+		{From: "Baz-1.0", To: "Bar-2.0", Module: "Bar", Version: "0"},
+		{From: "Foo-1.0", To: "Bar-2.0", Module: "Bar", Version: "1.5"},
+	}
+	if !reflect.DeepEqual(graph.Edges, wantEdges) {
+		t.Errorf("edges = %+v, want %+v", graph.Edges, wantEdges)
+	}
+	var names []string
+	for _, node := range graph.Nodes {
+		names = append(names, node.Name)
+	}
+	if want := []string{"Bar-2.0", "Baz-1.0", "Foo-1.0"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("nodes = %v, want %v", names, want)
+	}
+	foo := graph.Nodes[2]
+	if !foo.TopLevel || foo.Provides["Foo"] != "1.0" || foo.Requirements["strict"] != "0" {
+		t.Errorf("Foo node = %+v, want top-level, providing Foo 1.0 and requiring strict", foo)
+	}
+	if graph.Nodes[0].TopLevel {
+		t.Errorf("Bar node is top-level, want only required by other distributions")
+	}
+}
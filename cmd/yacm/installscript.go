@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/snapshot"
+)
+
+var scriptOutput string
+
+func newInstallScriptCmd() *cobra.Command {
+	scriptCmd := &cobra.Command{
+		Use:   "install-script",
+		Short: "Generate a shell script installing the distributions of a cpanfile.snapshot without Carton",
+		RunE:  runInstallScript,
+	}
+
+	scriptCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Input snapshot path")
+	scriptCmd.Flags().StringVarP(&mirror, "mirror", "m", "https://cpan.metacpan.org", "CPAN mirror URL the script downloads from")
+	scriptCmd.Flags().StringVarP(&scriptOutput, "output", "o", "-", "Output script path (- for stdout)")
+
+	return scriptCmd
+}
+
+func runInstallScript(cmd *cobra.Command, args []string) error {
+	dists, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	if scriptOutput == "-" {
+		return writeInstallScript(cmd.OutOrStdout(), mirrorURL(cmd), dists)
+	}
+
+	outFile, err := os.OpenFile(scriptOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("creating install script: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := writeInstallScript(outFile, mirrorURL(cmd), dists); err != nil {
+		return fmt.Errorf("writing install script: %w", err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Generated %s installing %d distributions\n", scriptOutput, len(dists))
+	return nil
+}
+
+// installScriptHeader defines install_dist, which downloads a tarball and
+// runs the usual Build.PL or Makefile.PL steps. Tests are skipped when
+// YACM_NO_TEST is set.
+const installScriptHeader = `#!/bin/sh
+# Generated by yacm install-script. Installs the distributions of a
+# cpanfile.snapshot in dependency order; set YACM_NO_TEST=1 to skip tests.
+set -eu
+
+workdir=$(mktemp -d)
+trap 'rm -rf "$workdir"' EXIT
+
+install_dist() {
+	url=$1
+	echo "==> $url"
+	rm -rf "$workdir/build"
+	mkdir "$workdir/build"
+	curl -fsSL "$url" | tar -xzf - -C "$workdir/build"
+	(
+		cd "$workdir"/build/*/
+		if [ -f Build.PL ]; then
+			perl Build.PL
+			./Build
+			[ -n "${YACM_NO_TEST:-}" ] || ./Build test
+			./Build install
+		else
+			perl Makefile.PL
+			make
+			[ -n "${YACM_NO_TEST:-}" ] || make test
+			make install
+		fi
+	)
+}
+
+`
+
+// writeInstallScript writes a shell script installing dists from mirror,
+// each after the distributions it requires. Distributions sharing a
+// pathname are installed once.
+func writeInstallScript(w io.Writer, mirror string, dists []*dist.Dist) error {
+	sorted, err := snapshot.TopoSort(dists)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, installScriptHeader); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, d := range sorted {
+		if d.Pathname == "" || seen[d.Pathname] {
+			continue
+		}
+		seen[d.Pathname] = true
+		if _, err := fmt.Fprintf(w, "install_dist %s\n", shellQuote(downloader.TarballURL(mirror, d.Pathname))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunInstallScript(t *testing.T) {
+	// Arrange: Foo requires Bar, which requires Baz; listed alphabetically
+	snapshotFile := filepath.Join(t.TempDir(), "cpanfile.snapshot")
+	content := `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  Bar-2.0
+    pathname: A/AU/AUTHOR/Bar-2.0.tar.gz
+    provides:
+      Bar 2.0
+    requirements:
+      Baz 0
+  Baz-1.0
+    pathname: B/BA/BAZ/Baz-1.0.tar.gz
+    provides:
+      Baz 1.0
+    requirements:
+      strict 0
+  Foo-1.0
+    pathname: A/AU/AUTHOR/Foo-1.0.tar.gz
+    provides:
+      Foo 1.0
+    requirements:
+      Bar 1.5
+`
+	if err := os.WriteFile(snapshotFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newInstallScriptCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--snapshot", snapshotFile, "--mirror", "https://mirror.example.com/"})
+
+	// Act
+	err := cmd.Execute()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	script := out.String()
+	if !strings.HasPrefix(script, "#!/bin/sh\n") {
+		t.Errorf("script does not start with a shebang:\n%s", script)
+	}
+	var installs []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(line, "install_dist ") {
+			installs = append(installs, line)
+		}
+	}
+	want := []string{
+		"install_dist 'https://mirror.example.com/authors/id/B/BA/BAZ/Baz-1.0.tar.gz'",
+		"install_dist 'https://mirror.example.com/authors/id/A/AU/AUTHOR/Bar-2.0.tar.gz'",
+		"install_dist 'https://mirror.example.com/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz'",
+	}
+	if strings.Join(installs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("install lines =\n%s\nwant:\n%s", strings.Join(installs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"A/AU/AUTHOR/Foo-1.0.tar.gz", "'A/AU/AUTHOR/Foo-1.0.tar.gz'"},
+		{"it's", `'it'\''s'`},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
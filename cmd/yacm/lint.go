@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/cpanfile"
+)
+
+func newLintCmd() *cobra.Command {
+	lintCmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Report problems in a cpanfile without resolving it",
+		RunE:  runLint,
+	}
+
+	lintCmd.Flags().StringVarP(&cpanfilePath, "cpanfile", "f", "./cpanfile", "Input cpanfile path")
+
+	return lintCmd
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	result, err := cpanfile.NewParser().Parse(cpanfilePath)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	for _, w := range result.Warnings {
+		if _, err := fmt.Fprintln(out, w); err != nil {
+			return err
+		}
+	}
+
+	n := len(result.Warnings)
+	if n == 0 {
+		fmt.Fprintf(out, "%s: no problems found\n", cpanfilePath)
+		return nil
+	}
+	// Problems in the cpanfile are not a usage error
+	cmd.SilenceUsage = true
+	switch n {
+	case 1:
+		return fmt.Errorf("%s: 1 problem found", cpanfilePath)
+	default:
+		return fmt.Errorf("%s: %d problems found", cpanfilePath, n)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunLint(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantErr   string
+		wantLines []string
+	}{
+		{
+			name:      "clean",
+			content:   "requires 'perl', '5.010';\nrequires 'Moo', '2.0';\non 'test' => sub {\n    requires 'Test::More';\n};\n",
+			wantLines: []string{"no problems found"},
+		},
+		{
+			name:      "phase shorthands",
+			content:   "test_requires 'Test::More';\nauthor_requires 'Perl::Critic';\nconfigure_requires 'Module::Build';\non test => sub {\n    requires 'Test::Deep';\n};\n",
+			wantLines: []string{"no problems found"},
+		},
+		{
+			name:    "duplicates and conflicts",
+			content: "requires 'Moo', '2.0';\nrequires 'JSON';\nrequires 'JSON';\non 'test' => sub {\n    requires 'Moo', '1.0';\n};\n",
+			wantErr: "2 problems found",
+			wantLines: []string{
+				"cpanfile:3: duplicate requirement for JSON in phase runtime",
+				"cpanfile:5: Moo required as 1.0 here but as 2.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "cpanfile")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cmd := newLintCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs([]string{"-f", path})
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+			if strings.Contains(out.String(), "Usage:") {
+				t.Errorf("output includes the usage text:\n%s", out.String())
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("output missing %q:\n%s", line, out.String())
+				}
+			}
+		})
+	}
+}
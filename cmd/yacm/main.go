@@ -1,18 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/frederic-klein/yacm"
 	"github.com/frederic-klein/yacm/internal/cpanfile"
 	"github.com/frederic-klein/yacm/internal/dist"
-	"github.com/frederic-klein/yacm/internal/downloader"
-	"github.com/frederic-klein/yacm/internal/index"
-	"github.com/frederic-klein/yacm/internal/resolver"
-	"github.com/frederic-klein/yacm/internal/snapshot"
+	"github.com/frederic-klein/yacm/internal/httpclient"
+	"github.com/frederic-klein/yacm/internal/logger"
 )
 
 var (
@@ -21,8 +29,63 @@ var (
 	workers      int
 	mirror       string
 	backpanDir   string
+	localAuthor  string
 	dockerImage  string
-	verbose      bool
+	verbosity    int
+	debug        bool
+	quiet        bool
+	userAgent    string
+	jsonErrors   bool
+	outputFormat string
+	fromFormat   string
+	shallow      []string
+	only         []string
+	withoutFeat  []string
+	skipNS       []string
+	maxBPANAge   string
+	timeout      time.Duration
+	configJobs   int
+	failFast     int
+	apiWorkers   int
+	indexURL     string
+	phases       []string
+	testSnapshot string
+	configPath   string
+	constraints  string
+	versionPol   string
+	onCycle      string
+	cacheDir     string
+
+	partialOnInterrupt bool
+	includeDevelop     bool
+	metaAPI            bool
+	lazyDownload       bool
+	refreshIndex       bool
+	includeRecommends  bool
+	includeSuggests    bool
+	customPhases       bool
+	offline            bool
+	keepBuild          bool
+	upgrade            bool
+	preferBackPAN      bool
+	keepGoing          bool
+	strict             bool
+	emitProvenance     bool
+	phaseComments      bool
+	noCoreSkip         bool
+	fuzzyCase          bool
+	noTransitive       bool
+	frozen             bool
+
+	cpanfilePaths []string
+	extraIndexes  []string
+	indexPriority []string
+	pinDists      []string
+
+	httpTimeout time.Duration
+	httpRetries int
+	proxyURL    string
+	rateLimit   float64
 )
 
 func main() {
@@ -32,112 +95,463 @@ func main() {
 		Long:  "YACM resolves Perl module dependencies from CPAN and BackPAN, generating snapshot files compatible with Carton and Carmel.",
 	}
 
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Verbose output (repeat for debug output)")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Debug output, including every HTTP request")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print errors and the final status")
+	rootCmd.PersistentFlags().BoolVar(&jsonErrors, "json-errors", false, "Report failures as a JSON object on stderr")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "Cache directory for the index and tarballs (default: $"+yacm.CacheDirEnv+" or ~/.yacm/cache)")
+	rootCmd.PersistentFlags().StringVar(&userAgent, "user-agent", httpclient.DefaultUserAgent(), "User-Agent header for HTTP requests")
+	rootCmd.PersistentFlags().DurationVar(&httpTimeout, "http-timeout", 0, "Give up on an HTTP request, body included, after this long, e.g. 5m (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&httpRetries, "http-retries", 0, "Retry HTTP requests failing with a connection error or HTTP 5xx status this many times, with backoff")
+	rootCmd.PersistentFlags().StringVar(&proxyURL, "proxy", "", "HTTP proxy URL for all requests (default: $HTTPS_PROXY, $HTTP_PROXY and $NO_PROXY)")
+	rootCmd.PersistentFlags().Float64Var(&rateLimit, "rate-limit", 0, "Maximum HTTP requests per second, e.g. to spare a small mirror (0 for no limit)")
+
+	rootCmd.AddCommand(newSnapshotCmd())
+	rootCmd.AddCommand(newPlanCmd())
+	rootCmd.AddCommand(newExportCpanfileCmd())
+	rootCmd.AddCommand(newFetchCmd())
+	rootCmd.AddCommand(newInstallScriptCmd())
+	rootCmd.AddCommand(newCoreCmd())
+	rootCmd.AddCommand(newVerifyCacheCmd())
+	rootCmd.AddCommand(newRepairCmd())
+	rootCmd.AddCommand(newResolveCmd())
+	rootCmd.AddCommand(newLintCmd())
+	rootCmd.AddCommand(newTreeCmd())
+	rootCmd.AddCommand(newWhyCmd())
+	rootCmd.AddCommand(newGraphCmd())
+	rootCmd.AddCommand(newURLsCmd())
+
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if jsonErrors {
+			cmd.Root().SilenceErrors = true
+			cmd.Root().SilenceUsage = true
+		}
+	}
+
+	if err := rootCmd.Execute(); err != nil {
+		if jsonErrors {
+			writeJSONError(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+func newSnapshotCmd() *cobra.Command {
 	snapshotCmd := &cobra.Command{
 		Use:   "snapshot",
 		Short: "Generate cpanfile.snapshot from cpanfile",
 		RunE:  runSnapshot,
 	}
 
-	snapshotCmd.Flags().StringVarP(&cpanfilePath, "cpanfile", "f", "./cpanfile", "Input cpanfile path")
-	snapshotCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Output snapshot path")
+	snapshotCmd.Flags().StringArrayVarP(&cpanfilePaths, "cpanfile", "f", []string{"./cpanfile"}, "Input cpanfile path (Makefile.PL, Build.PL or module list path with --from); repeatable to merge several into one snapshot")
+	snapshotCmd.Flags().StringVar(&fromFormat, "from", "cpanfile", "Requirements source: cpanfile, makefile (Makefile.PL), build (Build.PL) or list (\"Module::Name version\" per line)")
+	snapshotCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Output snapshot path (- for stdout)")
+	snapshotCmd.Flags().StringVar(&testSnapshot, "test-snapshot", "", "Write distributions only needed by test and develop requirements to this separate snapshot")
+	snapshotCmd.Flags().StringVar(&outputFormat, "format", "carton", "Output format: carton (cpanfile.snapshot) or modules (flat module list)")
 	snapshotCmd.Flags().IntVarP(&workers, "workers", "w", 5, "Parallel download workers")
+	snapshotCmd.Flags().IntVar(&apiWorkers, "metacpan-workers", 0, "Concurrent MetaCPAN lookups prefetching exact version pins before resolving (0 to look them up one by one as they are resolved)")
+	snapshotCmd.Flags().IntVar(&failFast, "fail-fast-threshold", 0, "Give up on the mirror after this many downloads fail with a connection error or HTTP 5xx status (0 for never)")
 	snapshotCmd.Flags().StringVarP(&mirror, "mirror", "m", "https://cpan.metacpan.org", "CPAN mirror URL")
+	snapshotCmd.Flags().StringVar(&indexURL, "index-url", "", "Full URL of an alternative 02packages.details.txt[.gz], e.g. a historical one; tarballs still come from --mirror")
+	snapshotCmd.Flags().BoolVar(&refreshIndex, "refresh-index", false, "Download the CPAN index even if the cached copy is fresh")
+	snapshotCmd.Flags().StringArrayVar(&extraIndexes, "extra-index", nil, "Additional mirror (e.g. a DarkPAN) whose index is merged with CPAN; repeatable")
+	snapshotCmd.Flags().StringSliceVar(&indexPriority, "index-priority", nil, "Index URLs in priority order for modules listed at the same version in several indexes (default: --mirror, then --extra-index order)")
+	snapshotCmd.Flags().BoolVar(&fuzzyCase, "fuzzy-case", false, "If a module is not in the index, use the one module whose name differs only in case (with a warning)")
 	snapshotCmd.Flags().StringVar(&backpanDir, "backpan-dir", "./backpan-modules", "BackPAN modules directory")
+	snapshotCmd.Flags().StringVar(&localAuthor, "local-author", "", "CPAN author listed in snapshot pathnames for curated tarballs directly in --backpan-dir, e.g. LOCAL")
+	snapshotCmd.Flags().IntVar(&configJobs, "configure-jobs", runtime.NumCPU(), "Maximum configure scripts running at once (0 for no limit)")
+	snapshotCmd.Flags().StringVar(&configPath, "config", "./yacm.yml", "YAML config file with per-distribution configure overrides (ignored if the default is missing)")
+	snapshotCmd.Flags().BoolVar(&keepBuild, "keep-build", false, "Keep the build directory of a failed configure run for inspection; its path is logged")
 	snapshotCmd.Flags().StringVar(&dockerImage, "docker", "", "Docker image for running configure (ensures consistent dynamic prereqs)")
-	snapshotCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	snapshotCmd.Flags().StringArrayVar(&phases, "include-phase", yacm.DefaultPhases, "cpanfile phase to resolve (runtime, test, build, configure, develop); repeatable")
+	snapshotCmd.Flags().BoolVar(&includeRecommends, "include-recommends", false, "Also resolve recommended prerequisites from META (default: $YACM_WITH_RECOMMENDS)")
+	snapshotCmd.Flags().BoolVar(&customPhases, "include-custom-phases", false, "Also resolve META prerequisites of nonstandard phases such as x_runtime, as runtime ones (they are warned about either way)")
+	snapshotCmd.Flags().BoolVar(&includeSuggests, "include-suggests", false, "Also resolve suggested prerequisites from META (default: $YACM_WITH_SUGGESTS)")
+	snapshotCmd.Flags().BoolVar(&includeDevelop, "include-develop", false, "Also resolve develop-phase prerequisites of every distribution (default: $YACM_WITH_DEVELOP)")
+	snapshotCmd.Flags().BoolVar(&noCoreSkip, "no-core-skip", false, "Resolve modules shipped with perl from CPAN too, e.g. for a self-contained bundle")
+	snapshotCmd.Flags().BoolVar(&metaAPI, "meta-api", false, "Take prerequisites from MetaCPAN metadata instead of downloading tarballs (faster, ignores dynamic prereqs)")
+	snapshotCmd.Flags().BoolVar(&lazyDownload, "lazy-download", false, "Take prerequisites from MetaCPAN metadata, downloading and configuring only tarballs with dynamic prereqs or without metadata")
+	snapshotCmd.Flags().BoolVar(&offline, "offline", false, "Never run configure (it may access the network); use static META prereqs")
+	snapshotCmd.Flags().BoolVar(&upgrade, "upgrade", false, "Treat cpanfile versions as minimums and prefer the latest CPAN release over exact pins")
+	snapshotCmd.Flags().StringVar(&onCycle, "on-cycle", "skip", "Circular dependencies: skip them, warn naming the cycle (e.g. Foo -> Bar -> Foo), or error")
+	snapshotCmd.Flags().StringVar(&versionPol, "version-policy", "latest", "Release to use when several satisfy a requirement: latest, or minimum (the oldest, via MetaCPAN) to test against minimum versions")
+	snapshotCmd.Flags().BoolVar(&preferBackPAN, "prefer-backpan", false, "Resolve exact version pins (== 1.23) via MetaCPAN, never the CPAN index, to get that exact release")
+	snapshotCmd.Flags().StringSliceVar(&withoutFeat, "without-feature", nil, "Leave out the requirements of these cpanfile optional features, like carton install --without; repeatable or comma-separated")
+	snapshotCmd.Flags().StringSliceVar(&only, "only", nil, "Resolve only these top-level modules of the cpanfile and their prerequisites, e.g. to bisect a dependency problem; repeatable or comma-separated")
+	snapshotCmd.Flags().BoolVar(&noTransitive, "no-transitive", false, "Resolve only the cpanfile's direct dependencies, not their prerequisites, for a minimal top-level manifest")
+	snapshotCmd.Flags().StringSliceVar(&shallow, "shallow", nil, "Modules to resolve without following their prerequisites; repeatable")
+	snapshotCmd.Flags().StringArrayVar(&skipNS, "skip-namespace", nil, "Namespace (e.g. Acme::) whose modules and their prerequisites are never resolved; repeatable")
+	snapshotCmd.Flags().StringVar(&constraints, "constraints", "", "File of \"Module::Name constraint\" lines applied to every request for those modules, like pip's constraints files")
+	snapshotCmd.Flags().StringArrayVar(&pinDists, "pin-dist", nil, "Distribution pathname (e.g. A/AU/AUTHOR/Foo-1.23.tar.gz) to use for every module it provides; repeatable")
+	snapshotCmd.Flags().StringVar(&maxBPANAge, "max-backpan-age", "", "Fail when a requirement needs a BackPAN release older than this, e.g. 10y, 180d or 72h")
+	snapshotCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Continue past requirements that fail to resolve and report every failure at the end")
+	snapshotCmd.Flags().BoolVar(&strict, "strict", false, "Fail without writing a snapshot if any warning is logged")
+	snapshotCmd.Flags().BoolVar(&emitProvenance, "emit-provenance", false, "Record the yacm version and index used in a snapshot comment (ignored by Carton)")
+	snapshotCmd.Flags().DurationVar(&timeout, "timeout", 0, "Give up when the snapshot is not generated within this time, e.g. 10m (0 for no limit)")
+	snapshotCmd.Flags().BoolVar(&phaseComments, "phase-comments", false, "Annotate each requirement with the META phase declaring it, e.g. \"Test::More 0  # build\" (ignored by Carton)")
+	snapshotCmd.Flags().BoolVar(&partialOnInterrupt, "partial-on-interrupt", false, "On interrupt, write the distributions resolved so far to a snapshot marked incomplete")
+	snapshotCmd.Flags().BoolVar(&frozen, "frozen", false, "Fail and print the differences if the snapshot would change, without writing it, e.g. to check in CI that it is up to date")
 
-	rootCmd.AddCommand(snapshotCmd)
+	return snapshotCmd
+}
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+// readConfigFile reads --config. A missing file is only an error when the
+// flag was given explicitly.
+func readConfigFile(cmd *cobra.Command) (*yacm.ConfigFile, error) {
+	flag := cmd.Flags().Lookup("config")
+	if flag == nil || configPath == "" {
+		return &yacm.ConfigFile{}, nil
 	}
+	cf, err := yacm.ReadConfigFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) && !flag.Changed {
+		return &yacm.ConfigFile{}, nil
+	}
+	return cf, err
 }
 
 func runSnapshot(cmd *cobra.Command, args []string) error {
-	log := func(format string, args ...interface{}) {
-		if verbose {
-			fmt.Printf(format+"\n", args...)
+	log := newLogger()
+
+	parseResult, err := parseRequirements(cmd, log)
+	if err != nil {
+		return err
+	}
+	warnings := make([]string, len(parseResult.Warnings))
+	for i, w := range parseResult.Warnings {
+		warnings[i] = w.String()
+	}
+	return generateSnapshot(cmd, parseResult.Requirements, warnings, log)
+}
+
+// generateSnapshot runs yacm.Generate on reqs with the flag settings and
+// writes the result to --snapshot, or to standard output when it is "-".
+// The parse warnings are logged by Generate so that --strict counts them.
+func generateSnapshot(cmd *cobra.Command, reqs map[dist.Phase][]dist.VersionReq, parseWarnings []string, log *logger.Logger) error {
+	var maxAge time.Duration
+	if maxBPANAge != "" {
+		age, err := parseAge(maxBPANAge)
+		if err != nil {
+			return fmt.Errorf("--max-backpan-age: %w", err)
 		}
+		maxAge = age
 	}
 
-	// Parse cpanfile
-	log("Parsing cpanfile: %s", cpanfilePath)
-	parser := cpanfile.NewParser()
-	parseResult, err := parser.Parse(cpanfilePath)
+	configFile, err := readConfigFile(cmd)
+	if err != nil {
+		return err
+	}
+	withRecommends, err := envBoolFlag(cmd, "include-recommends", includeRecommends)
+	if err != nil {
+		return err
+	}
+	withSuggests, err := envBoolFlag(cmd, "include-suggests", includeSuggests)
+	if err != nil {
+		return err
+	}
+	withDevelop, err := envBoolFlag(cmd, "include-develop", includeDevelop)
+	if err != nil {
+		return err
+	}
+	cache, err := resolveCacheDir()
+	if err != nil {
+		return err
+	}
+	client, err := newHTTPClient()
 	if err != nil {
-		return fmt.Errorf("parsing cpanfile: %w", err)
+		return err
+	}
+	var versionConstraints map[string]string
+	if constraints != "" {
+		if versionConstraints, err = cpanfile.ParseConstraints(constraints); err != nil {
+			return fmt.Errorf("--constraints: %w", err)
+		}
 	}
 
-	// Collect all requirements (runtime + test + build)
-	var allReqs []dist.VersionReq
-	for phase, reqs := range parseResult.Requirements {
-		log("Found %d requirements for phase: %s", len(reqs), phase)
-		allReqs = append(allReqs, reqs...)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Snapshots are buffered so that no file is written when generation fails
+	var out, testOut bytes.Buffer
+	cfg := yacm.Config{
+		Context:            ctx,
+		Timeout:            timeout,
+		Requirements:       reqs,
+		ParseWarnings:      parseWarnings,
+		Phases:             phases,
+		Mirror:             mirrorURL(cmd),
+		IndexURL:           indexURL,
+		ExtraIndexes:       extraIndexes,
+		IndexCacheTTLs:     configFile.IndexCacheTTLs(),
+		IndexPriority:      indexPriority,
+		RefreshIndex:       refreshIndex,
+		FuzzyCase:          fuzzyCase,
+		CacheDir:           cache,
+		BackPANDir:         backpanDir,
+		LocalAuthor:        localAuthor,
+		Workers:            workers,
+		FailFastThreshold:  failFast,
+		MetaCPANWorkers:    apiWorkers,
+		HTTPClient:         client,
+		DockerImage:        dockerImage,
+		ConfigureJobs:      configJobs,
+		KeepBuild:          keepBuild,
+		ConfigureOverrides: configFile.Configure,
+		Offline:            offline,
+		IncludeRecommends:  withRecommends,
+		IncludeSuggests:    withSuggests,
+		CustomPhases:       customPhases,
+		IncludeDevelop:     withDevelop,
+		IncludeCore:        noCoreSkip,
+		MetaAPI:            metaAPI,
+		LazyDownload:       lazyDownload,
+		Upgrade:            upgrade,
+		PreferBackPAN:      preferBackPAN,
+		VersionPolicy:      versionPol,
+		CyclePolicy:        onCycle,
+		KeepGoing:          keepGoing,
+		Shallow:            shallow,
+		NoTransitive:       noTransitive,
+		Only:               only,
+		WithoutFeatures:    withoutFeat,
+		SkipNamespaces:     skipNS,
+		Constraints:        versionConstraints,
+		PinnedDists:        pinDists,
+		MaxBackPANAge:      maxAge,
+		PartialOnInterrupt: partialOnInterrupt,
+		Strict:             strict,
+		EmitProvenance:     emitProvenance,
+		PhaseComments:      phaseComments,
+		Format:             outputFormat,
+		Output:             &out,
+		Log:                log,
+	}
+	if testSnapshot != "" {
+		cfg.TestOutput = &testOut
 	}
 
-	if len(allReqs) == 0 {
-		return fmt.Errorf("no requirements found in cpanfile")
+	if frozen && outputFormat != "carton" {
+		return fmt.Errorf("--frozen only compares carton snapshots, not --format %s", outputFormat)
 	}
 
-	// Setup cache directory
-	homeDir, err := os.UserHomeDir()
+	result, err := yacm.Generate(cfg)
 	if err != nil {
-		return fmt.Errorf("getting home directory: %w", err)
+		return err
 	}
-	cacheDir := filepath.Join(homeDir, ".yacm", "cache")
 
-	// Initialize CPAN index
-	log("Loading CPAN index from %s", mirror)
-	cpanIdx := index.NewCPANIndex(mirror, cacheDir)
-	if err := cpanIdx.Load(); err != nil {
-		return fmt.Errorf("loading CPAN index: %w", err)
+	if frozen {
+		// An out-of-date snapshot is not a usage error
+		cmd.SilenceUsage = true
+		if testSnapshot != "" {
+			if err := checkFrozen(cmd.OutOrStdout(), testSnapshot, testOut.Bytes()); err != nil {
+				return err
+			}
+		}
+		return checkFrozen(cmd.OutOrStdout(), snapshotPath, out.Bytes())
 	}
 
-	// Initialize BackPAN index
-	backpan := index.NewBackPANIndex(backpanDir)
-	if err := backpan.EnsureDir(); err != nil {
-		return fmt.Errorf("creating backpan directory: %w", err)
+	if testSnapshot != "" {
+		if err := writeSnapshot(cmd, testSnapshot, testOut.Bytes(), log); err != nil {
+			return err
+		}
+	}
+	if err := writeSnapshot(cmd, snapshotPath, out.Bytes(), log); err != nil {
+		return err
 	}
 
-	// Initialize downloader
-	dl := downloader.NewDownloader(workers, cacheDir)
+	if result.Incomplete {
+		return fmt.Errorf("wrote partial snapshot %s with %d distributions: resolution interrupted", snapshotPath, len(result.Distributions))
+	}
 
-	// Resolve dependencies
-	if dockerImage != "" {
-		log("Using Docker image for configure: %s", dockerImage)
+	if snapshotPath != "-" {
+		fmt.Fprintf(cmd.OutOrStdout(), "Generated %s with %d distributions\n", snapshotPath, len(result.Distributions))
 	}
-	log("Resolving dependencies...")
-	res := resolver.NewResolver(cpanIdx, backpan, dl, verbose, dockerImage)
-	dists, err := res.Resolve(allReqs)
-	if err != nil {
-		return fmt.Errorf("resolving dependencies: %w", err)
+	if testSnapshot != "" && testSnapshot != "-" {
+		fmt.Fprintf(cmd.OutOrStdout(), "Generated %s with %d distributions\n", testSnapshot, len(result.TestDistributions))
 	}
+	return nil
+}
 
-	log("Resolved %d distributions", len(dists))
+// writeSnapshot writes data to path, or to standard output when it is "-".
+func writeSnapshot(cmd *cobra.Command, path string, data []byte, log *logger.Logger) error {
+	if path == "-" {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+	log.Infof("Writing snapshot: %s", path)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("creating snapshot file: %w", err)
+	}
+	return nil
+}
+
+// parseRequirements reads the requirements selected by --from. For
+// Makefile.PL and Build.PL the --cpanfile path defaults to that file. When
+// --cpanfile is given several times, the requirements of all files are
+// merged and conflicts between them are an error.
+func parseRequirements(cmd *cobra.Command, log *logger.Logger) (*cpanfile.ParseResult, error) {
+	if len(cpanfilePaths) <= 1 {
+		path := "./cpanfile"
+		if len(cpanfilePaths) == 1 {
+			path = cpanfilePaths[0]
+		}
+		return parseRequirementsFile(cmd, path, log)
+	}
+
+	results := make([]*cpanfile.ParseResult, len(cpanfilePaths))
+	for i, path := range cpanfilePaths {
+		result, err := parseRequirementsFile(cmd, path, log)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	log.Infof("Merging requirements of %d files", len(cpanfilePaths))
+	return cpanfile.Merge(cpanfilePaths, results)
+}
 
-	// Deduplicate distributions by pathname
-	seen := make(map[string]bool)
-	var uniqueDists []*dist.Dist
-	for _, d := range dists {
-		if !seen[d.Pathname] {
-			seen[d.Pathname] = true
-			uniqueDists = append(uniqueDists, d)
+// parseRequirementsFile reads the requirements in path in the --from format.
+func parseRequirementsFile(cmd *cobra.Command, path string, log *logger.Logger) (*cpanfile.ParseResult, error) {
+	switch fromFormat {
+	case "cpanfile":
+		log.Infof("Parsing cpanfile: %s", path)
+		result, err := cpanfile.NewParser().Parse(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cpanfile: %w", err)
+		}
+		for _, included := range result.Included {
+			log.Infof("Included cpanfile: %s", included)
+		}
+		return result, nil
+	case "makefile":
+		if !cmd.Flags().Changed("cpanfile") {
+			path = "./Makefile.PL"
+		}
+		log.Infof("Parsing Makefile.PL: %s", path)
+		result, err := cpanfile.ParseMakefilePL(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing Makefile.PL: %w", err)
+		}
+		return result, nil
+	case "build":
+		if !cmd.Flags().Changed("cpanfile") {
+			path = "./Build.PL"
 		}
+		log.Infof("Parsing Build.PL: %s", path)
+		result, err := cpanfile.ParseBuildPL(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing Build.PL: %w", err)
+		}
+		return result, nil
+	case "list":
+		if !cmd.Flags().Changed("cpanfile") {
+			return nil, fmt.Errorf("--from list needs the list path given with -f")
+		}
+		log.Infof("Parsing module list: %s", path)
+		result, err := cpanfile.ParseList(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing module list: %w", err)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unknown --from %q: want cpanfile, makefile, build or list", fromFormat)
 	}
+}
+
+// mirrorEnvVars are consulted, in order, when --mirror is not given.
+var mirrorEnvVars = []string{"YACM_MIRROR", "CPAN_MIRROR"}
 
-	// Write snapshot
-	log("Writing snapshot: %s", snapshotPath)
-	outFile, err := os.Create(snapshotPath)
+// mirrorURL returns the CPAN mirror for cmd. An explicit --mirror wins, with
+// environment variables in it expanded; otherwise the first non-empty
+// variable from mirrorEnvVars is used, then the flag default.
+func mirrorURL(cmd *cobra.Command) string {
+	if cmd.Flags().Changed("mirror") {
+		return os.ExpandEnv(mirror)
+	}
+	for _, name := range mirrorEnvVars {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return mirror
+}
+
+// flagEnvVars name the environment variables that set the default of
+// boolean flags, like cpanm's --with-recommends and friends.
+var flagEnvVars = map[string]string{
+	"include-recommends": "YACM_WITH_RECOMMENDS",
+	"include-suggests":   "YACM_WITH_SUGGESTS",
+	"include-develop":    "YACM_WITH_DEVELOP",
+}
+
+// envBoolFlag returns the boolean flag name of cmd. An explicit flag wins;
+// otherwise its variable from flagEnvVars is used if set, then value.
+func envBoolFlag(cmd *cobra.Command, name string, value bool) (bool, error) {
+	if cmd.Flags().Changed(name) {
+		return value, nil
+	}
+	env := flagEnvVars[name]
+	v := os.Getenv(env)
+	if v == "" {
+		return value, nil
+	}
+	b, err := strconv.ParseBool(v)
 	if err != nil {
-		return fmt.Errorf("creating snapshot file: %w", err)
+		return false, fmt.Errorf("%s: %q is not a boolean", env, v)
 	}
-	defer outFile.Close()
+	return b, nil
+}
 
-	emitter := snapshot.NewEmitter(outFile)
-	if err := emitter.Emit(uniqueDists); err != nil {
-		return fmt.Errorf("writing snapshot: %w", err)
+// resolveCacheDir returns the cache directory: --cache-dir if given,
+// otherwise yacm.DefaultCacheDir.
+func resolveCacheDir() (string, error) {
+	if cacheDir != "" {
+		return cacheDir, nil
 	}
+	return yacm.DefaultCacheDir()
+}
 
-	fmt.Printf("Generated %s with %d distributions\n", snapshotPath, len(uniqueDists))
-	return nil
+// newHTTPClient creates the client for every HTTP request of a command,
+// honoring --user-agent, --http-timeout, --http-retries, --proxy and
+// --rate-limit.
+func newHTTPClient() (*http.Client, error) {
+	return httpclient.NewClient(httpclient.Options{
+		UserAgent: userAgent,
+		Timeout:   httpTimeout,
+		Retries:   httpRetries,
+		Proxy:     proxyURL,
+		RateLimit: rateLimit,
+	})
+}
+
+// newLogger creates a logger on stderr honoring --quiet, --verbose and --debug.
+func newLogger() *logger.Logger {
+	level := logger.LevelWarn
+	switch {
+	case quiet:
+		level = logger.LevelError
+	case debug || verbosity >= 2:
+		level = logger.LevelDebug
+	case verbosity == 1:
+		level = logger.LevelInfo
+	}
+	return logger.New(os.Stderr, level)
+}
+
+// parseAge parses an age given in years ("10y"), days ("180d") or as a Go
+// duration ("72h").
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"y": 365 * 24 * time.Hour, "d": 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm"
+)
+
+func TestMirrorURL(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "built-in default",
+			want: "https://cpan.metacpan.org",
+		},
+		{
+			name: "YACM_MIRROR",
+			env:  map[string]string{"YACM_MIRROR": "https://yacm.example.org"},
+			want: "https://yacm.example.org",
+		},
+		{
+			name: "CPAN_MIRROR",
+			env:  map[string]string{"CPAN_MIRROR": "https://cpan.example.org"},
+			want: "https://cpan.example.org",
+		},
+		{
+			name: "YACM_MIRROR before CPAN_MIRROR",
+			env:  map[string]string{"YACM_MIRROR": "https://yacm.example.org", "CPAN_MIRROR": "https://cpan.example.org"},
+			want: "https://yacm.example.org",
+		},
+		{
+			name: "explicit flag overrides env",
+			args: []string{"--mirror", "https://flag.example.org"},
+			env:  map[string]string{"CPAN_MIRROR": "https://cpan.example.org"},
+			want: "https://flag.example.org",
+		},
+		{
+			name: "flag expands env",
+			args: []string{"--mirror", "$CPAN_MIRROR/cpan"},
+			env:  map[string]string{"CPAN_MIRROR": "https://cpan.example.org"},
+			want: "https://cpan.example.org/cpan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			for _, name := range mirrorEnvVars {
+				t.Setenv(name, tt.env[name])
+			}
+			cmd := newPlanCmd()
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			got := mirrorURL(cmd)
+
+			// Assert
+			if got != tt.want {
+				t.Errorf("mirrorURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCacheDir(t *testing.T) {
+	tests := []struct {
+		name string
+		flag string
+		env  string
+		want string
+	}{
+		{name: "env", env: "/env/cache", want: "/env/cache"},
+		{name: "flag overrides env", flag: "/flag/cache", env: "/env/cache", want: "/flag/cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			t.Setenv(yacm.CacheDirEnv, tt.env)
+			cacheDir = tt.flag
+			defer func() { cacheDir = "" }()
+
+			// Act
+			got, err := resolveCacheDir()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("resolveCacheDir() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveCacheDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvBoolFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     string
+		want    bool
+		wantErr bool
+	}{
+		{name: "default", want: false},
+		{name: "env enables", env: "1", want: true},
+		{name: "env disables", env: "false", want: false},
+		{name: "flag overrides env", args: []string{"--include-recommends=false"}, env: "1", want: false},
+		{name: "flag without env", args: []string{"--include-recommends"}, want: true},
+		{name: "invalid env", env: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			t.Setenv("YACM_WITH_RECOMMENDS", tt.env)
+			var value bool
+			cmd := &cobra.Command{}
+			cmd.Flags().BoolVar(&value, "include-recommends", false, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			got, err := envBoolFlag(cmd, "include-recommends", value)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("envBoolFlag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("envBoolFlag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "10y", want: 10 * 365 * 24 * time.Hour},
+		{input: "180d", want: 180 * 24 * time.Hour},
+		{input: "1.5d", want: 36 * time.Hour},
+		{input: "72h", want: 72 * time.Hour},
+		{input: "ten years", wantErr: true},
+		{input: "-1y", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseAge(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAge(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseAge(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/snapshot"
+)
+
+var planDownload bool
+
+func newPlanCmd() *cobra.Command {
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "List the downloads needed to realize a cpanfile.snapshot",
+		RunE:  runPlan,
+	}
+
+	planCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Input snapshot path")
+	planCmd.Flags().StringVarP(&mirror, "mirror", "m", "https://cpan.metacpan.org", "CPAN mirror URL")
+	planCmd.Flags().IntVarP(&workers, "workers", "w", 5, "Parallel download workers")
+	planCmd.Flags().BoolVar(&planDownload, "download", false, "Fetch the planned tarballs into the cache")
+
+	return planCmd
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+	dists, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	cacheDir, err := resolveCacheDir()
+	if err != nil {
+		return err
+	}
+
+	client, err := newHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	log := newLogger()
+	dl := downloader.NewDownloader(workers, cacheDir)
+	dl.SetLogger(log)
+	dl.SetHTTPClient(client)
+	jobs := dl.PlanJobs(mirrorURL(cmd), dists)
+
+	if !planDownload {
+		for _, job := range jobs {
+			fmt.Fprintln(cmd.OutOrStdout(), job.URL)
+		}
+		return nil
+	}
+
+	return fetchJobs(cmd.OutOrStdout(), dl, jobs, log)
+}
+
+// readSnapshot parses the snapshot file at path.
+func readSnapshot(path string) ([]*dist.Dist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening snapshot: %w", err)
+	}
+	defer file.Close()
+
+	dists, err := snapshot.NewParser(file).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("parsing snapshot: %w", err)
+	}
+	return dists, nil
+}
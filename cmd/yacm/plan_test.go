@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunPlan(t *testing.T) {
+	// Arrange
+	t.Setenv("HOME", t.TempDir())
+	snapshotFile := filepath.Join(t.TempDir(), "cpanfile.snapshot")
+	content := `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  Foo-1.0
+    pathname: A/AU/AUTHOR/Foo-1.0.tar.gz
+    provides:
+      Foo 1.0
+    requirements:
+      strict 0
+`
+	if err := os.WriteFile(snapshotFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newPlanCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--snapshot", snapshotFile, "--mirror", "https://mirror.example.com/"})
+
+	// Act
+	err := cmd.Execute()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := "https://mirror.example.com/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/extractor"
+	"github.com/frederic-klein/yacm/internal/logger"
+	"github.com/frederic-klein/yacm/internal/snapshot"
+)
+
+func newRepairCmd() *cobra.Command {
+	repairCmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Fill in missing requirements sections of a cpanfile.snapshot from the distributions' META",
+		Long: "Re-derive the requirements of every distribution in a cpanfile.snapshot without a requirements\n" +
+			"section, e.g. after hand-editing, from the META of its tarball (cached, or downloaded from --mirror).\n" +
+			"The snapshot is rewritten in place; provides and existing requirements sections are kept as they are.",
+		RunE: runRepair,
+	}
+
+	repairCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Snapshot path to repair")
+	repairCmd.Flags().StringVarP(&mirror, "mirror", "m", "https://cpan.metacpan.org", "CPAN mirror URL for tarballs not in the cache")
+	repairCmd.Flags().IntVarP(&workers, "workers", "w", 5, "Parallel download workers")
+
+	return repairCmd
+}
+
+func runRepair(cmd *cobra.Command, args []string) error {
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("opening snapshot: %w", err)
+	}
+	parser := snapshot.NewParser(file)
+	dists, err := parser.Parse()
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("parsing snapshot: %w", err)
+	}
+
+	cacheDir, err := resolveCacheDir()
+	if err != nil {
+		return err
+	}
+	client, err := newHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	log := newLogger()
+	dl := downloader.NewDownloader(workers, cacheDir)
+	dl.SetLogger(log)
+	dl.SetHTTPClient(client)
+
+	repaired, err := repairRequirements(cmd.OutOrStdout(), dl, mirrorURL(cmd), dists, log)
+	if err != nil {
+		return err
+	}
+	if repaired == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s has no distributions missing requirements\n", snapshotPath)
+		return nil
+	}
+
+	var out bytes.Buffer
+	emitter := snapshot.NewEmitter(&out)
+	emitter.SetPreserveRanges(true)
+	if prov := parser.Provenance(); prov != nil {
+		emitter.SetProvenance(*prov)
+	}
+	if err := emitter.Emit(dists); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := writeSnapshot(cmd, snapshotPath, out.Bytes(), log); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Repaired requirements of %d distributions in %s\n", repaired, snapshotPath)
+	return nil
+}
+
+// repairRequirements sets the requirements of each distribution without
+// any from the static META of its tarball, downloading the tarballs not
+// cached yet, and reports each one changed on w. It returns the number of
+// distributions that gained requirements. A distribution whose META has
+// none is left as it is.
+func repairRequirements(w io.Writer, dl *downloader.Downloader, mirror string, dists []*dist.Dist, log *logger.Logger) (int, error) {
+	var missing []*dist.Dist
+	for _, d := range dists {
+		if len(d.Requirements) == 0 {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	var failed int
+	for _, result := range dl.Download(dl.PlanJobs(mirror, missing)) {
+		if result.Error != nil {
+			log.Errorf("%v", result.Error)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return 0, fmt.Errorf("%d tarballs could not be downloaded; the snapshot was not changed", failed)
+	}
+
+	ext := extractor.NewExtractor("")
+	repaired := 0
+	for _, d := range missing {
+		meta, err := ext.Extract(dl.CachePath(d.Pathname))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", d.Name, err)
+		}
+		if len(meta.Requirements) == 0 {
+			continue
+		}
+		d.Requirements = meta.Requirements
+		fmt.Fprintf(w, "%s: added %d requirements\n", d.Name, len(meta.Requirements))
+		repaired++
+	}
+	return repaired, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunRepair(t *testing.T) {
+	// Arrange: Foo lost its requirements section; Baz keeps its range
+	t.Setenv("HOME", t.TempDir())
+	files := map[string][]byte{
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"1.5"}},"build":{"requires":{"ExtUtils::MakeMaker":"6.30"}}}}`),
+		"/authors/id/A/AU/AUTHOR/Bar-2.0.tar.gz": tarball(t, "Bar-2.0/META.json",
+			`{"name":"Bar","version":"2.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"2.0"}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cpanfile.snapshot")
+	input := `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  Bar-2.0
+    pathname: A/AU/AUTHOR/Bar-2.0.tar.gz
+    provides:
+      Bar 2.0
+  Baz-3.0
+    pathname: A/AU/AUTHOR/Baz-3.0.tar.gz
+    provides:
+      Baz 3.0
+    requirements:
+      Foo >= 1.0, < 2
+  Foo-1.0
+    pathname: A/AU/AUTHOR/Foo-1.0.tar.gz
+    provides:
+      Foo 1.0
+`
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := newRepairCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"-s", path, "--mirror", server.URL})
+
+	// Act
+	err := cmd.Execute()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(input, "      Foo 1.0\n", "      Foo 1.0\n    requirements:\n      Bar 1.5\n      ExtUtils::MakeMaker 6.30\n", 1)
+	if string(got) != want {
+		t.Errorf("repaired snapshot =\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.Contains(out.String(), "Foo-1.0: added 2 requirements\n") {
+		t.Errorf("output does not report Foo-1.0:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "Bar-2.0:") {
+		t.Errorf("output reports Bar-2.0, which has no requirements:\n%s", out.String())
+	}
+}
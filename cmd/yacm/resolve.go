@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func newResolveCmd() *cobra.Command {
+	resolveCmd := &cobra.Command{
+		Use:   "resolve Module::Name [version]",
+		Short: "Resolve a single module and its dependencies without a cpanfile",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  runResolve,
+	}
+
+	resolveCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "-", "Output snapshot path (- for stdout)")
+	resolveCmd.Flags().StringVar(&outputFormat, "format", "carton", "Output format: carton (cpanfile.snapshot) or modules (flat module list)")
+	resolveCmd.Flags().IntVarP(&workers, "workers", "w", 5, "Parallel download workers")
+	resolveCmd.Flags().StringVarP(&mirror, "mirror", "m", "https://cpan.metacpan.org", "CPAN mirror URL")
+	resolveCmd.Flags().StringVar(&backpanDir, "backpan-dir", "./backpan-modules", "BackPAN modules directory")
+	resolveCmd.Flags().BoolVar(&strict, "strict", false, "Fail without writing a snapshot if any warning is logged")
+
+	return resolveCmd
+}
+
+func runResolve(cmd *cobra.Command, args []string) error {
+	req := dist.VersionReq{Module: args[0], Version: "0"}
+	if len(args) == 2 {
+		req.Version = args[1]
+	}
+	return generateSnapshot(cmd, map[dist.Phase][]dist.VersionReq{dist.PhaseRuntime: {req}}, nil, newLogger())
+}
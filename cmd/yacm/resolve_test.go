@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunResolve(t *testing.T) {
+	// Arrange: a mirror where Foo requires Bar
+	t.Setenv("HOME", t.TempDir())
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Bar\t2.0\tA/AU/AUTHOR/Bar-2.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"1.5"}}}}`),
+		"/authors/id/A/AU/AUTHOR/Bar-2.0.tar.gz": tarball(t, "Bar-2.0/META.json",
+			`{"name":"Bar","version":"2.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"2.0"}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	cmd := newResolveCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"Foo", "--mirror", server.URL, "--backpan-dir", t.TempDir()})
+
+	// Act
+	err := cmd.Execute()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	for _, want := range []string{"  Foo-1.0\n", "      Bar 1.5\n", "  Bar-2.0\n", "      Bar 2.0\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("snapshot missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunResolve_MirrorSubpath(t *testing.T) {
+	// Arrange: a mirror serving CPAN under /pub/CPAN
+	t.Setenv("HOME", t.TempDir())
+	files := map[string][]byte{
+		"/pub/CPAN/modules/02packages.details.txt.gz": gzipBytes(t,
+			"File: 02packages.details.txt\n\nFoo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n"),
+		"/pub/CPAN/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`),
+	}
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		data, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	cmd := newResolveCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"Foo", "--mirror", server.URL + "/pub/CPAN/", "--backpan-dir", t.TempDir()})
+
+	// Act
+	err := cmd.Execute()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Execute() error = %v (requested %v)", err, requested)
+	}
+	for _, path := range requested {
+		if _, ok := files[path]; !ok {
+			t.Errorf("unexpected request for %s", path)
+		}
+	}
+	if !strings.Contains(out.String(), "  Foo-1.0\n") {
+		t.Errorf("snapshot missing Foo-1.0:\n%s", out.String())
+	}
+}
+
+func TestRunResolve_StrictConfigureFallback(t *testing.T) {
+	// Arrange: Foo ships a Makefile.PL but configure fails
+	t.Setenv("HOME", t.TempDir())
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "perl"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t,
+			"File: 02packages.details.txt\n\nFoo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n"),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarballFiles(t, map[string]string{
+			"Foo-1.0/META.json":   `{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`,
+			"Foo-1.0/Makefile.PL": "use ExtUtils::MakeMaker; WriteMakefile();",
+		}),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "warning only", args: nil, wantErr: false},
+		{name: "strict", args: []string{"--strict"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newResolveCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetArgs(append([]string{"Foo", "--mirror", server.URL, "--backpan-dir", t.TempDir()}, tt.args...))
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && strings.Contains(out.String(), "DISTRIBUTIONS") {
+				t.Errorf("strict failure still wrote a snapshot:\n%s", out.String())
+			}
+		})
+	}
+}
+
+// mirrorServer serves files by URL path and answers 404 for anything else.
+func mirrorServer(files map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestRunResolve_WithRecommendsEnv(t *testing.T) {
+	tests := []struct {
+		env     string
+		wantBar bool
+	}{
+		{env: "", wantBar: false},
+		{env: "1", wantBar: true},
+	}
+
+	for _, tt := range tests {
+		t.Run("YACM_WITH_RECOMMENDS="+tt.env, func(t *testing.T) {
+			// Arrange: Foo recommends Bar
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("YACM_WITH_RECOMMENDS", tt.env)
+			packages := "File: 02packages.details.txt\n\n" +
+				"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+				"Bar\t2.0\tA/AU/AUTHOR/Bar-2.0.tar.gz\n"
+			files := map[string][]byte{
+				"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+				"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+					`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}},"prereqs":{"runtime":{"recommends":{"Bar":"0"}}}}`),
+				"/authors/id/A/AU/AUTHOR/Bar-2.0.tar.gz": tarball(t, "Bar-2.0/META.json",
+					`{"name":"Bar","version":"2.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"2.0"}}}`),
+			}
+			server := mirrorServer(files)
+			defer server.Close()
+
+			cmd := newResolveCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetArgs([]string{"Foo", "--mirror", server.URL, "--backpan-dir", t.TempDir()})
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := strings.Contains(out.String(), "  Bar-2.0\n"); got != tt.wantBar {
+				t.Errorf("Bar-2.0 in snapshot = %v, want %v:\n%s", got, tt.wantBar, out.String())
+			}
+		})
+	}
+}
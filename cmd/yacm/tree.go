@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm"
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+var treeReasons bool
+
+func newTreeCmd() *cobra.Command {
+	treeCmd := &cobra.Command{
+		Use:   "tree",
+		Short: "Resolve a cpanfile and print the dependency tree",
+		RunE:  runTree,
+	}
+
+	addReportFlags(treeCmd)
+	treeCmd.Flags().BoolVar(&treeReasons, "reasons", false, "Show why each distribution was chosen: the requiring distribution, the constraint and where it came from")
+
+	return treeCmd
+}
+
+// addReportFlags registers the flags of commands that resolve a cpanfile
+// to report on it rather than write a snapshot.
+func addReportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&cpanfilePath, "cpanfile", "f", "./cpanfile", "Input cpanfile path")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 5, "Parallel download workers")
+	cmd.Flags().StringVarP(&mirror, "mirror", "m", "https://cpan.metacpan.org", "CPAN mirror URL")
+	cmd.Flags().StringVar(&backpanDir, "backpan-dir", "./backpan-modules", "BackPAN modules directory")
+	cmd.Flags().StringArrayVar(&phases, "include-phase", yacm.DefaultPhases, "cpanfile phase to resolve (runtime, test, build, configure, develop); repeatable")
+}
+
+// resolveForReport resolves --cpanfile with the flags from addReportFlags,
+// without writing a snapshot.
+func resolveForReport(cmd *cobra.Command) (yacm.Result, error) {
+	cfg, err := reportConfig(cmd)
+	if err != nil {
+		return yacm.Result{}, err
+	}
+	return yacm.Generate(cfg)
+}
+
+// reportConfig returns the generation settings for the flags from
+// addReportFlags.
+func reportConfig(cmd *cobra.Command) (yacm.Config, error) {
+	cache, err := resolveCacheDir()
+	if err != nil {
+		return yacm.Config{}, err
+	}
+	client, err := newHTTPClient()
+	if err != nil {
+		return yacm.Config{}, err
+	}
+
+	return yacm.Config{
+		Cpanfile:   cpanfilePath,
+		Phases:     phases,
+		Mirror:     mirrorURL(cmd),
+		CacheDir:   cache,
+		BackPANDir: backpanDir,
+		Workers:    workers,
+		HTTPClient: client,
+		Log:        newLogger(),
+	}, nil
+}
+
+func runTree(cmd *cobra.Command, args []string) error {
+	result, err := resolveForReport(cmd)
+	if err != nil {
+		return err
+	}
+
+	return printTree(cmd.OutOrStdout(), result.TopLevel, result.Distributions, treeReasons)
+}
+
+// distsByModule maps every provided module to its distribution. When
+// several provide a module, the first in dists wins.
+func distsByModule(dists []*dist.Dist) map[string]*dist.Dist {
+	byModule := make(map[string]*dist.Dist)
+	for _, d := range dists {
+		for mod := range d.Provides {
+			if _, ok := byModule[mod]; !ok {
+				byModule[mod] = d
+			}
+		}
+	}
+	return byModule
+}
+
+// printTree writes the prerequisites of each top-level module as an
+// indented tree. A distribution is expanded once; later occurrences are
+// marked "(see above)". Modules without a distribution, such as core
+// modules, are left out.
+func printTree(w io.Writer, topLevel []string, dists []*dist.Dist, reasons bool) error {
+	byModule := distsByModule(dists)
+	expanded := make(map[string]bool)
+	var walk func(module string, depth int) error
+	walk = func(module string, depth int) error {
+		d, ok := byModule[module]
+		if !ok {
+			return nil
+		}
+		line := fmt.Sprintf("%s%s (%s)", strings.Repeat("  ", depth), module, d.Name)
+		if expanded[d.Name] {
+			line += " (see above)"
+		} else if reasons && d.Reason != "" {
+			line += " - " + d.Reason
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if expanded[d.Name] {
+			return nil
+		}
+		expanded[d.Name] = true
+
+		deps := make([]string, 0, len(d.Requirements))
+		for mod := range d.Requirements {
+			deps = append(deps, mod)
+		}
+		sort.Strings(deps)
+		for _, mod := range deps {
+			if err := walk(mod, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, module := range topLevel {
+		if err := walk(module, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
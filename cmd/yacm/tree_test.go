@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunTree(t *testing.T) {
+	// Arrange: a mirror where Foo and Baz both require Bar
+	t.Setenv("HOME", t.TempDir())
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Bar\t2.0\tA/AU/AUTHOR/Bar-2.0.tar.gz\n" +
+		"Baz\t1.0\tA/AU/AUTHOR/Baz-1.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"1.5","strict":"0"}}}}`),
+		"/authors/id/A/AU/AUTHOR/Bar-2.0.tar.gz": tarball(t, "Bar-2.0/META.json",
+			`{"name":"Bar","version":"2.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"2.0"}}}`),
+		"/authors/id/A/AU/AUTHOR/Baz-1.0.tar.gz": tarball(t, "Baz-1.0/META.json",
+			`{"name":"Baz","version":"1.0","provides":{"Baz":{"file":"lib/Baz.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"0"}}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	cpanfile := filepath.Join(t.TempDir(), "cpanfile")
+	if err := os.WriteFile(cpanfile, []byte("requires 'Foo';\nrequires 'Baz';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		reasons bool
+		want    string
+	}{
+		{
+			name: "plain",
+			want: "Baz (Baz-1.0)\n  Bar (Bar-2.0)\nFoo (Foo-1.0)\n  Bar (Bar-2.0) (see above)\n",
+		},
+		{
+			name:    "with reasons",
+			reasons: true,
+			want: "Baz (Baz-1.0) - Baz (any version) requested directly; from CPAN index\n" +
+				"  Bar (Bar-2.0) - Bar 1.5 required by Foo-1.0; from CPAN index\n" +
+				"Foo (Foo-1.0) - Foo (any version) requested directly; from CPAN index\n" +
+				"  Bar (Bar-2.0) (see above)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newTreeCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			args := []string{"-f", cpanfile, "--mirror", server.URL, "--backpan-dir", t.TempDir()}
+			if tt.reasons {
+				args = append(args, "--reasons")
+			}
+			cmd.SetArgs(args)
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output =\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm"
+	"github.com/frederic-klein/yacm/internal/downloader"
+)
+
+var metacpanURL string
+
+func newURLsCmd() *cobra.Command {
+	urlsCmd := &cobra.Command{
+		Use:   "urls",
+		Short: "Resolve a cpanfile from MetaCPAN metadata and print every tarball URL it needs",
+		Long: "Resolve a cpanfile like --meta-api does, taking prerequisites from MetaCPAN instead of downloading\n" +
+			"tarballs where possible, and print the download URL of every distribution, e.g. for security review\n" +
+			"or to pre-seed a mirror. Distributions with dynamic prerequisites are listed on standard error, as\n" +
+			"only running their configure script would show everything they need.",
+		RunE: runURLs,
+	}
+
+	addReportFlags(urlsCmd)
+	urlsCmd.Flags().StringVar(&metacpanURL, "metacpan-url", "", "MetaCPAN API URL (default: the public instance)")
+
+	return urlsCmd
+}
+
+func runURLs(cmd *cobra.Command, args []string) error {
+	cfg, err := reportConfig(cmd)
+	if err != nil {
+		return err
+	}
+	cfg.MetaAPI = true
+	cfg.MetaCPAN = metacpanURL
+	result, err := yacm.Generate(cfg)
+	if err != nil {
+		return err
+	}
+
+	var unconfigured []string
+	out := cmd.OutOrStdout()
+	for _, d := range result.Distributions {
+		if _, err := fmt.Fprintln(out, downloader.TarballURL(cfg.Mirror, d.Pathname)); err != nil {
+			return err
+		}
+		if d.ConfigureSkipped {
+			unconfigured = append(unconfigured, d.Name)
+		}
+	}
+	if len(unconfigured) > 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Note: the list is approximate: %s may have dynamic prerequisites that only configure reveals\n", strings.Join(unconfigured, ", "))
+	}
+	return nil
+}
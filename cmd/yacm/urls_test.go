@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		dynamic  string
+		wantNote string
+	}{
+		{name: "static", dynamic: "0"},
+		{name: "dynamic prerequisites", dynamic: "1", wantNote: "Note: the list is approximate: Foo-1.0 may have dynamic prerequisites"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: a mirror and MetaCPAN where Foo requires Bar; no
+			// tarballs are served
+			t.Setenv("HOME", t.TempDir())
+			packages := "File: 02packages.details.txt\n\n" +
+				"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+				"Bar\t2.0\tB/BO/BOB/Bar-2.0.tar.gz\n"
+			files := map[string][]byte{
+				"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+				"/v1/release/AUTHOR/Foo-1.0": []byte(`{"name":"Foo-1.0","distribution":"Foo","version":"1.0","provides":["Foo"],` +
+					`"dependency":[{"module":"Bar","version":"1.5","phase":"runtime","relationship":"requires"}],` +
+					`"metadata":{"dynamic_config":` + tt.dynamic + `}}`),
+				"/v1/release/BOB/Bar-2.0": []byte(`{"name":"Bar-2.0","distribution":"Bar","version":"2.0","provides":["Bar"],"metadata":{"dynamic_config":0}}`),
+			}
+			var mu sync.Mutex
+			var tarballs []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.URL.Path, "/authors/") {
+					mu.Lock()
+					tarballs = append(tarballs, r.URL.Path)
+					mu.Unlock()
+				}
+				data, ok := files[r.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write(data)
+			}))
+			defer server.Close()
+
+			cpanfile := filepath.Join(t.TempDir(), "cpanfile")
+			if err := os.WriteFile(cpanfile, []byte("requires 'Foo';\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := newURLsCmd()
+			var out, errOut bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&errOut)
+			cmd.SetArgs([]string{"-f", cpanfile, "--mirror", server.URL, "--metacpan-url", server.URL, "--backpan-dir", t.TempDir()})
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			want := server.URL + "/authors/id/B/BO/BOB/Bar-2.0.tar.gz\n" +
+				server.URL + "/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz\n"
+			if out.String() != want {
+				t.Errorf("output = %q, want %q", out.String(), want)
+			}
+			if len(tarballs) > 0 {
+				t.Errorf("downloaded %v, want no tarball downloads", tarballs)
+			}
+			if tt.wantNote == "" && errOut.Len() > 0 {
+				t.Errorf("unexpected note: %s", errOut.String())
+			}
+			if !strings.Contains(errOut.String(), tt.wantNote) {
+				t.Errorf("stderr = %q, want containing %q", errOut.String(), tt.wantNote)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/extractor"
+)
+
+func newVerifyCacheCmd() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify-cache",
+		Short: "Check the cached tarballs of a cpanfile.snapshot for missing or corrupt files",
+		RunE:  runVerifyCache,
+	}
+
+	verifyCmd.Flags().StringVarP(&snapshotPath, "snapshot", "s", "./cpanfile.snapshot", "Input snapshot path")
+
+	return verifyCmd
+}
+
+func runVerifyCache(cmd *cobra.Command, args []string) error {
+	dists, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	cacheDir, err := resolveCacheDir()
+	if err != nil {
+		return err
+	}
+
+	dl := downloader.NewDownloader(1, cacheDir)
+	problems := verifyCache(cmd.OutOrStdout(), dl, dists)
+	if problems > 0 {
+		return fmt.Errorf("%d of %d cached tarballs missing or corrupt", problems, len(dists))
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "All %d cached tarballs verified\n", len(dists))
+	return nil
+}
+
+// verifyCache checks that the cached tarball of every distribution exists,
+// is a readable archive and, when a CHECKSUMS file sits next to it, matches
+// the recorded size and digest. Each problem is reported on w; the number
+// of problems is returned.
+func verifyCache(w io.Writer, dl *downloader.Downloader, dists []*dist.Dist) int {
+	checksums := make(map[string]map[string]downloader.Checksum) // by directory
+	problems := 0
+	for _, job := range dl.PlanJobs("", dists) {
+		if _, err := os.Stat(job.DestPath); err != nil {
+			fmt.Fprintf(w, "MISSING %s\n", job.DestPath)
+			problems++
+			continue
+		}
+
+		dir := filepath.Dir(job.DestPath)
+		sums, ok := checksums[dir]
+		if !ok {
+			sums, _ = downloader.LoadChecksums(filepath.Join(dir, "CHECKSUMS"))
+			checksums[dir] = sums
+		}
+		if sum, ok := sums[filepath.Base(job.DestPath)]; ok {
+			job.SHA256 = sum.SHA256
+			job.Size = sum.Size
+		}
+
+		err := downloader.Verify(job)
+		if err == nil {
+			err = extractor.VerifyTarball(job.DestPath)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "CORRUPT %s: %v\n", job.DestPath, err)
+			problems++
+		}
+	}
+	return problems
+}
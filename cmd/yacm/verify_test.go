@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/downloader"
+)
+
+func TestVerifyCache(t *testing.T) {
+	// Arrange: a good tarball listed in CHECKSUMS, a corrupt one and a missing one
+	cacheDir := t.TempDir()
+	authorDir := filepath.Join(cacheDir, "A", "AU", "AUTHOR")
+	if err := os.MkdirAll(authorDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	good := tarball(t, "Good-1.0/META.json", `{"name":"Good"}`)
+	if err := os.WriteFile(filepath.Join(authorDir, "Good-1.0.tar.gz"), good, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(authorDir, "Corrupt-1.0.tar.gz"), good[:len(good)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksums := fmt.Sprintf("$cksum = {\n  'Good-1.0.tar.gz' => {\n    'sha256' => '%x',\n    'size' => %d\n  },\n};\n", sha256.Sum256(good), len(good))
+	if err := os.WriteFile(filepath.Join(authorDir, "CHECKSUMS"), []byte(checksums), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dists := []*dist.Dist{
+		{Name: "Good-1.0", Pathname: "A/AU/AUTHOR/Good-1.0.tar.gz"},
+		{Name: "Corrupt-1.0", Pathname: "A/AU/AUTHOR/Corrupt-1.0.tar.gz"},
+		{Name: "Missing-1.0", Pathname: "A/AU/AUTHOR/Missing-1.0.tar.gz"},
+	}
+	var out bytes.Buffer
+
+	// Act
+	problems := verifyCache(&out, downloader.NewDownloader(1, cacheDir), dists)
+
+	// Assert
+	if problems != 2 {
+		t.Errorf("problems = %d, want 2", problems)
+	}
+	report := out.String()
+	if !strings.Contains(report, "CORRUPT "+filepath.Join(authorDir, "Corrupt-1.0.tar.gz")) {
+		t.Errorf("report does not flag the corrupt tarball:\n%s", report)
+	}
+	if !strings.Contains(report, "MISSING "+filepath.Join(authorDir, "Missing-1.0.tar.gz")) {
+		t.Errorf("report does not flag the missing tarball:\n%s", report)
+	}
+	if strings.Contains(report, "Good-1.0") {
+		t.Errorf("report flags the good tarball:\n%s", report)
+	}
+}
+
+func TestVerifyCache_ChecksumMismatch(t *testing.T) {
+	// Arrange: a readable tarball whose CHECKSUMS digest does not match
+	cacheDir := t.TempDir()
+	authorDir := filepath.Join(cacheDir, "A", "AU", "AUTHOR")
+	if err := os.MkdirAll(authorDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := tarball(t, "Foo-1.0/META.json", `{"name":"Foo"}`)
+	if err := os.WriteFile(filepath.Join(authorDir, "Foo-1.0.tar.gz"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksums := "$cksum = {\n  'Foo-1.0.tar.gz' => {\n    'sha256' => '" + strings.Repeat("0", 64) + "'\n  },\n};\n"
+	if err := os.WriteFile(filepath.Join(authorDir, "CHECKSUMS"), []byte(checksums), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+
+	// Act
+	problems := verifyCache(&out, downloader.NewDownloader(1, cacheDir), []*dist.Dist{
+		{Name: "Foo-1.0", Pathname: "A/AU/AUTHOR/Foo-1.0.tar.gz"},
+	})
+
+	// Assert
+	if problems != 1 || !strings.Contains(out.String(), "sha256") {
+		t.Errorf("problems = %d, report = %q, want checksum mismatch", problems, out.String())
+	}
+}
+
+// tarball returns a gzip-compressed tar archive holding one file.
+func tarball(t *testing.T, name, content string) []byte {
+	t.Helper()
+	return tarballFiles(t, map[string]string{name: content})
+}
+
+func tarballFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
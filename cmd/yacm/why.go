@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func newWhyCmd() *cobra.Command {
+	whyCmd := &cobra.Command{
+		Use:   "why Module::Name",
+		Short: "Resolve a cpanfile and explain which requirements pull in a module",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runWhy,
+	}
+
+	addReportFlags(whyCmd)
+
+	return whyCmd
+}
+
+func runWhy(cmd *cobra.Command, args []string) error {
+	module := args[0]
+	result, err := resolveForReport(cmd)
+	if err != nil {
+		return err
+	}
+
+	path := requirementPath(result.TopLevel, result.Distributions, module)
+	if path == nil {
+		return fmt.Errorf("%s is not among the resolved dependencies", module)
+	}
+
+	out := cmd.OutOrStdout()
+	if len(path) == 1 {
+		_, err = fmt.Fprintf(out, "%s is required directly\n", module)
+		return err
+	}
+	_, err = fmt.Fprintln(out, strings.Join(path, " -> "))
+	return err
+}
+
+// requirementPath returns the shortest chain of modules from a top-level
+// requirement to target, following the requirements of each module's
+// distribution, or nil if target is not reachable. Ties are broken by
+// module name, so the result is deterministic.
+func requirementPath(topLevel []string, dists []*dist.Dist, target string) []string {
+	byModule := distsByModule(dists)
+	parent := make(map[string]string)
+	seen := make(map[string]bool)
+
+	var queue []string
+	for _, mod := range topLevel {
+		if !seen[mod] {
+			seen[mod] = true
+			queue = append(queue, mod)
+		}
+	}
+
+	for len(queue) > 0 {
+		mod := queue[0]
+		queue = queue[1:]
+		if mod == target {
+			path := []string{mod}
+			for p, ok := parent[mod]; ok; p, ok = parent[p] {
+				path = append([]string{p}, path...)
+			}
+			return path
+		}
+
+		d, ok := byModule[mod]
+		if !ok {
+			continue
+		}
+		deps := make([]string, 0, len(d.Requirements))
+		for dep := range d.Requirements {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if !seen[dep] {
+				seen[dep] = true
+				parent[dep] = mod
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return nil
+}
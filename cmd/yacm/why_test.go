@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunWhy(t *testing.T) {
+	// Arrange: a mirror with the chain Foo -> Bar -> Baz
+	t.Setenv("HOME", t.TempDir())
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Bar\t1.0\tA/AU/AUTHOR/Bar-1.0.tar.gz\n" +
+		"Baz\t1.0\tA/AU/AUTHOR/Baz-1.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"0"}}}}`),
+		"/authors/id/A/AU/AUTHOR/Bar-1.0.tar.gz": tarball(t, "Bar-1.0/META.json",
+			`{"name":"Bar","version":"1.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Baz":"0"}}}}`),
+		"/authors/id/A/AU/AUTHOR/Baz-1.0.tar.gz": tarball(t, "Baz-1.0/META.json",
+			`{"name":"Baz","version":"1.0","provides":{"Baz":{"file":"lib/Baz.pm","version":"1.0"}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	cpanfile := filepath.Join(t.TempDir(), "cpanfile")
+	if err := os.WriteFile(cpanfile, []byte("requires 'Foo';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		module  string
+		want    string
+		wantErr string
+	}{
+		{module: "Baz", want: "Foo -> Bar -> Baz\n"},
+		{module: "Foo", want: "Foo is required directly\n"},
+		{module: "Qux", wantErr: "Qux is not among the resolved dependencies"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			cmd := newWhyCmd()
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs([]string{tt.module, "-f", cpanfile, "--mirror", server.URL, "--backpan-dir", t.TempDir()})
+
+			// Act
+			err := cmd.Execute()
+
+			// Assert
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
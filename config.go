@@ -0,0 +1,68 @@
+package yacm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile holds settings too structured for command-line flags, read
+// from a YAML file such as:
+//
+//	configure:
+//	  Net-SSLeay:
+//	    args: [--no-test]
+//	    env:
+//	      OPENSSL_PREFIX: /opt/openssl
+//	indexes:
+//	  https://darkpan.example.com:
+//	    cache_ttl: 1h
+type ConfigFile struct {
+	// Configure overrides the configure run per distribution name, with
+	// or without version. See Config.ConfigureOverrides.
+	Configure map[string]ConfigureOverride `yaml:"configure"`
+	// Indexes holds settings per index URL, the mirror's or an extra
+	// index's.
+	Indexes map[string]IndexSettings `yaml:"indexes"`
+}
+
+// IndexSettings configures one index source.
+type IndexSettings struct {
+	// CacheTTL is how long the cached index is used before it is
+	// downloaded again, e.g. "1h"; zero means 24 hours.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// IndexCacheTTLs returns the CacheTTL of each index that sets one, for
+// Config.IndexCacheTTLs.
+func (cf *ConfigFile) IndexCacheTTLs() map[string]time.Duration {
+	ttls := make(map[string]time.Duration)
+	for url, settings := range cf.Indexes {
+		if settings.CacheTTL > 0 {
+			ttls[url] = settings.CacheTTL
+		}
+	}
+	return ttls
+}
+
+// ReadConfigFile reads a YAML config file. Unknown keys are an error, so
+// that typos do not go unnoticed.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	var cf ConfigFile
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cf); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return &cf, nil
+}
@@ -0,0 +1,67 @@
+package yacm
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantArgs []string
+		wantEnv  string
+		wantTTL  time.Duration
+		wantErr  bool
+	}{
+		{
+			name: "configure override",
+			content: `configure:
+  Net-SSLeay:
+    args: [--no-test]
+    env:
+      OPENSSL_PREFIX: /opt/openssl
+`,
+			wantArgs: []string{"--no-test"},
+			wantEnv:  "/opt/openssl",
+		},
+		{
+			name:    "index cache TTL",
+			content: "indexes:\n  https://darkpan.example.com/:\n    cache_ttl: 90m\n",
+			wantTTL: 90 * time.Minute,
+		},
+		{name: "empty file", content: ""},
+		{name: "unknown key", content: "configur:\n  Net-SSLeay: {}\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "yacm.yml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			cf, err := ReadConfigFile(path)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			o := cf.Configure["Net-SSLeay"]
+			if !slices.Equal(o.Args, tt.wantArgs) || o.Env["OPENSSL_PREFIX"] != tt.wantEnv {
+				t.Errorf("Configure[Net-SSLeay] = %+v, want args %q and OPENSSL_PREFIX %q", o, tt.wantArgs, tt.wantEnv)
+			}
+			if ttl := cf.IndexCacheTTLs()["https://darkpan.example.com/"]; ttl != tt.wantTTL {
+				t.Errorf("IndexCacheTTLs() = %v, want %v for the DarkPAN", cf.IndexCacheTTLs(), tt.wantTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package yacm
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/index"
+	"github.com/frederic-klein/yacm/internal/logger"
+)
+
+// mergeIndexes loads every cfg.ExtraIndexes entry and merges them with
+// cpanIdx: the highest version of a module wins, and on equal versions the
+// index listed first in cfg.IndexPriority. The merged index keeps cpanIdx's
+// mirror, which pinned dists and entries without a mirror are fetched from,
+// whatever the priority. Without extra indexes cpanIdx is returned as is.
+func mergeIndexes(cfg *Config, cpanIdx *index.CPANIndex, log *logger.Logger) (*index.CPANIndex, error) {
+	if len(cfg.ExtraIndexes) == 0 {
+		return cpanIdx, nil
+	}
+
+	indexes := map[string]*index.CPANIndex{cpanIdx.Mirror(): cpanIdx}
+	urls := []string{cpanIdx.Mirror()}
+	for _, url := range cfg.ExtraIndexes {
+		url = strings.TrimSuffix(url, "/")
+		if indexes[url] != nil {
+			continue
+		}
+		log.Infof("Loading extra index from %s", url)
+		idx := index.NewCPANIndex(url, filepath.Join(cfg.CacheDir, "indexes", indexCacheKey(url)))
+		idx.SetLogger(log)
+		idx.SetHTTPClient(cfg.HTTPClient)
+		idx.SetRefresh(cfg.RefreshIndex)
+		idx.SetCacheTTL(cfg.indexCacheTTL(url))
+		if err := idx.Load(cfg.Context); err != nil {
+			return nil, cfg.failed("loading index "+url, err)
+		}
+		indexes[url] = idx
+		urls = append(urls, url)
+	}
+
+	ordered, err := priorityOrder(urls, cfg.IndexPriority)
+	if err != nil {
+		return nil, err
+	}
+	merged := index.NewCPANIndex(cpanIdx.Mirror(), cfg.CacheDir)
+	merged.SetLogger(log)
+	for _, url := range ordered {
+		merged.Merge(indexes[url])
+	}
+	return merged, nil
+}
+
+// indexCacheTTL returns the cache TTL configured for the index at url in
+// cfg.IndexCacheTTLs, ignoring trailing slashes, or zero for the default.
+func (cfg *Config) indexCacheTTL(url string) time.Duration {
+	url = strings.TrimRight(url, "/")
+	for key, ttl := range cfg.IndexCacheTTLs {
+		if strings.TrimRight(key, "/") == url {
+			return ttl
+		}
+	}
+	return 0
+}
+
+// priorityOrder sorts index URLs by priority: URLs named in priority come
+// first, in that order, followed by the rest in their original order.
+func priorityOrder(urls, priority []string) ([]string, error) {
+	known := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		known[url] = true
+	}
+
+	ordered := make([]string, 0, len(urls))
+	placed := make(map[string]bool, len(urls))
+	for _, url := range priority {
+		url = strings.TrimSuffix(url, "/")
+		if !known[url] {
+			return nil, fmt.Errorf("index priority: %s is neither the mirror nor an extra index", url)
+		}
+		if !placed[url] {
+			placed[url] = true
+			ordered = append(ordered, url)
+		}
+	}
+	for _, url := range urls {
+		if !placed[url] {
+			ordered = append(ordered, url)
+		}
+	}
+	return ordered, nil
+}
+
+var unsafeCacheChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// indexCacheKey turns an index URL into a directory name for its cache.
+func indexCacheKey(url string) string {
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+	return unsafeCacheChars.ReplaceAllString(url, "_")
+}
@@ -0,0 +1,144 @@
+package yacm
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestGenerate_IndexPriority(t *testing.T) {
+	// Arrange: CPAN and a DarkPAN both list Foo 1.0; Bar is pinned and only
+	// on CPAN
+	cpan := mirrorServer(map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t,
+			"File: 02packages.details.txt\n\nFoo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n"),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`),
+		"/authors/id/A/AU/AUTHOR/Bar-1.0.tar.gz": tarball(t, "Bar-1.0/META.json",
+			`{"name":"Bar","version":"1.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"1.0"}}}`),
+	})
+	defer cpan.Close()
+	darkpan := mirrorServer(map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t,
+			"File: 02packages.details.txt\n\nFoo\t1.0\tD/DA/DARKPAN/Foo-1.0.tar.gz\n"),
+		"/authors/id/D/DA/DARKPAN/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`),
+	})
+	defer darkpan.Close()
+
+	tests := []struct {
+		name     string
+		priority []string
+		wantFoo  string
+	}{
+		{name: "mirror first", wantFoo: "A/AU/AUTHOR/Foo-1.0.tar.gz"},
+		{name: "extra index first", priority: []string{darkpan.URL, cpan.URL}, wantFoo: "D/DA/DARKPAN/Foo-1.0.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			cfg := Config{
+				Requirements:  map[Phase][]Requirement{dist.PhaseRuntime: {{Module: "Foo"}, {Module: "Bar"}}},
+				Mirror:        cpan.URL,
+				ExtraIndexes:  []string{darkpan.URL},
+				IndexPriority: tt.priority,
+				PinnedDists:   []string{"A/AU/AUTHOR/Bar-1.0.tar.gz"},
+				CacheDir:      t.TempDir(),
+				BackPANDir:    t.TempDir(),
+				Output:        io.Discard,
+			}
+
+			// Act
+			result, err := Generate(cfg)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			got := make(map[string]string)
+			for _, d := range result.Distributions {
+				got[d.Name] = d.Pathname
+			}
+			want := map[string]string{"Foo-1.0": tt.wantFoo, "Bar-1.0": "A/AU/AUTHOR/Bar-1.0.tar.gz"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("pathnames = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	urls := []string{"https://cpan.example.org", "https://darkpan.example.org", "https://pinto.example.org"}
+
+	tests := []struct {
+		name     string
+		priority []string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "default order",
+			want: urls,
+		},
+		{
+			name:     "darkpan first",
+			priority: []string{"https://darkpan.example.org/"},
+			want:     []string{"https://darkpan.example.org", "https://cpan.example.org", "https://pinto.example.org"},
+		},
+		{
+			name:     "full ordering",
+			priority: []string{"https://pinto.example.org", "https://darkpan.example.org", "https://cpan.example.org"},
+			want:     []string{"https://pinto.example.org", "https://darkpan.example.org", "https://cpan.example.org"},
+		},
+		{
+			name:     "unknown index",
+			priority: []string{"https://other.example.org"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := priorityOrder(urls, tt.priority)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("priorityOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("priorityOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexCacheKey(t *testing.T) {
+	got := indexCacheKey("https://darkpan.example.org:8080/cpan")
+	want := "darkpan.example.org_8080_cpan"
+	if got != want {
+		t.Errorf("indexCacheKey() = %q, want %q", got, want)
+	}
+}
+
+func TestConfig_IndexCacheTTL(t *testing.T) {
+	cfg := &Config{IndexCacheTTLs: map[string]time.Duration{"https://darkpan.example.org/": time.Hour}}
+
+	tests := []struct {
+		url  string
+		want time.Duration
+	}{
+		{"https://darkpan.example.org", time.Hour},
+		{"https://darkpan.example.org/", time.Hour},
+		{"https://cpan.example.org", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := cfg.indexCacheTTL(tt.url); got != tt.want {
+				t.Errorf("indexCacheTTL(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
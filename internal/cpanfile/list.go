@@ -0,0 +1,101 @@
+package cpanfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+var moduleNameRe = regexp.MustCompile(`^[A-Za-z_]\w*(?:::\w+)*$`)
+
+// listEntry is one "Module::Name version" line of a plain list file.
+type listEntry struct {
+	line    int
+	module  string
+	version string // empty if the line has none
+}
+
+// readList reads a plain list file, skipping blank lines and lines
+// starting with #.
+func readList(path string) ([]listEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []listEntry
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		module, version := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			module, version = line[:i], strings.TrimSpace(line[i:])
+		}
+		if !moduleNameRe.MatchString(module) {
+			return nil, fmt.Errorf("%s:%d: invalid module name %q", path, lineNo, module)
+		}
+		entries = append(entries, listEntry{line: lineNo, module: module, version: version})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// ParseList reads a plain list of requirements, one "Module::Name version"
+// per line, e.g. "JSON 4.0" or "Moo >= 2.0, < 3". The version is optional
+// and defaults to any. Blank lines and lines starting with # are skipped.
+// All requirements are runtime requirements.
+func ParseList(path string) (*ParseResult, error) {
+	entries, err := readList(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewParseResult()
+	for _, e := range entries {
+		version := e.version
+		if version == "" {
+			version = "0"
+		}
+		result.Requirements[dist.PhaseRuntime] = append(result.Requirements[dist.PhaseRuntime], dist.VersionReq{
+			Module:  e.module,
+			Version: version,
+		})
+	}
+	return result, nil
+}
+
+// ParseConstraints reads a constraints file in the ParseList format and
+// returns the version constraint of each module. Every line needs a
+// version; a module listed more than once gets its constraints combined.
+func ParseConstraints(path string) (map[string]string, error) {
+	entries, err := readList(path)
+	if err != nil {
+		return nil, err
+	}
+
+	constraints := make(map[string]string, len(entries))
+	for _, e := range entries {
+		if e.version == "" {
+			return nil, fmt.Errorf("%s:%d: no version constraint for %s", path, e.line, e.module)
+		}
+		if have, ok := constraints[e.module]; ok {
+			constraints[e.module] = have + ", " + e.version
+			continue
+		}
+		constraints[e.module] = e.version
+	}
+	return constraints, nil
+}
@@ -0,0 +1,117 @@
+package cpanfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []dist.VersionReq
+		wantErr string
+	}{
+		{
+			name: "with and without versions",
+			content: `# deployment modules
+JSON 4.0
+Moo
+
+Role::Tiny	>= 2.0, < 3.0
+  Try::Tiny   0.31
+`,
+			want: []dist.VersionReq{
+				{Module: "JSON", Version: "4.0"},
+				{Module: "Moo", Version: "0"},
+				{Module: "Role::Tiny", Version: ">= 2.0, < 3.0"},
+				{Module: "Try::Tiny", Version: "0.31"},
+			},
+		},
+		{
+			name:    "invalid module name",
+			content: "JSON 4.0\nlib/Foo.pm\n",
+			wantErr: `:2: invalid module name "lib/Foo.pm"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "modules.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			result, err := ParseList(path)
+
+			// Assert
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseList() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseList() error = %v", err)
+			}
+			want := map[dist.Phase][]dist.VersionReq{dist.PhaseRuntime: tt.want}
+			if !reflect.DeepEqual(result.Requirements, want) {
+				t.Errorf("Requirements = %+v, want %+v", result.Requirements, want)
+			}
+		})
+	}
+}
+
+func TestParseConstraints(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "constraints",
+			content: "# keep the 1.x API\nFoo < 2\nBar >= 1.5\nFoo != 1.3\n",
+			want:    map[string]string{"Foo": "< 2, != 1.3", "Bar": ">= 1.5"},
+		},
+		{
+			name:    "missing version",
+			content: "Foo < 2\nBar\n",
+			wantErr: ":2: no version constraint for Bar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "constraints.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			got, err := ParseConstraints(path)
+
+			// Assert
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseConstraints() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConstraints() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseConstraints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
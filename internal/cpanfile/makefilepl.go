@@ -0,0 +1,114 @@
+package cpanfile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// makefilePLKeys maps ExtUtils::MakeMaker prerequisite arguments to phases.
+var makefilePLKeys = []struct {
+	key   string
+	phase dist.Phase
+}{
+	{"CONFIGURE_REQUIRES", dist.PhaseConfigure},
+	{"BUILD_REQUIRES", dist.PhaseBuild},
+	{"TEST_REQUIRES", dist.PhaseTest},
+	{"PREREQ_PM", dist.PhaseRuntime},
+}
+
+// buildPLKeys maps Module::Build prerequisite arguments to phases.
+var buildPLKeys = []struct {
+	key   string
+	phase dist.Phase
+}{
+	{"configure_requires", dist.PhaseConfigure},
+	{"build_requires", dist.PhaseBuild},
+	{"test_requires", dist.PhaseTest},
+	{"requires", dist.PhaseRuntime},
+}
+
+var (
+	commentRe = regexp.MustCompile(`(?m)#.*$`)
+	prereqRe  = regexp.MustCompile(`['"]?([A-Za-z_][\w:]*)['"]?\s*(?:=>|,)\s*(?:['"]([^'"]*)['"]|(v?\d[\d._]*))`)
+)
+
+// ParseMakefilePL extracts the PREREQ_PM, BUILD_REQUIRES, TEST_REQUIRES and
+// CONFIGURE_REQUIRES hashes of a Makefile.PL. The file is parsed statically,
+// never run, so prerequisites computed at runtime are missed.
+func ParseMakefilePL(path string) (*ParseResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening Makefile.PL: %w", err)
+	}
+
+	result := NewParseResult()
+	src := commentRe.ReplaceAllString(string(data), "")
+	for _, k := range makefilePLKeys {
+		parseHash(result, src, k.key, k.phase)
+	}
+	return result, nil
+}
+
+// ParseBuildPL extracts the requires, build_requires, test_requires and
+// configure_requires hashes of a Build.PL, with the same limits as
+// ParseMakefilePL.
+func ParseBuildPL(path string) (*ParseResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening Build.PL: %w", err)
+	}
+
+	result := NewParseResult()
+	src := commentRe.ReplaceAllString(string(data), "")
+	for _, k := range buildPLKeys {
+		parseHash(result, src, k.key, k.phase)
+	}
+	return result, nil
+}
+
+// parseHash adds the module => version pairs of every `key => { ... }`
+// hash in src to result under phase.
+func parseHash(result *ParseResult, src, key string, phase dist.Phase) {
+	keyRe := regexp.MustCompile(`(?:^|[^\w])['"]?` + key + `['"]?\s*=>\s*\{`)
+	for _, loc := range keyRe.FindAllStringIndex(src, -1) {
+		body := src[loc[1]:]
+		if end := matchingBrace(body); end >= 0 {
+			body = body[:end]
+		}
+		for _, m := range prereqRe.FindAllStringSubmatch(body, -1) {
+			version := m[2]
+			if version == "" {
+				version = m[3]
+			}
+			if strings.TrimSpace(version) == "" {
+				version = "0"
+			}
+			result.Requirements[phase] = append(result.Requirements[phase], dist.VersionReq{
+				Module:  m[1],
+				Version: version,
+			})
+		}
+	}
+}
+
+// matchingBrace returns the index of the "}" closing a hash whose opening
+// brace precedes s, or -1 if it is never closed.
+func matchingBrace(s string) int {
+	depth := 1
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
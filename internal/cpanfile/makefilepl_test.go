@@ -0,0 +1,103 @@
+package cpanfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestParseMakefilePL(t *testing.T) {
+	// Arrange
+	content := `use strict;
+use ExtUtils::MakeMaker;
+
+WriteMakefile(
+    NAME         => 'My::App',
+    VERSION_FROM => 'lib/My/App.pm',
+    CONFIGURE_REQUIRES => {
+        'ExtUtils::MakeMaker' => '6.64',
+    },
+    BUILD_REQUIRES => { 'File::ShareDir::Install' => 0 },
+    TEST_REQUIRES => {
+        'Test::More'      => '0.98',
+        'Test::Deep'      => 0,   # for cmp_deeply
+    },
+    PREREQ_PM => {
+        'JSON'            => '2.0',
+        "Moo"             => 2.000002,
+        'Role::Tiny',        '>= 2.0, < 3.0',
+        # 'Commented::Out' => 0,
+    },
+);
+`
+	path := filepath.Join(t.TempDir(), "Makefile.PL")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	result, err := ParseMakefilePL(path)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("ParseMakefilePL() error = %v", err)
+	}
+	want := map[dist.Phase][]dist.VersionReq{
+		dist.PhaseConfigure: {{Module: "ExtUtils::MakeMaker", Version: "6.64"}},
+		dist.PhaseBuild:     {{Module: "File::ShareDir::Install", Version: "0"}},
+		dist.PhaseTest: {
+			{Module: "Test::More", Version: "0.98"},
+			{Module: "Test::Deep", Version: "0"},
+		},
+		dist.PhaseRuntime: {
+			{Module: "JSON", Version: "2.0"},
+			{Module: "Moo", Version: "2.000002"},
+			{Module: "Role::Tiny", Version: ">= 2.0, < 3.0"},
+		},
+	}
+	if !reflect.DeepEqual(result.Requirements, want) {
+		t.Errorf("Requirements = %+v, want %+v", result.Requirements, want)
+	}
+}
+
+func TestParseBuildPL(t *testing.T) {
+	// Arrange
+	content := `use Module::Build;
+
+Module::Build->new(
+    module_name        => 'My::App',
+    configure_requires => { 'Module::Build' => '0.4004' },
+    build_requires     => { 'Test::More' => '0.88' },
+    requires           => {
+        'perl' => '5.010',
+        'JSON' => 0,
+    },
+)->create_build_script;
+`
+	path := filepath.Join(t.TempDir(), "Build.PL")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	result, err := ParseBuildPL(path)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("ParseBuildPL() error = %v", err)
+	}
+	want := map[dist.Phase][]dist.VersionReq{
+		dist.PhaseConfigure: {{Module: "Module::Build", Version: "0.4004"}},
+		dist.PhaseBuild:     {{Module: "Test::More", Version: "0.88"}},
+		dist.PhaseRuntime: {
+			{Module: "perl", Version: "5.010"},
+			{Module: "JSON", Version: "0"},
+		},
+	}
+	if !reflect.DeepEqual(result.Requirements, want) {
+		t.Errorf("Requirements = %+v, want %+v", result.Requirements, want)
+	}
+}
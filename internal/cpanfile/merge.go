@@ -0,0 +1,71 @@
+package cpanfile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// phaseOrder is the order in which Merge visits phases, so that its
+// output and errors do not depend on map iteration.
+var phaseOrder = []dist.Phase{dist.PhaseRuntime, dist.PhaseConfigure, dist.PhaseBuild, dist.PhaseTest, dist.PhaseDevelop}
+
+// Merge combines the parse results of several cpanfiles, e.g. one per
+// service of a monorepo, into one. files names the source of each result,
+// for error messages. A module required by several files is listed once
+// per phase, with all their constraints combined. It is an error if no
+// version can satisfy the combined constraints of a module across files.
+func Merge(files []string, results []*ParseResult) (*ParseResult, error) {
+	merged := NewParseResult()
+	type origin struct {
+		version string
+		file    string
+	}
+	var modules []string                 // in order of first appearance
+	origins := make(map[string][]origin) // module -> constraints by file
+	index := make(map[dist.Phase]map[string]int)
+
+	for i, result := range results {
+		merged.Included = append(merged.Included, result.Included...)
+		merged.Warnings = append(merged.Warnings, result.Warnings...)
+		for _, phase := range phaseOrder {
+			for _, req := range result.Requirements[phase] {
+				if _, seen := origins[req.Module]; !seen {
+					modules = append(modules, req.Module)
+				}
+				origins[req.Module] = append(origins[req.Module], origin{version: req.Version, file: files[i]})
+
+				if index[phase] == nil {
+					index[phase] = make(map[string]int)
+				}
+				j, ok := index[phase][req.Module]
+				if !ok {
+					index[phase][req.Module] = len(merged.Requirements[phase])
+					merged.Requirements[phase] = append(merged.Requirements[phase], req)
+					continue
+				}
+				have := &merged.Requirements[phase][j]
+				have.Version = dist.CombineConstraints(have.Version, req.Version)
+			}
+		}
+	}
+
+	var conflicts []error
+	for _, module := range modules {
+		combined := "0"
+		var parts []string
+		for _, o := range origins[module] {
+			combined = dist.CombineConstraints(combined, o.version)
+			parts = append(parts, fmt.Sprintf("%s in %s", o.version, o.file))
+		}
+		if !dist.Satisfiable(combined) {
+			conflicts = append(conflicts, fmt.Errorf("%s: no version satisfies %s", module, strings.Join(parts, " and ")))
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("conflicting requirements across cpanfiles: %w", errors.Join(conflicts...))
+	}
+	return merged, nil
+}
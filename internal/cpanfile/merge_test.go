@@ -0,0 +1,94 @@
+package cpanfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		second  string
+		want    map[dist.Phase][]dist.VersionReq
+		wantErr string
+	}{
+		{
+			name:   "compatible versions",
+			second: "requires 'Foo', '< 2.0';\nrequires 'Baz';\non 'test' => sub {\n    requires 'Bar', '0.5';\n};\n",
+			want: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {
+					{Module: "Foo", Version: "1.5, < 2.0"},
+					{Module: "Bar", Version: "1.0"},
+					{Module: "Baz", Version: "0"},
+				},
+				dist.PhaseTest: {{Module: "Bar", Version: "0.5"}},
+			},
+		},
+		{
+			name:    "incompatible versions",
+			second:  "requires 'Foo', '< 1.0';\n",
+			wantErr: "Foo: no version satisfies 1.5 in service-a/cpanfile and < 1.0 in service-b/cpanfile",
+		},
+		{
+			name:   "exact pins within range",
+			second: "requires 'Bar', '== 1.2';\nrequires 'Foo', '== 1.5';\n",
+			want: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {
+					{Module: "Foo", Version: "1.5, == 1.5"},
+					{Module: "Bar", Version: "1.0, == 1.2"},
+				},
+			},
+		},
+		{
+			name:    "exact pin outside range",
+			second:  "requires 'Foo', '== 1.2';\n",
+			wantErr: "Foo: no version satisfies 1.5 in service-a/cpanfile and == 1.2 in service-b/cpanfile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: two services sharing Foo and Bar
+			dir := t.TempDir()
+			files := []string{"service-a/cpanfile", "service-b/cpanfile"}
+			contents := []string{"requires 'Foo', '1.5';\nrequires 'Bar', '1.0';\n", tt.second}
+			var results []*ParseResult
+			for i, file := range files {
+				path := filepath.Join(dir, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(contents[i]), 0644); err != nil {
+					t.Fatal(err)
+				}
+				result, err := NewParser().Parse(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, result)
+			}
+
+			// Act
+			merged, err := Merge(files, results)
+
+			// Assert
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+			if !reflect.DeepEqual(merged.Requirements, tt.want) {
+				t.Errorf("Requirements = %+v, want %+v", merged.Requirements, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -21,36 +22,121 @@ func NewParser() *Parser {
 // ParseResult contains parsed requirements grouped by phase.
 type ParseResult struct {
 	Requirements map[dist.Phase][]dist.VersionReq
+	Included     []string  // files pulled in by include directives, in parse order
+	Warnings     []Warning // problems that did not stop parsing, in file order
+
+	sites map[string][]site // module -> where it was required, for duplicate checks
+}
+
+// Warning is a problem found while parsing, such as a directive yacm does
+// not understand or a module required twice.
+type Warning struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s:%d: %s", w.File, w.Line, w.Message)
+}
+
+// block is the context of an on or feature block.
+type block struct {
+	phase   dist.Phase
+	feature string // optional feature name, empty outside feature blocks
+}
+
+// site records where a requirement was declared.
+type site struct {
+	phase   dist.Phase
+	version string
+	file    string
+	line    int
 }
 
 // NewParseResult creates an empty parse result.
 func NewParseResult() *ParseResult {
 	return &ParseResult{
 		Requirements: make(map[dist.Phase][]dist.VersionReq),
+		sites:        make(map[string][]site),
 	}
 }
 
 var (
-	requiresRe = regexp.MustCompile(`^\s*requires\s+['"]([^'"]+)['"](?:\s*,\s*['"]([^'"]+)['"])?`)
-	onBlockRe  = regexp.MustCompile(`^\s*on\s+['"](\w+)['"]\s*=>\s*sub\s*\{`)
+	requiresRe = regexp.MustCompile(`^\s*((?:\w+_)?requires)\s+['"]([^'"]+)['"](?:\s*(?:,|=>)\s*(?:['"]([^'"]+)['"]|(v?\d[\d._]*)))?`)
+	onBlockRe  = regexp.MustCompile(`^\s*on\s+(?:['"](\w+)['"]|(\w+))\s*(?:=>|,)\s*sub\s*\{`)
+	featureRe  = regexp.MustCompile(`^\s*feature\s+['"]([^'"]+)['"].*=>\s*sub\s*\{`)
 	closeRe    = regexp.MustCompile(`^\s*\}`)
+	optionRe   = regexp.MustCompile(`(\w+)\s*=>\s*['"]([^'"]*)['"]`)
+	includeRe  = regexp.MustCompile(`^\s*include\s*\(?\s*['"]([^'"]+)['"]`)
+	wordRe     = regexp.MustCompile(`^\s*([A-Za-z_]\w*)(\s*=>)?`)
 )
 
-// Parse parses a cpanfile and returns requirements by phase.
+// phaseDirectives are the shorthands for a requires inside an on block,
+// e.g. test_requires 'Foo' for on 'test' => sub { requires 'Foo' }.
+var phaseDirectives = map[string]dist.Phase{
+	"requires":           "",
+	"configure_requires": dist.PhaseConfigure,
+	"build_requires":     dist.PhaseBuild,
+	"test_requires":      dist.PhaseTest,
+	"author_requires":    dist.PhaseDevelop,
+}
+
+// ignoredDirectives are valid cpanfile directives that yacm deliberately
+// does not resolve.
+var ignoredDirectives = map[string]bool{
+	"recommends": true,
+	"suggests":   true,
+	"conflicts":  true,
+	"feature":    true,
+	"mirror":     true,
+	"osname":     true,
+}
+
+// Parse parses a cpanfile and returns requirements by phase. Files named by
+// include 'path' directives are parsed in place, relative to the including
+// file, and their requirements merged into the same phases.
 func (p *Parser) Parse(path string) (*ParseResult, error) {
+	result := NewParseResult()
+	if err := p.parseFile(path, result, nil); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseFile parses path into result. stack holds the files currently being
+// included, to reject include cycles.
+func (p *Parser) parseFile(path string, result *ParseResult, stack []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("opening cpanfile: %w", err)
+	}
+	for _, including := range stack {
+		if including == abs {
+			return fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), abs)
+		}
+	}
+	stack = append(stack, abs)
+
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("opening cpanfile: %w", err)
+		return fmt.Errorf("opening cpanfile: %w", err)
 	}
 	defer file.Close()
 
-	result := NewParseResult()
-	currentPhase := dist.PhaseRuntime
-	inBlock := false
+	// Blocks nest, e.g. an on 'test' block inside a feature, so each
+	// "sub {" pushes its context and each closing brace pops it
+	current := block{phase: dist.PhaseRuntime}
+	var outer []block
+	lineNo := 0
+	warn := func(format string, args ...interface{}) {
+		result.Warnings = append(result.Warnings, Warning{File: path, Line: lineNo, Message: fmt.Sprintf(format, args...)})
+	}
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNo++
 
 		// Skip comments and empty lines
 		trimmed := strings.TrimSpace(line)
@@ -58,39 +144,120 @@ func (p *Parser) Parse(path string) (*ParseResult, error) {
 			continue
 		}
 
+		// Check for include 'path'
+		if matches := includeRe.FindStringSubmatch(line); matches != nil {
+			included := matches[1]
+			if !filepath.IsAbs(included) {
+				included = filepath.Join(filepath.Dir(path), included)
+			}
+			result.Included = append(result.Included, included)
+			if err := p.parseFile(included, result, stack); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// Check for on 'phase' => sub { block
 		if matches := onBlockRe.FindStringSubmatch(line); matches != nil {
-			currentPhase = parsePhase(matches[1])
-			inBlock = true
+			name := matches[1] + matches[2] // quoted or bare word
+			outer = append(outer, current)
+			current.phase = parsePhase(name)
+			if string(current.phase) != strings.ToLower(name) {
+				warn("unknown phase %q, treated as runtime", name)
+			}
+			continue
+		}
+
+		// Check for feature 'name', 'description' => sub { block
+		if matches := featureRe.FindStringSubmatch(line); matches != nil {
+			outer = append(outer, current)
+			current.feature = matches[1]
 			continue
 		}
 
 		// Check for closing brace
-		if inBlock && closeRe.MatchString(line) {
-			currentPhase = dist.PhaseRuntime
-			inBlock = false
+		if len(outer) > 0 && closeRe.MatchString(line) {
+			current = outer[len(outer)-1]
+			outer = outer[:len(outer)-1]
 			continue
 		}
 
 		// Check for requires statement
-		if matches := requiresRe.FindStringSubmatch(line); matches != nil {
-			module := matches[1]
+		loc := requiresRe.FindStringSubmatchIndex(line)
+		if directive, ok := phaseDirective(line, loc); ok {
+			phase := current.phase
+			if directive != "" {
+				phase = directive
+			}
+			module := line[loc[4]:loc[5]]
 			version := "0"
-			if matches[2] != "" {
-				version = matches[2]
+			if loc[6] != -1 {
+				version = line[loc[6]:loc[7]]
+			} else if loc[8] != -1 {
+				// Unquoted numeric version, e.g. requires 'JSON', 2.0;
+				version = line[loc[8]:loc[9]]
 			}
-			result.Requirements[currentPhase] = append(result.Requirements[currentPhase], dist.VersionReq{
+			result.checkRequirement(module, version, phase, path, lineNo, warn)
+			result.Requirements[phase] = append(result.Requirements[phase], dist.VersionReq{
 				Module:  module,
 				Version: version,
+				Options: parseOptions(line[loc[1]:]),
+				Feature: current.feature,
 			})
+			continue
+		}
+
+		// Anything else starting with a bare word is a directive we do not
+		// understand; continuation lines such as "git => '...'," are not.
+		if matches := wordRe.FindStringSubmatch(line); matches != nil && matches[2] == "" && !ignoredDirectives[matches[1]] {
+			if _, ok := phaseDirectives[matches[1]]; ok {
+				warn("cannot parse %s; expected a quoted module name", matches[1])
+			} else {
+				warn("unrecognized directive %q", matches[1])
+			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading cpanfile: %w", err)
+		return fmt.Errorf("reading cpanfile: %w", err)
 	}
 
-	return result, nil
+	return nil
+}
+
+// checkRequirement warns about a requirement of module that repeats or
+// contradicts an earlier one, and about requires 'perl' outside the top
+// level, before recording where it was declared.
+func (r *ParseResult) checkRequirement(module, version string, phase dist.Phase, file string, line int, warn func(string, ...interface{})) {
+	if module == "perl" && phase != dist.PhaseRuntime {
+		warn("requires 'perl' inside on '%s'; declare the perl version at the top level", phase)
+	}
+
+	for _, prev := range r.sites[module] {
+		if prev.phase == phase && prev.version == version {
+			warn("duplicate requirement for %s in phase %s (first at %s:%d)", module, phase, prev.file, prev.line)
+			break
+		}
+		if prev.version != version && prev.version != "0" && version != "0" {
+			warn("%s required as %s here but as %s at %s:%d", module, version, prev.version, prev.file, prev.line)
+			break
+		}
+	}
+	r.sites[module] = append(r.sites[module], site{phase: phase, version: version, file: file, line: line})
+}
+
+// parseOptions collects trailing key => 'value' pairs of a requires line,
+// such as git => 'https://...' or ref => 'v1.0'.
+func parseOptions(rest string) map[string]string {
+	matches := optionRe.FindAllStringSubmatch(rest, -1)
+	if matches == nil {
+		return nil
+	}
+	options := make(map[string]string, len(matches))
+	for _, m := range matches {
+		options[m[1]] = m[2]
+	}
+	return options
 }
 
 func parsePhase(s string) dist.Phase {
@@ -101,7 +268,20 @@ func parsePhase(s string) dist.Phase {
 		return dist.PhaseDevelop
 	case "build":
 		return dist.PhaseBuild
+	case "configure":
+		return dist.PhaseConfigure
 	default:
 		return dist.PhaseRuntime
 	}
 }
+
+// phaseDirective returns the phase a requires line matched by requiresRe at
+// loc declares, empty for a plain requires, which takes the phase of its
+// block. ok is false if loc is nil or the directive is not a requires.
+func phaseDirective(line string, loc []int) (phase dist.Phase, ok bool) {
+	if loc == nil {
+		return "", false
+	}
+	phase, ok = phaseDirectives[line[loc[2]:loc[3]]]
+	return phase, ok
+}
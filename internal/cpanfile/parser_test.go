@@ -3,6 +3,7 @@ package cpanfile
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/frederic-klein/yacm/internal/dist"
@@ -65,6 +66,20 @@ requires 'JSON';  # inline comment not supported but line works`,
 				dist.PhaseRuntime: {{Module: "JSON", Version: "0"}},
 			},
 		},
+		{
+			name:    "unquoted numeric version",
+			content: `requires 'JSON', 2.0;`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {{Module: "JSON", Version: "2.0"}},
+			},
+		},
+		{
+			name:    "unquoted dotted version",
+			content: `requires 'Foo', v1.2.3;`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {{Module: "Foo", Version: "v1.2.3"}},
+			},
+		},
 		{
 			name: "double quotes",
 			content: `requires "JSON", "2.0";`,
@@ -72,6 +87,66 @@ requires 'JSON';  # inline comment not supported but line works`,
 				dist.PhaseRuntime: {{Module: "JSON", Version: "2.0"}},
 			},
 		},
+		{
+			name:    "fat comma",
+			content: `requires 'Foo' => '1.0';`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {{Module: "Foo", Version: "1.0"}},
+			},
+		},
+		{
+			name:    "fat comma with double quotes",
+			content: `requires "Foo"=>">= 1.0, < 2";`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {{Module: "Foo", Version: ">= 1.0, < 2"}},
+			},
+		},
+		{
+			name:    "fat comma with unquoted version",
+			content: `requires 'Foo' => 1.5;`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {{Module: "Foo", Version: "1.5"}},
+			},
+		},
+		{
+			name:    "test_requires",
+			content: `test_requires 'Test::More', '0.98';`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseTest: {{Module: "Test::More", Version: "0.98"}},
+			},
+		},
+		{
+			name:    "author_requires",
+			content: `author_requires 'Perl::Critic';`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseDevelop: {{Module: "Perl::Critic", Version: "0"}},
+			},
+		},
+		{
+			name:    "configure_requires",
+			content: `configure_requires 'Module::Build' => '0.42';`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseConfigure: {{Module: "Module::Build", Version: "0.42"}},
+			},
+		},
+		{
+			name:    "build_requires",
+			content: `build_requires 'ExtUtils::MakeMaker';`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseBuild: {{Module: "ExtUtils::MakeMaker", Version: "0"}},
+			},
+		},
+		{
+			name: "unquoted on block",
+			content: `on test => sub {
+    requires 'Test::More';
+};
+requires 'JSON';`,
+			wantReqs: map[dist.Phase][]dist.VersionReq{
+				dist.PhaseRuntime: {{Module: "JSON", Version: "0"}},
+				dist.PhaseTest:    {{Module: "Test::More", Version: "0"}},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -104,3 +179,242 @@ requires 'JSON';  # inline comment not supported but line works`,
 		})
 	}
 }
+
+func TestParser_Parse_Options(t *testing.T) {
+	// Arrange
+	content := `requires 'Foo', '== 1.0', git => 'https://github.com/example/Foo.git', ref => 'v1.0';
+requires 'Bar', url => "https://example.com/Bar-2.0.tar.gz";
+requires 'Baz', '2.0';`
+
+	tmpDir := t.TempDir()
+	cpanfilePath := filepath.Join(tmpDir, "cpanfile")
+	if err := os.WriteFile(cpanfilePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	result, err := NewParser().Parse(cpanfilePath)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	reqs := result.Requirements[dist.PhaseRuntime]
+	if len(reqs) != 3 {
+		t.Fatalf("got %d reqs, want 3", len(reqs))
+	}
+
+	foo := reqs[0]
+	if foo.Module != "Foo" || foo.Version != "== 1.0" {
+		t.Errorf("req 0 = %+v, want Foo == 1.0", foo)
+	}
+	if foo.Options["git"] != "https://github.com/example/Foo.git" {
+		t.Errorf("Foo git option = %q", foo.Options["git"])
+	}
+	if foo.Options["ref"] != "v1.0" {
+		t.Errorf("Foo ref option = %q, want v1.0", foo.Options["ref"])
+	}
+
+	bar := reqs[1]
+	if bar.Version != "0" || bar.Options["url"] != "https://example.com/Bar-2.0.tar.gz" {
+		t.Errorf("req 1 = %+v, want Bar 0 with url option", bar)
+	}
+
+	if reqs[2].Options != nil {
+		t.Errorf("req 2 options = %v, want none", reqs[2].Options)
+	}
+}
+
+func TestParser_Parse_Include(t *testing.T) {
+	// Arrange: cpanfile includes deps/test, which includes deps/common
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"cpanfile":    "requires 'Moo', '2.0';\ninclude 'deps/test';\n",
+		"deps/test":   "include 'common';\non 'test' => sub {\n    requires 'Test::More', '0.98';\n};\n",
+		"deps/common": "requires 'JSON';\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Act
+	result, err := NewParser().Parse(filepath.Join(tmpDir, "cpanfile"))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	runtime := result.Requirements[dist.PhaseRuntime]
+	if len(runtime) != 2 || runtime[0].Module != "Moo" || runtime[1].Module != "JSON" {
+		t.Errorf("runtime reqs = %+v, want Moo and JSON", runtime)
+	}
+	test := result.Requirements[dist.PhaseTest]
+	if len(test) != 1 || test[0].Module != "Test::More" {
+		t.Errorf("test reqs = %+v, want Test::More", test)
+	}
+	wantIncluded := []string{filepath.Join(tmpDir, "deps/test"), filepath.Join(tmpDir, "deps/common")}
+	if strings.Join(result.Included, ",") != strings.Join(wantIncluded, ",") {
+		t.Errorf("Included = %v, want %v", result.Included, wantIncluded)
+	}
+}
+
+func TestParser_Parse_IncludeCycle(t *testing.T) {
+	// Arrange: a cpanfile that includes itself
+	tmpDir := t.TempDir()
+	cpanfilePath := filepath.Join(tmpDir, "cpanfile")
+	if err := os.WriteFile(cpanfilePath, []byte("requires 'Moo';\ninclude 'cpanfile';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	_, err := NewParser().Parse(cpanfilePath)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("Parse() error = %v, want include cycle", err)
+	}
+}
+
+func TestParser_Parse_Warnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "clean",
+			content: `requires 'perl', '5.010';
+requires 'Moo', '2.0',
+    git => 'https://github.com/moose/Moo.git';
+recommends 'JSON::XS';
+on 'test' => sub {
+    requires 'Moo', '2.0';
+    requires 'Test::More';
+};
+`,
+		},
+		{
+			name: "phase shorthands and unquoted on",
+			content: `test_requires 'Test::More';
+author_requires 'Perl::Critic';
+configure_requires 'Module::Build';
+on develop => sub {
+    requires 'Test::Pod';
+};
+`,
+		},
+		{
+			name:    "duplicate in the same phase",
+			content: "requires 'Moo';\nrequires 'JSON';\nrequires 'Moo';\n",
+			want:    []string{"3: duplicate requirement for Moo in phase runtime (first at cpanfile:1)"},
+		},
+		{
+			name:    "conflicting versions",
+			content: "requires 'Moo', '2.0';\non 'test' => sub {\n    requires 'Moo', '== 1.0';\n};\n",
+			want:    []string{"3: Moo required as == 1.0 here but as 2.0 at cpanfile:1"},
+		},
+		{
+			name:    "perl inside a phase block",
+			content: "on 'test' => sub {\n    requires 'perl', '5.010';\n};\n",
+			want:    []string{"2: requires 'perl' inside on 'test'; declare the perl version at the top level"},
+		},
+		{
+			name:    "unrecognized directive",
+			content: "requires 'Moo';\nfrobnicate_requires 'Test::More';\n",
+			want:    []string{`2: unrecognized directive "frobnicate_requires"`},
+		},
+		{
+			name:    "unknown phase",
+			content: "on 'tests' => sub {\n    requires 'Test::More';\n};\n",
+			want:    []string{`1: unknown phase "tests", treated as runtime`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			tmpDir := t.TempDir()
+			path := filepath.Join(tmpDir, "cpanfile")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			result, err := NewParser().Parse(path)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var got []string
+			for _, w := range result.Warnings {
+				got = append(got, strings.ReplaceAll(w.String(), tmpDir+string(filepath.Separator), ""))
+			}
+			for i := range tt.want {
+				tt.want[i] = "cpanfile:" + tt.want[i]
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Warnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_Parse_NestedBlocks(t *testing.T) {
+	// Arrange
+	content := `requires 'Moo';
+feature 'sqlite', 'SQLite support' => sub {
+    requires 'DBD::SQLite';
+    on 'test' => sub {
+        requires 'Test::DBIx';
+    };
+    requires 'DBI';
+};
+on 'develop' => sub {
+    feature 'lint', 'Linting' => sub {
+        requires 'Perl::Critic';
+    };
+    requires 'Test::Pod';
+};
+requires 'JSON';
+`
+	cpanfilePath := filepath.Join(t.TempDir(), "cpanfile")
+	if err := os.WriteFile(cpanfilePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	result, err := NewParser().Parse(cpanfilePath)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := map[dist.Phase][]string{
+		dist.PhaseRuntime: {"Moo", "DBD::SQLite [sqlite]", "DBI [sqlite]", "JSON"},
+		dist.PhaseTest:    {"Test::DBIx [sqlite]"},
+		dist.PhaseDevelop: {"Perl::Critic [lint]", "Test::Pod"},
+	}
+	for phase, wantReqs := range want {
+		var got []string
+		for _, req := range result.Requirements[phase] {
+			name := req.Module
+			if req.Feature != "" {
+				name += " [" + req.Feature + "]"
+			}
+			got = append(got, name)
+		}
+		if strings.Join(got, ", ") != strings.Join(wantReqs, ", ") {
+			t.Errorf("%s reqs = %v, want %v", phase, got, wantReqs)
+		}
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Warnings = %v, want none", result.Warnings)
+	}
+}
@@ -0,0 +1,24 @@
+package cpanfile
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// Write writes runtime requirements as cpanfile requires statements.
+func Write(w io.Writer, reqs []dist.VersionReq) error {
+	for _, req := range reqs {
+		var err error
+		if req.Version == "" || req.Version == "0" {
+			_, err = fmt.Fprintf(w, "requires '%s';\n", req.Module)
+		} else {
+			_, err = fmt.Fprintf(w, "requires '%s', '%s';\n", req.Module, req.Version)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
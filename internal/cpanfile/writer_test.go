@@ -0,0 +1,29 @@
+package cpanfile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestWrite(t *testing.T) {
+	reqs := []dist.VersionReq{
+		{Module: "LWP", Version: "== 6.72"},
+		{Module: "Moo", Version: "== 2.005005"},
+		{Module: "Undef::Version", Version: "0"},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, reqs); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := `requires 'LWP', '== 6.72';
+requires 'Moo', '== 2.005005';
+requires 'Undef::Version';
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant:\n%s", got, want)
+	}
+}
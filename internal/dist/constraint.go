@@ -0,0 +1,128 @@
+package dist
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// constraintOps are the operators of a constraint bound, two-character ones
+// first so that ">=" is not read as ">".
+var constraintOps = []string{">=", "<=", "!=", "==", ">", "<"}
+
+// SplitConstraint splits one bound of a version constraint, e.g. "< 2.0",
+// into its operator and version. A bare version is a minimum, ">=".
+// Compatible-release bounds like "~1.2" must be expanded with ExpandTilde
+// first.
+func SplitConstraint(bound string) (op, version string) {
+	bound = strings.TrimSpace(bound)
+	for _, prefix := range constraintOps {
+		if rest, ok := strings.CutPrefix(bound, prefix); ok {
+			return prefix, strings.TrimSpace(rest)
+		}
+	}
+	return ">=", bound
+}
+
+// ExpandTilde rewrites a "~1.2" (compatible release) constraint into the
+// equivalent range ">= 1.2, < 2".
+func ExpandTilde(want string) string {
+	ver := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(want), "~"))
+	major, _, _ := strings.Cut(strings.TrimPrefix(ver, "v"), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return ">= " + ver
+	}
+	return fmt.Sprintf(">= %s, < %d", ver, n+1)
+}
+
+// CombineConstraints returns the constraint requiring both a and b, e.g.
+// ">= 1.0, < 2" for ">= 1.0" and "< 2". Bounds in both are kept once.
+func CombineConstraints(a, b string) string {
+	var parts []string
+	for _, p := range strings.Split(a+","+b, ",") {
+		if p = strings.TrimSpace(p); p != "" && p != "0" && !slices.Contains(parts, p) {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Satisfiable reports whether some version meets every comma-separated
+// bound of constraint, e.g. false for ">= 2.0, < 1.5".
+func Satisfiable(constraint string) bool {
+	var lower, upper, exact string
+	lowerIncl, upperIncl := true, true
+	var excluded []string
+
+	var bounds []string
+	for _, c := range strings.Split(constraint, ",") {
+		if c = strings.TrimSpace(c); strings.HasPrefix(c, "~") {
+			c = ExpandTilde(c)
+		}
+		bounds = append(bounds, strings.Split(c, ",")...)
+	}
+	for _, c := range bounds {
+		op, ver := SplitConstraint(c)
+		if ver == "" {
+			continue
+		}
+
+		switch op {
+		case ">=", ">":
+			incl := op == ">="
+			if cmp := CompareVersions(ver, lower); lower == "" || cmp > 0 || cmp == 0 && !incl {
+				lower, lowerIncl = ver, incl
+			}
+		case "<=", "<":
+			incl := op == "<="
+			if cmp := CompareVersions(ver, upper); upper == "" || cmp < 0 || cmp == 0 && !incl {
+				upper, upperIncl = ver, incl
+			}
+		case "==":
+			if exact != "" && CompareVersions(exact, ver) != 0 {
+				return false
+			}
+			exact = ver
+		case "!=":
+			excluded = append(excluded, ver)
+		}
+	}
+
+	isExcluded := func(v string) bool {
+		for _, ex := range excluded {
+			if CompareVersions(v, ex) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	if exact != "" {
+		if lower != "" {
+			if cmp := CompareVersions(exact, lower); cmp < 0 || cmp == 0 && !lowerIncl {
+				return false
+			}
+		}
+		if upper != "" {
+			if cmp := CompareVersions(exact, upper); cmp > 0 || cmp == 0 && !upperIncl {
+				return false
+			}
+		}
+		return !isExcluded(exact)
+	}
+	if lower == "" || upper == "" {
+		return true
+	}
+	switch cmp := CompareVersions(lower, upper); {
+	case cmp < 0:
+		return true
+	case cmp > 0:
+		return false
+	}
+	return lowerIncl && upperIncl && !isExcluded(lower)
+}
@@ -0,0 +1,95 @@
+package dist
+
+import "testing"
+
+func TestSplitConstraint(t *testing.T) {
+	tests := []struct {
+		bound   string
+		op      string
+		version string
+	}{
+		{">= 1.0", ">=", "1.0"},
+		{"<2", "<", "2"},
+		{"!= 1.5", "!=", "1.5"},
+		{"== v1.2.3", "==", "v1.2.3"},
+		{" 1.5 ", ">=", "1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bound, func(t *testing.T) {
+			op, version := SplitConstraint(tt.bound)
+			if op != tt.op || version != tt.version {
+				t.Errorf("SplitConstraint(%q) = %q, %q, want %q, %q", tt.bound, op, version, tt.op, tt.version)
+			}
+		})
+	}
+}
+
+func TestExpandTilde(t *testing.T) {
+	tests := []struct {
+		want string
+		out  string
+	}{
+		{"~1.2", ">= 1.2, < 2"},
+		{"~ 0.45", ">= 0.45, < 1"},
+		{"~v2.3.4", ">= v2.3.4, < 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := ExpandTilde(tt.want); got != tt.out {
+				t.Errorf("ExpandTilde(%q) = %q, want %q", tt.want, got, tt.out)
+			}
+		})
+	}
+}
+
+func TestCombineConstraints(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"0", "0", "0"},
+		{">= 1.0", "< 2", ">= 1.0, < 2"},
+		{"", ">= 1.0", ">= 1.0"},
+		{">= 1.0, < 2", "< 2", ">= 1.0, < 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" and "+tt.b, func(t *testing.T) {
+			if got := CombineConstraints(tt.a, tt.b); got != tt.want {
+				t.Errorf("CombineConstraints(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSatisfiable(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       bool
+	}{
+		{"0", true},
+		{">= 1.0, < 2.0", true},
+		{">= 2.0, < 1.5", false},
+		{">= 1.0, <= 1.0", true},
+		{">= 1.0, < 1.0", false},
+		{"> 1.0, <= 1.0", false},
+		{">= 1.0, <= 1.0, != 1.0", false},
+		{"== 1.2, >= 1.0, < 2", true},
+		{"== 1.2, == 1.3", false},
+		{"== 1.2, != 1.2", false},
+		{"1.5, == 1.2", false},
+		{"~1.2, < 1.9", true},
+		{"~1.2, == 2.1", false},
+		{"~1.2, >= 2.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			if got := Satisfiable(tt.constraint); got != tt.want {
+				t.Errorf("Satisfiable(%q) = %v, want %v", tt.constraint, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,33 +1,78 @@
 package dist
 
+import (
+	"regexp"
+	"strings"
+)
+
 // Dist represents a CPAN distribution with its metadata.
 type Dist struct {
-	Name         string            // e.g., "Module-Name-1.23"
-	Pathname     string            // e.g., "A/AU/AUTHOR/Module-Name-1.23.tar.gz"
-	Provides     map[string]string // module -> version
-	Requirements map[string]string // module -> version constraint
-	Source       string            // "cpan" or "backpan"
+	Name             string            // e.g., "Module-Name-1.23"
+	Pathname         string            // e.g., "A/AU/AUTHOR/Module-Name-1.23.tar.gz"
+	Provides         map[string]string // module -> version
+	Requirements     map[string]string // module -> version constraint
+	ReqPhases        map[string]Phase  // module -> META phase declaring the requirement, where known
+	Source           string            // "cpan" or "backpan"
+	Phase            Phase             // phase of the requirement that first pulled it in, empty for runtime
+	Reason           string            // why it was chosen, e.g. "Bar >= 1.5 required by Foo-1.0; from CPAN index"
+	ConfigureSkipped bool              // configure was not run for dynamic prerequisites, so Requirements may be incomplete
+}
+
+var versionSuffixRe = regexp.MustCompile(`-v?\d[\w.]*$`)
+
+// BaseName strips the version from a distribution name, e.g. Foo-Bar for
+// Foo-Bar-1.23.
+func BaseName(name string) string {
+	return versionSuffixRe.ReplaceAllString(name, "")
 }
 
 // VersionReq represents a module version requirement.
 type VersionReq struct {
 	Module  string
-	Version string // e.g., ">= 1.0, < 2.0"
+	Version string            // e.g., ">= 1.0, < 2.0"
+	Options map[string]string // trailing options, e.g. git => "https://..."
+	Phase   Phase             // cpanfile phase, empty for runtime
+	Feature string            // cpanfile optional feature declaring it, empty if none
 }
 
 // Phase represents a dependency phase (runtime, test, develop, etc).
 type Phase string
 
 const (
-	PhaseRuntime Phase = "runtime"
-	PhaseTest    Phase = "test"
-	PhaseDevelop Phase = "develop"
-	PhaseBuild   Phase = "build"
+	PhaseRuntime   Phase = "runtime"
+	PhaseTest      Phase = "test"
+	PhaseDevelop   Phase = "develop"
+	PhaseBuild     Phase = "build"
+	PhaseConfigure Phase = "configure"
 )
 
+// IsTestOnly reports whether p is a phase whose prerequisites are only
+// needed to test or develop a project, not to build and run it.
+func (p Phase) IsTestOnly() bool {
+	return p == PhaseTest || p == PhaseDevelop
+}
+
 // CPANIndex represents a module entry from 02packages.details.txt.
 type CPANIndex struct {
 	Module   string
 	Version  string
 	Pathname string
+	Mirror   string // mirror serving Pathname, set by the index that loaded the entry
+}
+
+// Author returns the CPAN ID of the uploading author, taken from the
+// A/AU/AUTHOR/ directory layout of the pathname. It returns an empty string
+// if the pathname does not follow that layout.
+func (e CPANIndex) Author() string {
+	path := strings.TrimPrefix(e.Pathname, "authors/id/")
+	parts := strings.Split(path, "/")
+	if len(parts) < 4 {
+		return ""
+	}
+
+	initial, prefix, id := parts[0], parts[1], parts[2]
+	if len(initial) != 1 || len(prefix) != 2 || !strings.HasPrefix(prefix, initial) || !strings.HasPrefix(id, prefix) {
+		return ""
+	}
+	return id
 }
@@ -0,0 +1,51 @@
+package dist
+
+import "testing"
+
+func TestCPANIndex_Author(t *testing.T) {
+	tests := []struct {
+		pathname string
+		want     string
+	}{
+		{"M/MA/MAKAMAKA/JSON-2.97001.tar.gz", "MAKAMAKA"},
+		{"H/HA/HAARG/Moo-2.005005.tar.gz", "HAARG"},
+		{"I/IN/INGY/YAML-1.30.tar.gz", "INGY"},
+		{"A/AB/AB/Short-1.0.tar.gz", "AB"},
+		{"authors/id/E/ET/ETHER/Moose-2.2207.tar.gz", "ETHER"},
+		{"E/ET/ETHER/sub/dir/Dist-1.0.tar.gz", "ETHER"},
+		{"JSON-2.0.tar.gz", ""},
+		{"M/MA/Dist-1.0.tar.gz", ""},
+		{"M/XY/MAKAMAKA/Dist-1.0.tar.gz", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pathname, func(t *testing.T) {
+			entry := CPANIndex{Pathname: tt.pathname}
+			if got := entry.Author(); got != tt.want {
+				t.Errorf("Author() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Foo-Bar-1.23", "Foo-Bar"},
+		{"Foo-v1.2.3", "Foo"},
+		{"Foo-1.0_01", "Foo"},
+		{"libwww-perl-6.72", "libwww-perl"},
+		{"Foo", "Foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BaseName(tt.name); got != tt.want {
+				t.Errorf("BaseName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package dist
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two Perl version strings, returning -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	aParts := normalizeVersion(a)
+	bParts := normalizeVersion(b)
+
+	maxLen := len(aParts)
+	if len(bParts) > maxLen {
+		maxLen = len(bParts)
+	}
+
+	for i := 0; i < maxLen; i++ {
+		aVal := 0
+		bVal := 0
+		if i < len(aParts) {
+			aVal = aParts[i]
+		}
+		if i < len(bParts) {
+			bVal = bParts[i]
+		}
+		if aVal < bVal {
+			return -1
+		}
+		if aVal > bVal {
+			return 1
+		}
+	}
+	return 0
+}
+
+// normalizeVersion converts a Perl version string to a slice of integers.
+// Handles both dotted (v3.18.0, 3.18.0) and decimal (3.007004) formats.
+// Decimal format: 3.007004 -> [3, 7, 4] (groups of 3 digits in fractional part)
+// Dotted format: 3.18.0 -> [3, 18, 0]
+func normalizeVersion(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	if v == "" {
+		return []int{0}
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) == 1 {
+		// Just a number like "5"
+		n, _ := strconv.Atoi(parts[0])
+		return []int{n}
+	}
+
+	// Check if this is decimal format (fractional part has many digits, no dots after first)
+	// e.g., 3.007004 vs 3.18.0
+	if len(parts) == 2 && len(parts[1]) > 3 {
+		// Decimal format - split fractional part into groups of 3
+		major, _ := strconv.Atoi(parts[0])
+		result := []int{major}
+
+		frac := parts[1]
+		for len(frac) > 0 {
+			chunk := frac
+			if len(chunk) > 3 {
+				chunk = frac[:3]
+				frac = frac[3:]
+			} else {
+				frac = ""
+			}
+			n, _ := strconv.Atoi(chunk)
+			result = append(result, n)
+		}
+		return result
+	}
+
+	// Dotted format - parse each part as integer
+	result := make([]int, len(parts))
+	for i, p := range parts {
+		result[i], _ = strconv.Atoi(p)
+	}
+	return result
+}
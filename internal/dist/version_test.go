@@ -0,0 +1,70 @@
+package dist
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0", "1.0", 1},
+		{"1.10", "1.9", 1},
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.2.4", "1.2.3", 1},
+		{"v1.0", "1.0", 0},
+		{"1", "1.0", 0},
+		{"1.0", "1", 0},
+		{"1.001", "1.1", 0},
+		// Perl decimal format tests
+		{"3.18.0", "3.007004", 1},  // 3.18.0 > 3.7.4
+		{"3.007004", "3.18.0", -1}, // 3.7.4 < 3.18.0
+		{"3.007004", "3.007004", 0},
+		{"0.080001", "0.08", 1},  // 0.80.1 > 0.8
+		{"2.005005", "2.005", 1}, // 2.5.5 > 2.5
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			got := CompareVersions(tt.a, tt.b)
+			if got != tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []int
+	}{
+		{"1.0", []int{1, 0}},
+		{"3.18.0", []int{3, 18, 0}},
+		{"3.007004", []int{3, 7, 4}},  // Decimal format
+		{"0.080001", []int{0, 80, 1}}, // Decimal format
+		{"2.005005", []int{2, 5, 5}},  // Decimal format
+		{"v1.2.3", []int{1, 2, 3}},
+		{"5", []int{5}},
+		{"", []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := normalizeVersion(tt.input)
+			if len(got) != len(tt.want) {
+				t.Errorf("normalizeVersion(%q) = %v, want %v", tt.input, got, tt.want)
+				return
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("normalizeVersion(%q) = %v, want %v", tt.input, got, tt.want)
+					return
+				}
+			}
+		})
+	}
+}
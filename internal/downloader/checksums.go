@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Checksum is the CHECKSUMS entry of one file in a CPAN author directory.
+type Checksum struct {
+	SHA256 string
+	Size   int64
+}
+
+var (
+	checksumEntryRe  = regexp.MustCompile(`'([^']+)'\s*=>\s*\{([^}]*)\}`)
+	checksumSHA256Re = regexp.MustCompile(`'sha256'\s*=>\s*'([0-9a-fA-F]+)'`)
+	checksumSizeRe   = regexp.MustCompile(`'size'\s*=>\s*'?(\d+)'?`)
+)
+
+// ParseChecksums parses a CPAN CHECKSUMS file into entries keyed by file
+// name. The Perl data structure is read statically and its PGP signature
+// is not checked.
+func ParseChecksums(r io.Reader) (map[string]Checksum, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading CHECKSUMS: %w", err)
+	}
+
+	checksums := make(map[string]Checksum)
+	for _, m := range checksumEntryRe.FindAllStringSubmatch(string(data), -1) {
+		var sum Checksum
+		if sha := checksumSHA256Re.FindStringSubmatch(m[2]); sha != nil {
+			sum.SHA256 = sha[1]
+		}
+		if size := checksumSizeRe.FindStringSubmatch(m[2]); size != nil {
+			sum.Size, _ = strconv.ParseInt(size[1], 10, 64)
+		}
+		checksums[m[1]] = sum
+	}
+	return checksums, nil
+}
+
+// LoadChecksums parses the CHECKSUMS file at path.
+func LoadChecksums(path string) (map[string]Checksum, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseChecksums(file)
+}
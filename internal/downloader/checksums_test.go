@@ -0,0 +1,45 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	// Arrange
+	input := `# CHECKSUMS file written on Mon Jan  1 00:00:00 2024 GMT by CPAN::Checksums (v2.14)
+$cksum = {
+  'JSON-2.0.tar.gz' => {
+    'md5' => '2a4bb5d05a9c9a1e8e2a2e6b2c3b6c8b',
+    'mtime' => '2008-03-01',
+    'sha256' => '7a1f4fcde0e4a5e36c0d6a4a1cd4e1f2e1f3c5b8f84ea0e1a9d3f0b8a5c6e7d8',
+    'size' => 45678
+  },
+  'JSON-2.0.meta' => {
+    'md5' => 'e2d3c4b5a6978869504132a1b2c3d4e5',
+    'size' => 1024
+  }
+};
+__END__
+`
+
+	// Act
+	got, err := ParseChecksums(strings.NewReader(input))
+
+	// Assert
+	if err != nil {
+		t.Fatalf("ParseChecksums() error = %v", err)
+	}
+	want := map[string]Checksum{
+		"JSON-2.0.tar.gz": {SHA256: "7a1f4fcde0e4a5e36c0d6a4a1cd4e1f2e1f3c5b8f84ea0e1a9d3f0b8a5c6e7d8", Size: 45678},
+		"JSON-2.0.meta":   {Size: 1024},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s = %+v, want %+v", name, got[name], w)
+		}
+	}
+}
@@ -1,12 +1,22 @@
 package downloader
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/httpclient"
+	"github.com/frederic-klein/yacm/internal/logger"
 )
 
 // Job represents a download job.
@@ -14,19 +24,41 @@ type Job struct {
 	URL      string
 	DestPath string
 	Source   string // "cpan" or "backpan"
+	Size     int64  // expected size in bytes, 0 if unknown
+	SHA256   string // expected hex SHA-256 digest, empty if unknown
 }
 
 // Result represents a download result.
 type Result struct {
-	Job   Job
-	Error error
+	Job       Job
+	Error     error
+	FromCache bool // the file already existed and was not downloaded
+}
+
+// StatusError reports a download answered with a non-200 HTTP status.
+type StatusError struct {
+	URL        string
+	StatusCode int
 }
 
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("downloading %s: HTTP %d", e.URL, e.StatusCode)
+}
+
+// ErrMirrorUnavailable is returned for downloads skipped because too many
+// others failed, see SetFailFastThreshold.
+var ErrMirrorUnavailable = errors.New("mirror appears unavailable")
+
 // Downloader handles parallel HTTP downloads.
 type Downloader struct {
 	workers  int
 	cacheDir string
 	client   *http.Client
+	log      *logger.Logger
+
+	failFast int          // failures after which downloads are skipped, 0 for never
+	failures atomic.Int64 // server and connection failures so far
+	aborted  atomic.Bool  // the fail-fast threshold was crossed
 }
 
 // NewDownloader creates a new downloader with the specified number of workers.
@@ -34,12 +66,57 @@ func NewDownloader(workers int, cacheDir string) *Downloader {
 	return &Downloader{
 		workers:  workers,
 		cacheDir: cacheDir,
-		client:   &http.Client{},
+		client:   httpclient.New(""),
+	}
+}
+
+// SetHTTPClient sets the client used for downloads, e.g. one shared with
+// the indexes or wrapping a custom transport. Nil restores the default.
+func (d *Downloader) SetHTTPClient(client *http.Client) {
+	if client == nil {
+		client = httpclient.New("")
+	}
+	d.client = client
+}
+
+// SetLogger sets the logger used for per-request debug output.
+func (d *Downloader) SetLogger(log *logger.Logger) {
+	d.log = log
+}
+
+// SetFailFastThreshold makes the downloader give up on the mirror once n
+// downloads have failed with a connection error or an HTTP 5xx status, over
+// all calls rather than per call. Every later download that is not cached
+// then fails with ErrMirrorUnavailable without a request, so an outage is
+// reported quickly instead of after trying every file. Zero, the default,
+// never gives up.
+func (d *Downloader) SetFailFastThreshold(n int) {
+	d.failFast = n
+}
+
+// Failures returns how many downloads have failed with a connection error
+// or an HTTP 5xx status so far.
+func (d *Downloader) Failures() int {
+	return int(d.failures.Load())
+}
+
+// recordFailure counts a connection or server failure and, when it crosses
+// the fail-fast threshold, aborts later downloads.
+func (d *Downloader) recordFailure() {
+	n := d.failures.Add(1)
+	if d.failFast > 0 && n >= int64(d.failFast) && d.aborted.CompareAndSwap(false, true) {
+		d.log.Warnf("%d downloads failed, the mirror appears unavailable; skipping remaining downloads", n)
 	}
 }
 
 // Download downloads multiple files in parallel.
 func (d *Downloader) Download(jobs []Job) []Result {
+	return d.DownloadContext(context.Background(), jobs)
+}
+
+// DownloadContext is like Download, but aborts requests in flight when ctx
+// is cancelled.
+func (d *Downloader) DownloadContext(ctx context.Context, jobs []Job) []Result {
 	if err := os.MkdirAll(d.cacheDir, 0755); err != nil {
 		results := make([]Result, len(jobs))
 		for i, job := range jobs {
@@ -57,8 +134,8 @@ func (d *Downloader) Download(jobs []Job) []Result {
 		go func() {
 			defer wg.Done()
 			for job := range jobChan {
-				err := d.downloadOne(job)
-				resultChan <- Result{Job: job, Error: err}
+				fromCache, err := d.downloadOne(ctx, job)
+				resultChan <- Result{Job: job, Error: err, FromCache: fromCache}
 			}
 		}()
 	}
@@ -81,46 +158,111 @@ func (d *Downloader) Download(jobs []Job) []Result {
 	return results
 }
 
-func (d *Downloader) downloadOne(job Job) error {
+func (d *Downloader) downloadOne(ctx context.Context, job Job) (bool, error) {
 	// Check if already cached
-	if _, err := os.Stat(job.DestPath); err == nil {
-		return nil
+	if cached(job) {
+		return true, nil
+	}
+
+	if d.aborted.Load() {
+		return false, fmt.Errorf("downloading %s: %w after %d failed downloads", job.URL, ErrMirrorUnavailable, d.failures.Load())
 	}
 
 	// Ensure destination directory exists
 	if err := os.MkdirAll(filepath.Dir(job.DestPath), 0755); err != nil {
-		return fmt.Errorf("creating directory: %w", err)
+		return false, fmt.Errorf("creating directory: %w", err)
 	}
 
-	resp, err := d.client.Get(job.URL)
+	req, err := http.NewRequestWithContext(ctx, "GET", job.URL, nil)
 	if err != nil {
-		return fmt.Errorf("downloading %s: %w", job.URL, err)
+		return false, fmt.Errorf("downloading %s: %w", job.URL, err)
+	}
+	d.log.Debugf("GET %s", job.URL)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.recordFailure()
+		}
+		return false, fmt.Errorf("downloading %s: %w", job.URL, err)
 	}
 	defer resp.Body.Close()
+	d.log.Debugf("GET %s: HTTP %d", job.URL, resp.StatusCode)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("downloading %s: HTTP %d", job.URL, resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			d.recordFailure()
+		}
+		return false, &StatusError{URL: job.URL, StatusCode: resp.StatusCode}
 	}
 
 	// Write to temp file first, then rename
 	tmpPath := job.DestPath + ".tmp"
 	out, err := os.Create(tmpPath)
 	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
+		return false, fmt.Errorf("creating file: %w", err)
 	}
 
 	_, err = io.Copy(out, resp.Body)
 	out.Close()
 	if err != nil {
 		os.Remove(tmpPath)
-		return fmt.Errorf("writing file: %w", err)
+		return false, fmt.Errorf("writing file: %w", err)
+	}
+
+	if err := verify(job, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return false, fmt.Errorf("downloading %s: %w", job.URL, err)
 	}
 
 	if err := os.Rename(tmpPath, job.DestPath); err != nil {
 		os.Remove(tmpPath)
-		return fmt.Errorf("renaming file: %w", err)
+		return false, fmt.Errorf("renaming file: %w", err)
 	}
 
+	return false, nil
+}
+
+// cached reports whether job.DestPath holds a complete download. Empty
+// files, and files not matching a known size or checksum, are treated as
+// missing so they get fetched again.
+func cached(job Job) bool {
+	return verify(job, job.DestPath) == nil
+}
+
+// Verify checks the file at job.DestPath against the size and checksum
+// expected by job. Empty files never verify.
+func Verify(job Job) error {
+	return verify(job, job.DestPath)
+}
+
+// verify checks the file at path against the size and checksum expected by job.
+func verify(job Job, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("empty file")
+	}
+	if job.Size > 0 && info.Size() != job.Size {
+		return fmt.Errorf("size %d, want %d", info.Size(), job.Size)
+	}
+	if job.SHA256 == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, job.SHA256) {
+		return fmt.Errorf("sha256 %s, want %s", sum, job.SHA256)
+	}
 	return nil
 }
 
@@ -133,3 +275,28 @@ func (d *Downloader) CacheDir() string {
 func (d *Downloader) CachePath(pathname string) string {
 	return filepath.Join(d.cacheDir, pathname)
 }
+
+// TarballURL returns the download URL for a distribution pathname on a mirror.
+// Any path on the mirror (e.g. https://example.com/pub/CPAN) is kept.
+func TarballURL(mirror, pathname string) string {
+	return fmt.Sprintf("%s/authors/id/%s", strings.TrimRight(mirror, "/"), pathname)
+}
+
+// PlanJobs builds download jobs for the given distributions against a mirror,
+// preserving the order of dists. Distributions sharing a pathname are fetched once.
+func (d *Downloader) PlanJobs(mirror string, dists []*dist.Dist) []Job {
+	seen := make(map[string]bool)
+	jobs := make([]Job, 0, len(dists))
+	for _, ds := range dists {
+		if ds.Pathname == "" || seen[ds.Pathname] {
+			continue
+		}
+		seen[ds.Pathname] = true
+		jobs = append(jobs, Job{
+			URL:      TarballURL(mirror, ds.Pathname),
+			DestPath: d.CachePath(ds.Pathname),
+			Source:   "cpan",
+		})
+	}
+	return jobs
+}
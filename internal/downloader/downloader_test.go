@@ -1,11 +1,19 @@
 package downloader
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/snapshot"
 )
 
 func TestDownloader_Download_SingleFile(t *testing.T) {
@@ -78,6 +86,9 @@ func TestDownloader_Download_Cached(t *testing.T) {
 	if requestCount != 0 {
 		t.Errorf("server was called %d times, want 0 (should use cache)", requestCount)
 	}
+	if !results[0].FromCache {
+		t.Error("FromCache = false, want true")
+	}
 
 	data, _ := os.ReadFile(destPath)
 	if string(data) != "cached" {
@@ -85,6 +96,79 @@ func TestDownloader_Download_Cached(t *testing.T) {
 	}
 }
 
+func TestDownloader_Download_InvalidCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		cached []byte
+		job    Job
+	}{
+		{
+			name:   "zero-byte file",
+			cached: []byte{},
+		},
+		{
+			name:   "size mismatch",
+			cached: []byte("partial"),
+			job:    Job{Size: int64(len("fresh content"))},
+		},
+		{
+			name:   "checksum mismatch",
+			cached: []byte("corrupt content"),
+			job:    Job{SHA256: "ed5eb3df1c9a9bce5a0ee4e2e4ec5d70c3df4d8d3b9f6a63ec31d63a8ab2c6ec"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: leave an invalid file at the destination
+			requestCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestCount++
+				w.Write([]byte("fresh content"))
+			}))
+			defer server.Close()
+
+			cacheDir := t.TempDir()
+			job := tt.job
+			job.URL = server.URL + "/dist.tar.gz"
+			job.DestPath = filepath.Join(cacheDir, "dist.tar.gz")
+			job.Source = "cpan"
+			if err := os.WriteFile(job.DestPath, tt.cached, 0644); err != nil {
+				t.Fatal(err)
+			}
+			dl := NewDownloader(1, cacheDir)
+
+			// Act
+			results := dl.Download([]Job{job})
+
+			// Assert
+			if requestCount != 1 {
+				t.Errorf("server was called %d times, want 1 (invalid cache should be re-fetched)", requestCount)
+			}
+			if results[0].FromCache {
+				t.Error("FromCache = true, want false")
+			}
+			data, _ := os.ReadFile(job.DestPath)
+			if job.SHA256 != "" {
+				// The fresh content does not match the bogus checksum either.
+				if results[0].Error == nil {
+					t.Error("Download() error = nil, want checksum mismatch")
+				}
+				if string(data) != string(tt.cached) {
+					t.Errorf("file content = %q, want original left untouched", data)
+				}
+				return
+			}
+			if results[0].Error != nil {
+				t.Errorf("Download() error = %v", results[0].Error)
+			}
+			if string(data) != "fresh content" {
+				t.Errorf("file content = %q, want %q", data, "fresh content")
+			}
+		})
+	}
+}
+
 func TestDownloader_Download_HTTPError(t *testing.T) {
 	// Arrange
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -105,7 +189,66 @@ func TestDownloader_Download_HTTPError(t *testing.T) {
 
 	// Assert
 	if results[0].Error == nil {
-		t.Error("Download() should return error for 404")
+		t.Fatal("Download() should return error for 404")
+	}
+	var statusErr *StatusError
+	if !errors.As(results[0].Error, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("error = %v, want StatusError with HTTP 404", results[0].Error)
+	}
+}
+
+func TestDownloader_SetFailFastThreshold(t *testing.T) {
+	tests := []struct {
+		name            string
+		threshold       int
+		status          int
+		wantRequests    int64
+		wantUnavailable int
+	}{
+		{name: "mirror down aborts early", threshold: 3, status: http.StatusInternalServerError, wantRequests: 3, wantUnavailable: 17},
+		{name: "no threshold tries every job", threshold: 0, status: http.StatusInternalServerError, wantRequests: 20},
+		{name: "missing files do not count", threshold: 3, status: http.StatusNotFound, wantRequests: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: a mirror answering every request with the same error
+			var requests atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cacheDir := t.TempDir()
+			dl := NewDownloader(1, cacheDir)
+			dl.SetFailFastThreshold(tt.threshold)
+			var jobs []Job
+			for i := range 20 {
+				name := fmt.Sprintf("Dist-%d.tar.gz", i)
+				jobs = append(jobs, Job{URL: server.URL + "/" + name, DestPath: filepath.Join(cacheDir, name), Source: "cpan"})
+			}
+
+			// Act: in two calls, as the resolver downloads one tarball at a time
+			results := append(dl.Download(jobs[:10]), dl.Download(jobs[10:])...)
+
+			// Assert
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("mirror got %d requests, want %d", got, tt.wantRequests)
+			}
+			unavailable := 0
+			for _, result := range results {
+				if result.Error == nil {
+					t.Fatalf("Download(%s) succeeded, want an error", result.Job.URL)
+				}
+				if errors.Is(result.Error, ErrMirrorUnavailable) {
+					unavailable++
+				}
+			}
+			if unavailable != tt.wantUnavailable {
+				t.Errorf("%d downloads failed with ErrMirrorUnavailable, want %d", unavailable, tt.wantUnavailable)
+			}
+		})
 	}
 }
 
@@ -175,6 +318,43 @@ func TestDownloader_Download_CreatesSubdirectories(t *testing.T) {
 	}
 }
 
+func TestDownloader_SetHTTPClient(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	rt := &recordingTransport{}
+	cacheDir := t.TempDir()
+	dl := NewDownloader(1, cacheDir)
+	dl.SetHTTPClient(&http.Client{Transport: rt})
+
+	// Act
+	results := dl.Download([]Job{{URL: server.URL + "/dist.tar.gz", DestPath: filepath.Join(cacheDir, "dist.tar.gz"), Source: "cpan"}})
+
+	// Assert
+	if results[0].Error != nil {
+		t.Fatalf("Download() error = %v", results[0].Error)
+	}
+	if len(rt.urls) != 1 || rt.urls[0] != server.URL+"/dist.tar.gz" {
+		t.Errorf("requests through custom client = %v", rt.urls)
+	}
+}
+
+// recordingTransport records the URL of every request it forwards.
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.urls = append(rt.urls, req.URL.String())
+	rt.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
 func TestDownloader_CachePath(t *testing.T) {
 	dl := NewDownloader(1, "/home/user/.yacm/cache")
 
@@ -185,3 +365,111 @@ func TestDownloader_CachePath(t *testing.T) {
 		t.Errorf("CachePath() = %q, want %q", got, want)
 	}
 }
+
+func TestDownloader_PlanJobs(t *testing.T) {
+	// Arrange
+	input := `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  JSON-2.0
+    pathname: M/MA/MAKAMAKA/JSON-2.0.tar.gz
+    provides:
+      JSON 2.0
+  Moo-2.0
+    pathname: H/HA/HAARG/Moo-2.0.tar.gz
+    provides:
+      Moo 2.0
+`
+	dists, err := snapshot.NewParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	dl := NewDownloader(1, "/cache")
+
+	// Act
+	jobs := dl.PlanJobs("https://cpan.example.org/", dists)
+
+	// Assert
+	want := []Job{
+		{
+			URL:      "https://cpan.example.org/authors/id/M/MA/MAKAMAKA/JSON-2.0.tar.gz",
+			DestPath: "/cache/M/MA/MAKAMAKA/JSON-2.0.tar.gz",
+			Source:   "cpan",
+		},
+		{
+			URL:      "https://cpan.example.org/authors/id/H/HA/HAARG/Moo-2.0.tar.gz",
+			DestPath: "/cache/H/HA/HAARG/Moo-2.0.tar.gz",
+			Source:   "cpan",
+		},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("got %d jobs, want %d", len(jobs), len(want))
+	}
+	for i := range want {
+		if jobs[i] != want[i] {
+			t.Errorf("job %d = %+v, want %+v", i, jobs[i], want[i])
+		}
+	}
+}
+
+func TestDownloader_Download_FromCache(t *testing.T) {
+	// Arrange: Mock mirror recording requested paths
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		w.Write([]byte("tarball " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dl := NewDownloader(2, t.TempDir())
+	jobs := dl.PlanJobs(server.URL, []*dist.Dist{
+		{Name: "JSON-2.0", Pathname: "M/MA/MAKAMAKA/JSON-2.0.tar.gz"},
+		{Name: "Moo-2.0", Pathname: "H/HA/HAARG/Moo-2.0.tar.gz"},
+	})
+
+	// Act
+	first := dl.Download(jobs)
+	second := dl.Download(jobs)
+
+	// Assert
+	for _, path := range []string{"/authors/id/M/MA/MAKAMAKA/JSON-2.0.tar.gz", "/authors/id/H/HA/HAARG/Moo-2.0.tar.gz"} {
+		if !requested[path] {
+			t.Errorf("mirror did not receive request for %s", path)
+		}
+	}
+	for _, r := range first {
+		if r.Error != nil || r.FromCache {
+			t.Errorf("first run %s: error = %v, FromCache = %v, want fetched", r.Job.URL, r.Error, r.FromCache)
+		}
+		if _, err := os.Stat(r.Job.DestPath); err != nil {
+			t.Errorf("%s not cached: %v", r.Job.DestPath, err)
+		}
+	}
+	for _, r := range second {
+		if r.Error != nil || !r.FromCache {
+			t.Errorf("second run %s: error = %v, FromCache = %v, want cached", r.Job.URL, r.Error, r.FromCache)
+		}
+	}
+}
+
+func TestTarballURL(t *testing.T) {
+	tests := []struct {
+		mirror string
+		want   string
+	}{
+		{"https://cpan.metacpan.org", "https://cpan.metacpan.org/authors/id/H/HA/HAARG/Moo-2.0.tar.gz"},
+		{"https://cpan.metacpan.org/", "https://cpan.metacpan.org/authors/id/H/HA/HAARG/Moo-2.0.tar.gz"},
+		{"https://mirror.example.com/pub/CPAN", "https://mirror.example.com/pub/CPAN/authors/id/H/HA/HAARG/Moo-2.0.tar.gz"},
+		{"https://mirror.example.com/pub/CPAN//", "https://mirror.example.com/pub/CPAN/authors/id/H/HA/HAARG/Moo-2.0.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mirror, func(t *testing.T) {
+			if got := TarballURL(tt.mirror, "H/HA/HAARG/Moo-2.0.tar.gz"); got != tt.want {
+				t.Errorf("TarballURL(%q) = %q, want %q", tt.mirror, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,18 +2,26 @@ package extractor
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+var gzipMagic = []byte{0x1f, 0x8b}
+
 // FlexVersion handles JSON/YAML values that can be string or number.
 type FlexVersion string
 
@@ -49,10 +57,39 @@ func (v *FlexVersion) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// SpecVersion is the version of a meta-spec block such as {"version": 2}.
+type SpecVersion string
+
+func (v *SpecVersion) UnmarshalJSON(data []byte) error {
+	var spec struct {
+		Version FlexVersion `json:"version"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		*v = ""
+		return nil
+	}
+	*v = SpecVersion(spec.Version)
+	return nil
+}
+
+func (v *SpecVersion) UnmarshalYAML(node *yaml.Node) error {
+	var spec struct {
+		Version FlexVersion `yaml:"version"`
+	}
+	if err := node.Decode(&spec); err != nil {
+		*v = ""
+		return nil
+	}
+	*v = SpecVersion(spec.Version)
+	return nil
+}
+
 // XAlienfileRequires represents the requirements section of x_alienfile.
+// Share and System are normally module => version maps but are decoded
+// loosely, since x_ fields follow no schema.
 type XAlienfileRequires struct {
-	Share  map[string]interface{} `json:"share" yaml:"share"`
-	System map[string]interface{} `json:"system" yaml:"system"`
+	Share  interface{} `json:"share" yaml:"share"`
+	System interface{} `json:"system" yaml:"system"`
 }
 
 // XAlienfile represents the x_alienfile section in META files.
@@ -67,12 +104,58 @@ type MetaFile struct {
 	Provides     map[string]ProvidesEntry          `json:"provides" yaml:"provides"`
 	Prereqs      map[string]map[string]interface{} `json:"prereqs" yaml:"prereqs"`
 	Requirements map[string]string                 `json:"-" yaml:"-"` // Flattened requirements
+	Develop      map[string]string                 `json:"-" yaml:"-"` // Flattened develop-phase requirements
+	Phases       map[string]string                 `json:"-" yaml:"-"` // Phase declaring each of Requirements, e.g. "build"
 	XAlienfile   XAlienfile                        `json:"x_alienfile" yaml:"x_alienfile"`
+	MetaSpec     SpecVersion                       `json:"meta-spec" yaml:"meta-spec"`
+	GeneratedBy  string                            `json:"generated_by" yaml:"generated_by"`
+
+	// DynamicConfig is the dynamic_config flag as given, e.g. 1, "0" or
+	// true; nil if META omits it.
+	DynamicConfig interface{} `json:"dynamic_config" yaml:"dynamic_config"`
+
+	// SerializationBackend names the module that wrote the file,
+	// e.g. "JSON::PP version 4.07".
+	SerializationBackend string `json:"x_serialization_backend" yaml:"x_serialization_backend"`
+
+	// Warnings lists prerequisite sections whose shape was unexpected and
+	// that were read on a best-effort basis or skipped, and a failed
+	// configure run that fell back to the static META.
+	Warnings []string `json:"-" yaml:"-"`
+
+	// ConfigureSkipped is set when configure would have run for a dynamic
+	// release but the extractor is offline, or the metadata came from MetaCPAN for a
+	// release with dynamic_config, so dynamic prerequisites may be missing.
+	ConfigureSkipped bool `json:"-" yaml:"-"`
+
+	// Old META 1.x format fields, as in MYMETA.yml written by Module::Build.
+	// Versions are FlexVersion so that unquoted ones like 1.10 keep their
+	// trailing zeros.
+	Requires          map[string]FlexVersion `json:"requires" yaml:"requires"`
+	BuildRequires     map[string]FlexVersion `json:"build_requires" yaml:"build_requires"`
+	ConfigureRequires map[string]FlexVersion `json:"configure_requires" yaml:"configure_requires"`
+	Recommends        map[string]FlexVersion `json:"recommends" yaml:"recommends"`
+}
 
-	// Old META 1.x format fields
-	Requires          map[string]interface{} `json:"requires" yaml:"requires"`
-	BuildRequires     map[string]interface{} `json:"build_requires" yaml:"build_requires"`
-	ConfigureRequires map[string]interface{} `json:"configure_requires" yaml:"configure_requires"`
+// Dynamic reports whether configure may change the prerequisites, that is
+// whether dynamic_config is set or, as the spec defaults it, missing.
+func (m *MetaFile) Dynamic() bool {
+	switch v := m.DynamicConfig.(type) {
+	case nil:
+		return true
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case string:
+		switch strings.TrimSpace(v) {
+		case "", "0", "false":
+			return false
+		}
+	}
+	return true
 }
 
 // ProvidesEntry represents a module provided by the distribution.
@@ -84,46 +167,117 @@ type ProvidesEntry struct {
 // Extractor extracts META files from CPAN tarballs.
 type Extractor struct {
 	dockerImage string // If set, run configure inside this Docker image
+	mirror      string // If set, network access during configure uses this mirror
+
+	includeRecommends bool
+	includeSuggests   bool
+	customPhases      bool
+	offline           bool
+	keepBuild         bool
+
+	// configureSlots bounds concurrent configure runs; nil means unbounded
+	configureSlots chan struct{}
+
+	overrides map[string]ConfigureOverride // by distribution name, see SetConfigureOverrides
+}
+
+// ConfigureOverride customizes the configure run of one distribution.
+type ConfigureOverride struct {
+	Args []string          `yaml:"args"` // appended to "perl Makefile.PL" or "perl Build.PL"
+	Env  map[string]string `yaml:"env"`  // added to the configure environment
 }
 
 // NewExtractor creates a new extractor that runs configure on the host.
-func NewExtractor() *Extractor {
-	return &Extractor{}
+// If mirror is non-empty, configure is pointed at it for any CPAN access.
+func NewExtractor(mirror string) *Extractor {
+	return &Extractor{mirror: mirror}
 }
 
 // NewDockerExtractor creates an extractor that runs configure inside Docker.
 // This ensures consistent dynamic prereq resolution regardless of host system.
-func NewDockerExtractor(image string) *Extractor {
-	return &Extractor{dockerImage: image}
+func NewDockerExtractor(image, mirror string) *Extractor {
+	return &Extractor{dockerImage: image, mirror: mirror}
+}
+
+// SetIncludeRecommends folds "recommends" prereqs into Requirements.
+// By default only "requires" are included, matching carton install.
+func (e *Extractor) SetIncludeRecommends(include bool) {
+	e.includeRecommends = include
+}
+
+// SetIncludeSuggests folds "suggests" prereqs into Requirements.
+func (e *Extractor) SetIncludeSuggests(include bool) {
+	e.includeSuggests = include
+}
+
+// SetIncludeCustomPhases folds prereqs declared under a phase outside the
+// CPAN::Meta::Spec ones, e.g. "x_runtime", into Requirements as runtime
+// prereqs. Either way such prereqs are named in Warnings.
+func (e *Extractor) SetIncludeCustomPhases(include bool) {
+	e.customPhases = include
+}
+
+// SetOffline disables running configure, which may access the network.
+// Distributions are then described by their static META files.
+func (e *Extractor) SetOffline(offline bool) {
+	e.offline = offline
+}
+
+// SetKeepBuild keeps the directory a failed configure ran in, instead of
+// removing it, and names it in the error so it can be inspected by hand.
+func (e *Extractor) SetKeepBuild(keep bool) {
+	e.keepBuild = keep
+}
+
+// SetConfigureJobs limits how many configure scripts run at once across
+// all extract calls on e. Zero or less removes the limit.
+func (e *Extractor) SetConfigureJobs(n int) {
+	if n <= 0 {
+		e.configureSlots = nil
+		return
+	}
+	e.configureSlots = make(chan struct{}, n)
+}
+
+// SetConfigureOverrides sets per-distribution configure arguments and
+// environment, keyed by distribution name with or without version, e.g.
+// "Net-SSLeay" or "Net-SSLeay-1.92". A versioned key takes precedence.
+func (e *Extractor) SetConfigureOverrides(overrides map[string]ConfigureOverride) {
+	e.overrides = overrides
 }
 
+// override returns the configure override for the distribution extracted
+// to distDir, whose name is the tarball's top-level directory.
+func (e *Extractor) override(distDir string) ConfigureOverride {
+	name := filepath.Base(distDir)
+	if o, ok := e.overrides[name]; ok {
+		return o
+	}
+	return e.overrides[versionSuffix.ReplaceAllString(name, "")]
+}
+
+var versionSuffix = regexp.MustCompile(`-v?\d[\w.]*$`)
+
 // Extract reads META.json or META.yml from a tarball (without running configure).
 func (e *Extractor) Extract(tarballPath string) (*MetaFile, error) {
-	return e.extractMeta(tarballPath, false)
+	return e.extractMeta(context.Background(), tarballPath, false)
 }
 
 // ExtractWithConfigure extracts and runs perl Makefile.PL to get MYMETA.json
-// with resolved dynamic prerequisites. Falls back to META.json if configure fails.
-func (e *Extractor) ExtractWithConfigure(tarballPath string) (*MetaFile, error) {
-	return e.extractMeta(tarballPath, true)
+// with resolved dynamic prerequisites. Falls back to META.json if configure
+// fails, unless ctx is done, which kills the configure run.
+func (e *Extractor) ExtractWithConfigure(ctx context.Context, tarballPath string) (*MetaFile, error) {
+	return e.extractMeta(ctx, tarballPath, true)
 }
 
 // extractMeta reads META files from a tarball.
 // If withConfigure is true, it prefers MYMETA.json and will run configure if needed.
-func (e *Extractor) extractMeta(tarballPath string, withConfigure bool) (*MetaFile, error) {
-	file, err := os.Open(tarballPath)
+func (e *Extractor) extractMeta(ctx context.Context, tarballPath string, withConfigure bool) (*MetaFile, error) {
+	tarReader, closeFn, err := openTarball(tarballPath)
 	if err != nil {
-		return nil, fmt.Errorf("opening tarball: %w", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	gzReader, err := gzip.NewReader(file)
-	if err != nil {
-		return nil, fmt.Errorf("decompressing tarball: %w", err)
-	}
-	defer gzReader.Close()
-
-	tarReader := tar.NewReader(gzReader)
+	defer closeFn()
 
 	var metaJSON, metaYML, mymetaJSON, mymetaYML []byte
 	var hasMakefilePL, hasBuildPL bool
@@ -136,6 +290,9 @@ func (e *Extractor) extractMeta(tarballPath string, withConfigure bool) (*MetaFi
 		if err != nil {
 			return nil, fmt.Errorf("reading tarball: %w", err)
 		}
+		if !isFileOrDir(header) {
+			continue
+		}
 
 		name := filepath.Base(header.Name)
 		// Only look at top-level files (one directory deep)
@@ -172,6 +329,9 @@ func (e *Extractor) extractMeta(tarballPath string, withConfigure bool) (*MetaFi
 		}
 	}
 
+	configureSkipped := false
+	var configureErr error
+
 	// If withConfigure is true, prefer MYMETA files
 	if withConfigure {
 		// If we have MYMETA files in the tarball, use them
@@ -184,33 +344,59 @@ func (e *Extractor) extractMeta(tarballPath string, withConfigure bool) (*MetaFi
 
 		// If we have a configure script, run it to generate MYMETA
 		if hasMakefilePL || hasBuildPL {
-			meta, err := e.runConfigure(tarballPath, hasMakefilePL)
-			if err == nil {
-				return meta, nil
+			if e.offline {
+				configureSkipped = true
+			} else {
+				meta, err := e.runConfigure(ctx, tarballPath, hasMakefilePL)
+				if err == nil {
+					return meta, nil
+				}
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, ctxErr
+				}
+				// Fall back to META if configure fails
+				configureErr = err
 			}
-			// Fall back to META if configure fails
 		}
 	}
 
 	// Fall back to META.json or META.yml
-	if metaJSON != nil {
-		return e.parseJSON(metaJSON)
+	var meta *MetaFile
+	switch {
+	case metaJSON != nil:
+		meta, err = e.parseJSON(metaJSON)
+	case metaYML != nil:
+		meta, err = e.parseYAML(metaYML)
+	}
+	if meta != nil {
+		// With dynamic_config off the static META is complete
+		meta.ConfigureSkipped = configureSkipped && meta.Dynamic()
+		if configureErr != nil {
+			meta.Warnings = append(meta.Warnings, fmt.Sprintf("configure failed (%v), used static META; dynamic prerequisites may be missing", configureErr))
+		}
+		return meta, nil
 	}
-	if metaYML != nil {
-		return e.parseYAML(metaYML)
+	if err != nil {
+		return nil, err
 	}
 
 	return nil, fmt.Errorf("no META.json or META.yml found in tarball")
 }
 
 // runConfigure extracts tarball, runs configure, and parses MYMETA.json
-func (e *Extractor) runConfigure(tarballPath string, hasMakefilePL bool) (*MetaFile, error) {
+func (e *Extractor) runConfigure(ctx context.Context, tarballPath string, hasMakefilePL bool) (meta *MetaFile, err error) {
 	// Create temp directory
 	tmpDir, err := os.MkdirTemp("", "yacm-configure-*")
 	if err != nil {
 		return nil, fmt.Errorf("creating temp dir: %w", err)
 	}
-	defer os.RemoveAll(tmpDir)
+	defer func() {
+		if err != nil && e.keepBuild {
+			err = fmt.Errorf("%w (build directory kept in %s)", err, tmpDir)
+			return
+		}
+		os.RemoveAll(tmpDir)
+	}()
 
 	// Extract tarball
 	distDir, err := e.extractTarball(tarballPath, tmpDir)
@@ -224,24 +410,18 @@ func (e *Extractor) runConfigure(tarballPath string, hasMakefilePL bool) (*MetaF
 		configScript = "Makefile.PL"
 	}
 
-	// Run configure (in Docker or on host)
-	var cmd *exec.Cmd
-	if e.dockerImage != "" {
-		// Run inside Docker container
-		// Mount the dist directory and run perl Makefile.PL
-		cmd = exec.Command("docker", "run", "--rm",
-			"-v", distDir+":/work",
-			"-w", "/work",
-			e.dockerImage,
-			"perl", configScript)
-	} else {
-		// Run on host
-		cmd = exec.Command("perl", configScript)
-		cmd.Dir = distDir
-	}
+	cmd := e.configureCommand(ctx, distDir, configScript)
 	cmd.Stdout = io.Discard
 	cmd.Stderr = io.Discard
 
+	if e.configureSlots != nil {
+		select {
+		case e.configureSlots <- struct{}{}:
+			defer func() { <-e.configureSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("running configure: %w", err)
 	}
@@ -260,21 +440,58 @@ func (e *Extractor) runConfigure(tarballPath string, hasMakefilePL bool) (*MetaF
 	return nil, fmt.Errorf("no MYMETA file generated")
 }
 
-// extractTarball extracts a tarball to destDir and returns the extracted directory path
-func (e *Extractor) extractTarball(tarballPath, destDir string) (string, error) {
-	file, err := os.Open(tarballPath)
-	if err != nil {
-		return "", err
+// configureCommand builds the command running configScript in distDir,
+// either inside Docker or on the host.
+func (e *Extractor) configureCommand(ctx context.Context, distDir, configScript string) *exec.Cmd {
+	env := e.configureEnv()
+	override := e.override(distDir)
+	keys := make([]string, 0, len(override.Env))
+	for k := range override.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+override.Env[k])
+	}
+	perlArgs := append([]string{configScript}, override.Args...)
+
+	if e.dockerImage != "" {
+		// Mount the dist directory and run perl Makefile.PL inside the container
+		args := []string{"run", "--rm", "-v", distDir + ":/work", "-w", "/work"}
+		for _, kv := range env {
+			args = append(args, "-e", kv)
+		}
+		args = append(args, e.dockerImage, "perl")
+		args = append(args, perlArgs...)
+		return exec.CommandContext(ctx, "docker", args...)
+	}
+
+	cmd := exec.CommandContext(ctx, "perl", perlArgs...)
+	cmd.Dir = distDir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// configureEnv returns environment settings that make any CPAN client
+// bootstrapped by configure (cpanm, Module::Install) use the configured mirror.
+func (e *Extractor) configureEnv() []string {
+	if e.mirror == "" {
+		return nil
 	}
-	defer file.Close()
+	opts := strings.TrimSpace(os.Getenv("PERL_CPANM_OPT") + " --mirror " + e.mirror + " --mirror-only")
+	return []string{"PERL_CPANM_OPT=" + opts}
+}
 
-	gzReader, err := gzip.NewReader(file)
+// extractTarball extracts a tarball to destDir and returns the extracted directory path
+func (e *Extractor) extractTarball(tarballPath, destDir string) (string, error) {
+	tarReader, closeFn, err := openTarball(tarballPath)
 	if err != nil {
 		return "", err
 	}
-	defer gzReader.Close()
+	defer closeFn()
 
-	tarReader := tar.NewReader(gzReader)
 	var rootDir string
 
 	for {
@@ -285,6 +502,9 @@ func (e *Extractor) extractTarball(tarballPath, destDir string) (string, error)
 		if err != nil {
 			return "", err
 		}
+		if !isFileOrDir(header) {
+			continue
+		}
 
 		// Get the root directory name from the first entry
 		parts := strings.SplitN(header.Name, "/", 2)
@@ -318,6 +538,101 @@ func (e *Extractor) extractTarball(tarballPath, destDir string) (string, error)
 	return filepath.Join(destDir, rootDir), nil
 }
 
+// isFileOrDir reports whether a tar entry is a regular file or directory.
+// Everything else is skipped: links, devices, and in particular the global
+// PAX headers written by git archive, which tar.Reader returns as entries
+// named e.g. "pax_global_header" and which would otherwise be taken for the
+// distribution's top-level directory.
+func isFileOrDir(header *tar.Header) bool {
+	return header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeDir
+}
+
+// openTarball opens a tarball, gzip-compressed or plain, and returns a tar
+// reader over it along with a function that releases the underlying file.
+func openTarball(tarballPath string) (*tar.Reader, func() error, error) {
+	file, err := os.Open(tarballPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening tarball: %w", err)
+	}
+
+	br := bufio.NewReader(file)
+	if magic, _ := br.Peek(2); !bytes.Equal(magic, gzipMagic) {
+		return tar.NewReader(br), file.Close, nil
+	}
+
+	gzReader, err := gzip.NewReader(br)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("decompressing tarball: %w", err)
+	}
+	gzReader.Multistream(false)
+
+	closeFn := func() error {
+		gzReader.Close()
+		return file.Close()
+	}
+	return tar.NewReader(&memberReader{br: br, gz: gzReader}), closeFn, nil
+}
+
+// VerifyTarball reads every entry of the archive at tarballPath, returning
+// an error if it is not a complete, readable tar file (gzip-compressed or
+// plain).
+func VerifyTarball(tarballPath string) error {
+	tr, closeFn, err := openTarball(tarballPath)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	entries := 0
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tarball: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("reading tarball: %w", err)
+		}
+		entries++
+	}
+	if entries == 0 {
+		return fmt.Errorf("reading tarball: no entries")
+	}
+	return nil
+}
+
+// memberReader reads a gzip stream one member at a time so archives split
+// across several gzip members are read in full, while trailing bytes after
+// the last member that are not a gzip header are treated as end of stream.
+type memberReader struct {
+	br *bufio.Reader
+	gz *gzip.Reader
+}
+
+func (m *memberReader) Read(p []byte) (int, error) {
+	for {
+		n, err := m.gz.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+
+		// Current member is exhausted, continue with the next one if present
+		if err := m.gz.Reset(m.br); err != nil {
+			if err == io.EOF || errors.Is(err, gzip.ErrHeader) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		m.gz.Multistream(false)
+	}
+}
+
 func (e *Extractor) parseJSON(data []byte) (*MetaFile, error) {
 	var meta MetaFile
 	if err := json.Unmarshal(data, &meta); err != nil {
@@ -336,56 +651,169 @@ func (e *Extractor) parseYAML(data []byte) (*MetaFile, error) {
 	return &meta, nil
 }
 
+// Flatten computes Requirements and Develop from the prereqs of metadata
+// that was not read from a tarball, such as MetaCPAN release data.
+func (e *Extractor) Flatten(meta *MetaFile) {
+	e.flattenPrereqs(meta)
+}
+
 func (e *Extractor) flattenPrereqs(meta *MetaFile) {
 	meta.Requirements = make(map[string]string)
+	meta.Phases = make(map[string]string)
+	// Requirements are never overwritten, so the first phase adding a
+	// module is the one recorded
+	recordPhase := func(phase string) {
+		for mod := range meta.Requirements {
+			if _, ok := meta.Phases[mod]; !ok {
+				meta.Phases[mod] = phase
+			}
+		}
+	}
 
 	// Handle META 2.0 format (prereqs)
-	// Include requires, recommends, and suggests to match Carmel behavior
+	// recommends and suggests are opt-in; Carmel includes them, carton does not
 	phases := []string{"runtime", "configure", "build"}
-	depTypes := []string{"requires", "recommends", "suggests"}
+	depTypes := []string{"requires"}
+	if e.includeRecommends {
+		depTypes = append(depTypes, "recommends")
+	}
+	if e.includeSuggests {
+		depTypes = append(depTypes, "suggests")
+	}
 	for _, phase := range phases {
 		if phaseReqs, ok := meta.Prereqs[phase]; ok {
 			for _, depType := range depTypes {
 				if deps, ok := phaseReqs[depType]; ok {
-					if reqMap, ok := deps.(map[string]interface{}); ok {
-						for mod, ver := range reqMap {
-							if meta.Requirements[mod] == "" {
-								meta.Requirements[mod] = versionString(ver)
-							}
-						}
-					}
+					addPrereqs(meta, meta.Requirements, deps, "prereqs."+phase+"."+depType)
 				}
 			}
 		}
+		recordPhase(phase)
 	}
 
-	// Handle META 1.x format (requires, build_requires, configure_requires)
-	for mod, ver := range meta.Requires {
-		if meta.Requirements[mod] == "" {
-			meta.Requirements[mod] = versionString(ver)
+	// Prereqs under a nonstandard phase, often a typo, would otherwise
+	// vanish without a trace
+	for _, phase := range customPhases(meta.Prereqs) {
+		deps := make(map[string]string)
+		for _, depType := range depTypes {
+			if d, ok := meta.Prereqs[phase][depType]; ok {
+				addPrereqs(meta, deps, d, "prereqs."+phase+"."+depType)
+			}
+		}
+		if len(deps) == 0 {
+			continue
+		}
+		modules := make([]string, 0, len(deps))
+		for mod := range deps {
+			modules = append(modules, mod)
 		}
+		sort.Strings(modules)
+		if !e.customPhases {
+			meta.Warnings = append(meta.Warnings, fmt.Sprintf("prereqs.%s: nonstandard phase, ignored %s", phase, strings.Join(modules, ", ")))
+			continue
+		}
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("prereqs.%s: nonstandard phase, resolving %s as runtime prereqs", phase, strings.Join(modules, ", ")))
+		for mod, ver := range deps {
+			if meta.Requirements[mod] == "" {
+				meta.Requirements[mod] = ver
+			}
+		}
+		recordPhase("runtime")
 	}
-	for mod, ver := range meta.BuildRequires {
-		if meta.Requirements[mod] == "" {
-			meta.Requirements[mod] = versionString(ver)
+
+	// Develop prereqs are kept apart so they are only resolved on request
+	meta.Develop = make(map[string]string)
+	if phaseReqs, ok := meta.Prereqs["develop"]; ok {
+		for _, depType := range depTypes {
+			if deps, ok := phaseReqs[depType]; ok {
+				addPrereqs(meta, meta.Develop, deps, "prereqs.develop."+depType)
+			}
 		}
 	}
-	for mod, ver := range meta.ConfigureRequires {
-		if meta.Requirements[mod] == "" {
-			meta.Requirements[mod] = versionString(ver)
+
+	// Handle META 1.x format (requires, build_requires, configure_requires)
+	addFlatPrereqs(meta.Requirements, meta.Requires)
+	recordPhase("runtime")
+	addFlatPrereqs(meta.Requirements, meta.BuildRequires)
+	recordPhase("build")
+	addFlatPrereqs(meta.Requirements, meta.ConfigureRequires)
+	recordPhase("configure")
+	if e.includeRecommends {
+		addFlatPrereqs(meta.Requirements, meta.Recommends)
+		recordPhase("runtime")
+	}
+
+	// Handle x_alienfile requirements (for Alien:: modules), needed to
+	// build the library
+	addPrereqs(meta, meta.Requirements, meta.XAlienfile.Requires.Share, "x_alienfile.requires.share")
+	addPrereqs(meta, meta.Requirements, meta.XAlienfile.Requires.System, "x_alienfile.requires.system")
+	recordPhase("build")
+}
+
+// standardPhases are the prereq phases of CPAN::Meta::Spec. test prereqs
+// are never resolved, like carton install.
+var standardPhases = map[string]bool{"runtime": true, "configure": true, "build": true, "test": true, "develop": true}
+
+// customPhases returns the sorted phases of prereqs outside standardPhases.
+func customPhases(prereqs map[string]map[string]interface{}) []string {
+	var phases []string
+	for phase := range prereqs {
+		if !standardPhases[phase] {
+			phases = append(phases, phase)
 		}
 	}
+	sort.Strings(phases)
+	return phases
+}
 
-	// Handle x_alienfile requirements (for Alien:: modules)
-	for mod, ver := range meta.XAlienfile.Requires.Share {
-		if meta.Requirements[mod] == "" {
-			meta.Requirements[mod] = versionString(ver)
+// addFlatPrereqs merges the META 1.x module => version map deps into dst,
+// keeping versions already present. An empty version means any.
+func addFlatPrereqs(dst map[string]string, deps map[string]FlexVersion) {
+	for mod, ver := range deps {
+		if dst[mod] != "" {
+			continue
 		}
+		if ver == "" {
+			ver = "0"
+		}
+		dst[mod] = string(ver)
 	}
-	for mod, ver := range meta.XAlienfile.Requires.System {
-		if meta.Requirements[mod] == "" {
-			meta.Requirements[mod] = versionString(ver)
+}
+
+// addPrereqs merges the module => version map deps into dst, keeping versions
+// already present. A list of module names, or a single one, is accepted at
+// version 0; any other shape is skipped. Both cases are recorded in
+// meta.Warnings under the name field.
+func addPrereqs(meta *MetaFile, dst map[string]string, deps interface{}, field string) {
+	switch v := deps.(type) {
+	case nil:
+	case map[string]interface{}:
+		for mod, ver := range v {
+			if dst[mod] == "" {
+				dst[mod] = versionString(ver)
+			}
+		}
+	case []interface{}:
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("%s is a list, expected a map of module => version", field))
+		for _, item := range v {
+			switch it := item.(type) {
+			case string:
+				if dst[it] == "" {
+					dst[it] = "0"
+				}
+			case map[string]interface{}:
+				addPrereqs(meta, dst, it, field)
+			default:
+				meta.Warnings = append(meta.Warnings, fmt.Sprintf("%s: skipped entry of type %T", field, item))
+			}
 		}
+	case string:
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("%s is a string, expected a map of module => version", field))
+		if dst[v] == "" {
+			dst[v] = "0"
+		}
+	default:
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("%s: skipped value of type %T, expected a map of module => version", field, deps))
 	}
 }
 
@@ -2,9 +2,17 @@ package extractor
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -66,7 +74,7 @@ func TestExtractor_Extract_MetaJSON(t *testing.T) {
 		"JSON-4.10/META.json": metaJSON,
 	})
 
-	ext := NewExtractor()
+	ext := NewExtractor("")
 
 	// Act
 	meta, err := ext.Extract(tarballPath)
@@ -114,7 +122,7 @@ prereqs:
 		"Moo-2.005005/META.yml": metaYML,
 	})
 
-	ext := NewExtractor()
+	ext := NewExtractor("")
 
 	// Act
 	meta, err := ext.Extract(tarballPath)
@@ -148,7 +156,7 @@ version: 2.0
 		"Dist-1.0/META.yml":  metaYML,
 	})
 
-	ext := NewExtractor()
+	ext := NewExtractor("")
 
 	// Act
 	meta, err := ext.Extract(tarballPath)
@@ -169,7 +177,7 @@ func TestExtractor_Extract_NoMeta(t *testing.T) {
 		"Dist-1.0/lib/Dist.pm": "package Dist; 1;",
 	})
 
-	ext := NewExtractor()
+	ext := NewExtractor("")
 
 	// Act
 	_, err := ext.Extract(tarballPath)
@@ -188,7 +196,7 @@ func TestExtractor_Extract_NestedMetaIgnored(t *testing.T) {
 		"Dist-1.0/subdir/META.json": metaJSON,
 	})
 
-	ext := NewExtractor()
+	ext := NewExtractor("")
 
 	// Act
 	_, err := ext.Extract(tarballPath)
@@ -249,7 +257,7 @@ func TestExtractor_Extract_XAlienfile(t *testing.T) {
 		"Alien-Libxml2-0.20/META.json": metaJSON,
 	})
 
-	ext := NewExtractor()
+	ext := NewExtractor("")
 
 	// Act
 	meta, err := ext.Extract(tarballPath)
@@ -278,6 +286,55 @@ func TestExtractor_Extract_XAlienfile(t *testing.T) {
 	}
 }
 
+func TestExtractor_Extract_MalformedXAlienfile(t *testing.T) {
+	// Arrange: share is a list and system a number instead of maps
+	metaJSON := `{
+		"name": "Alien-Foo",
+		"version": "1.0",
+		"x_serialization_backend": "JSON::PP version 4.07",
+		"prereqs": {
+			"runtime": {
+				"requires": {"Alien::Build": "2.0"},
+				"recommends": ["Not::A::Map"]
+			}
+		},
+		"x_alienfile": {
+			"requires": {
+				"share": ["Mozilla::CA", {"Net::SSLeay": "1.49"}],
+				"system": 42
+			}
+		}
+	}`
+	tarballPath := createTestTarball(t, map[string]string{
+		"Alien-Foo-1.0/META.json": metaJSON,
+	})
+	ext := NewExtractor("")
+	ext.SetIncludeRecommends(true)
+
+	// Act
+	meta, err := ext.Extract(tarballPath)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	want := map[string]string{"Alien::Build": "2.0", "Not::A::Map": "0", "Mozilla::CA": "0", "Net::SSLeay": "1.49"}
+	for mod, ver := range want {
+		if meta.Requirements[mod] != ver {
+			t.Errorf("Requirements[%s] = %q, want %q", mod, meta.Requirements[mod], ver)
+		}
+	}
+	warnings := strings.Join(meta.Warnings, "\n")
+	for _, field := range []string{"prereqs.runtime.recommends", "x_alienfile.requires.share", "x_alienfile.requires.system"} {
+		if !strings.Contains(warnings, field) {
+			t.Errorf("Warnings = %q, want a warning about %s", meta.Warnings, field)
+		}
+	}
+	if meta.SerializationBackend != "JSON::PP version 4.07" {
+		t.Errorf("SerializationBackend = %q", meta.SerializationBackend)
+	}
+}
+
 func TestExtractor_ExtractWithConfigure_PrefersMYMETA(t *testing.T) {
 	// This test verifies that ExtractWithConfigure prefers MYMETA.json over META.json
 	// when MYMETA.json exists (simulating running perl Makefile.PL)
@@ -313,10 +370,10 @@ func TestExtractor_ExtractWithConfigure_PrefersMYMETA(t *testing.T) {
 		"Test-Dist-1.0/MYMETA.json": mymetaJSON,
 	})
 
-	ext := NewExtractor()
+	ext := NewExtractor("")
 
 	// Act - use ExtractWithConfigure which should prefer MYMETA.json
-	meta, err := ext.ExtractWithConfigure(tarballPath)
+	meta, err := ext.ExtractWithConfigure(context.Background(), tarballPath)
 
 	// Assert
 	if err != nil {
@@ -328,3 +385,779 @@ func TestExtractor_ExtractWithConfigure_PrefersMYMETA(t *testing.T) {
 		t.Errorf("Requirements[Dynamic::Dep] = %q, want 2.0 (from MYMETA.json)", meta.Requirements["Dynamic::Dep"])
 	}
 }
+
+// writeGzipMembers writes data to path as consecutive gzip members, splitting
+// at the given offsets, followed by trailer bytes.
+func writeGzipMembers(t *testing.T, path string, data []byte, splits []int, trailer []byte) {
+	t.Helper()
+
+	var out bytes.Buffer
+	start := 0
+	for _, end := range append(splits, len(data)) {
+		gw := gzip.NewWriter(&out)
+		if _, err := gw.Write(data[start:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		start = end
+	}
+	out.Write(trailer)
+
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractor_Extract_GzipMembers(t *testing.T) {
+	// Arrange: Raw tar with a source file first and META.json second
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	files := []struct{ name, content string }{
+		{"Dist-1.0/lib/Dist.pm", "package Dist; 1;"},
+		{"Dist-1.0/META.json", `{"name": "Dist", "version": "1.0"}`},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// First entry is one header block plus one data block
+	firstEntryEnd := 1024
+
+	tests := []struct {
+		name    string
+		splits  []int
+		trailer []byte
+	}{
+		{"two members", []int{firstEntryEnd}, nil},
+		{"trailing garbage", nil, []byte("garbage after the gzip stream")},
+		{"two members and trailing zeros", []int{firstEntryEnd}, make([]byte, 512)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tarballPath := filepath.Join(t.TempDir(), "Dist-1.0.tar.gz")
+			writeGzipMembers(t, tarballPath, tarData.Bytes(), tt.splits, tt.trailer)
+
+			// Act
+			meta, err := NewExtractor("").Extract(tarballPath)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if meta.Name != "Dist" {
+				t.Errorf("Name = %q, want Dist", meta.Name)
+			}
+
+			dir, err := NewExtractor("").extractTarball(tarballPath, t.TempDir())
+			if err != nil {
+				t.Fatalf("extractTarball() error = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "META.json")); err != nil {
+				t.Errorf("META.json not extracted: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractor_Extract_DevelopPrereqs(t *testing.T) {
+	// Arrange
+	metaJSON := `{
+		"name": "Dist",
+		"version": "1.0",
+		"prereqs": {
+			"runtime": {
+				"requires": {"JSON::PP": "2.0"}
+			},
+			"develop": {
+				"requires": {"Test::Pod": "1.41"},
+				"recommends": {"Dist::Zilla": "6.0"}
+			}
+		}
+	}`
+
+	tarballPath := createTestTarball(t, map[string]string{
+		"Dist-1.0/META.json": metaJSON,
+	})
+	ext := NewExtractor("")
+	ext.SetIncludeRecommends(true)
+
+	// Act
+	meta, err := ext.Extract(tarballPath)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if meta.Develop["Test::Pod"] != "1.41" {
+		t.Errorf("Develop[Test::Pod] = %q, want 1.41", meta.Develop["Test::Pod"])
+	}
+	if meta.Develop["Dist::Zilla"] != "6.0" {
+		t.Errorf("Develop[Dist::Zilla] = %q, want 6.0", meta.Develop["Dist::Zilla"])
+	}
+	if _, ok := meta.Requirements["Test::Pod"]; ok {
+		t.Error("develop prereq Test::Pod should not be in Requirements")
+	}
+	if meta.Requirements["JSON::PP"] != "2.0" {
+		t.Errorf("Requirements[JSON::PP] = %q, want 2.0", meta.Requirements["JSON::PP"])
+	}
+}
+
+func TestExtractor_Extract_UncompressedTar(t *testing.T) {
+	// Arrange
+	metaJSON := `{"name": "Plain", "version": "1.0"}`
+
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	if err := tw.WriteHeader(&tar.Header{Name: "Plain-1.0/META.json", Mode: 0644, Size: int64(len(metaJSON))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(metaJSON)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tarballPath := filepath.Join(t.TempDir(), "Plain-1.0.tar")
+	if err := os.WriteFile(tarballPath, tarData.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	meta, err := NewExtractor("").Extract(tarballPath)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if meta.Name != "Plain" {
+		t.Errorf("Name = %q, want Plain", meta.Name)
+	}
+}
+
+func TestExtractor_ConfigureCommand_MirrorEnv(t *testing.T) {
+	t.Setenv("PERL_CPANM_OPT", "")
+	const env = "PERL_CPANM_OPT=--mirror https://mirror.example.com/cpan --mirror-only"
+
+	t.Run("host", func(t *testing.T) {
+		cmd := NewExtractor("https://mirror.example.com/cpan").configureCommand(context.Background(), "/tmp/Dist-1.0", "Makefile.PL")
+
+		if cmd.Dir != "/tmp/Dist-1.0" {
+			t.Errorf("Dir = %q, want /tmp/Dist-1.0", cmd.Dir)
+		}
+		if !slices.Contains(cmd.Env, env) {
+			t.Errorf("Env does not contain %q", env)
+		}
+	})
+
+	t.Run("docker", func(t *testing.T) {
+		cmd := NewDockerExtractor("yacm-perl", "https://mirror.example.com/cpan").configureCommand(context.Background(), "/tmp/Dist-1.0", "Build.PL")
+
+		want := []string{"docker", "run", "--rm", "-v", "/tmp/Dist-1.0:/work", "-w", "/work",
+			"-e", env, "yacm-perl", "perl", "Build.PL"}
+		if !slices.Equal(cmd.Args, want) {
+			t.Errorf("Args = %q, want %q", cmd.Args, want)
+		}
+	})
+
+	t.Run("no mirror", func(t *testing.T) {
+		cmd := NewExtractor("").configureCommand(context.Background(), "/tmp/Dist-1.0", "Makefile.PL")
+
+		if cmd.Env != nil {
+			t.Errorf("Env = %q, want inherited environment", cmd.Env)
+		}
+	})
+}
+
+func TestExtractor_Extract_RecommendsSuggests(t *testing.T) {
+	// Arrange
+	metaJSON := `{
+		"name": "Dist",
+		"version": "1.0",
+		"prereqs": {
+			"runtime": {
+				"requires": {"Required::Module": "1.0"},
+				"recommends": {"Recommended::Module": "2.0"},
+				"suggests": {"Suggested::Module": "3.0"}
+			}
+		}
+	}`
+
+	tarballPath := createTestTarball(t, map[string]string{
+		"Dist-1.0/META.json": metaJSON,
+	})
+
+	tests := []struct {
+		name           string
+		recommends     bool
+		suggests       bool
+		wantRecommends bool
+		wantSuggests   bool
+	}{
+		{"requires only", false, false, false, false},
+		{"with recommends", true, false, true, false},
+		{"with suggests", false, true, false, true},
+		{"with both", true, true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := NewExtractor("")
+			ext.SetIncludeRecommends(tt.recommends)
+			ext.SetIncludeSuggests(tt.suggests)
+
+			// Act
+			meta, err := ext.Extract(tarballPath)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if meta.Requirements["Required::Module"] != "1.0" {
+				t.Errorf("Requirements[Required::Module] = %q, want 1.0", meta.Requirements["Required::Module"])
+			}
+			if _, got := meta.Requirements["Recommended::Module"]; got != tt.wantRecommends {
+				t.Errorf("Recommended::Module included = %v, want %v", got, tt.wantRecommends)
+			}
+			if _, got := meta.Requirements["Suggested::Module"]; got != tt.wantSuggests {
+				t.Errorf("Suggested::Module included = %v, want %v", got, tt.wantSuggests)
+			}
+		})
+	}
+}
+
+func TestExtractor_Extract_CustomPhases(t *testing.T) {
+	// Arrange: prereqs under a nonstandard x_runtime phase and the test phase
+	metaJSON := `{
+		"name": "Dist",
+		"version": "1.0",
+		"prereqs": {
+			"runtime": {"requires": {"Required::Module": "1.0"}},
+			"test": {"requires": {"Test::More": "0"}},
+			"x_runtime": {"requires": {"Custom::Module": "2.0", "Another::Module": "0"}}
+		}
+	}`
+
+	tarballPath := createTestTarball(t, map[string]string{
+		"Dist-1.0/META.json": metaJSON,
+	})
+
+	tests := []struct {
+		name        string
+		include     bool
+		wantWarning string
+	}{
+		{"warned", false, "prereqs.x_runtime: nonstandard phase, ignored Another::Module, Custom::Module"},
+		{"included", true, "prereqs.x_runtime: nonstandard phase, resolving Another::Module, Custom::Module as runtime prereqs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := NewExtractor("")
+			ext.SetIncludeCustomPhases(tt.include)
+
+			// Act
+			meta, err := ext.Extract(tarballPath)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if len(meta.Warnings) != 1 || meta.Warnings[0] != tt.wantWarning {
+				t.Errorf("Warnings = %q, want [%q]", meta.Warnings, tt.wantWarning)
+			}
+			if _, got := meta.Requirements["Custom::Module"]; got != tt.include {
+				t.Errorf("Custom::Module included = %v, want %v", got, tt.include)
+			}
+			if tt.include && meta.Phases["Custom::Module"] != "runtime" {
+				t.Errorf("Phases[Custom::Module] = %q, want runtime", meta.Phases["Custom::Module"])
+			}
+			if _, got := meta.Requirements["Test::More"]; got {
+				t.Error("test prereqs should not be requirements")
+			}
+		})
+	}
+}
+
+func TestExtractor_Extract_MetaSpecAndGeneratedBy(t *testing.T) {
+	tests := []struct {
+		name            string
+		file            string
+		content         string
+		wantSpec        string
+		wantGeneratedBy string
+	}{
+		{
+			name: "META.json 2.0",
+			file: "META.json",
+			content: `{
+				"name": "Dist",
+				"version": "1.0",
+				"generated_by": "ExtUtils::MakeMaker version 7.64, CPAN::Meta::Converter version 2.150010",
+				"meta-spec": {"url": "http://search.cpan.org/perldoc?CPAN::Meta::Spec", "version": 2}
+			}`,
+			wantSpec:        "2",
+			wantGeneratedBy: "ExtUtils::MakeMaker version 7.64, CPAN::Meta::Converter version 2.150010",
+		},
+		{
+			name: "META.yml 1.4",
+			file: "META.yml",
+			content: `---
+name: Dist
+version: '1.0'
+generated_by: 'Module::Build version 0.4231'
+meta-spec:
+  url: http://module-build.sourceforge.net/META-spec-v1.4.html
+  version: '1.4'
+`,
+			wantSpec:        "1.4",
+			wantGeneratedBy: "Module::Build version 0.4231",
+		},
+		{
+			name:    "missing",
+			file:    "META.json",
+			content: `{"name": "Dist", "version": "1.0"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tarballPath := createTestTarball(t, map[string]string{
+				"Dist-1.0/" + tt.file: tt.content,
+			})
+
+			// Act
+			meta, err := NewExtractor("").Extract(tarballPath)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if string(meta.MetaSpec) != tt.wantSpec {
+				t.Errorf("MetaSpec = %q, want %q", meta.MetaSpec, tt.wantSpec)
+			}
+			if meta.GeneratedBy != tt.wantGeneratedBy {
+				t.Errorf("GeneratedBy = %q, want %q", meta.GeneratedBy, tt.wantGeneratedBy)
+			}
+		})
+	}
+}
+
+// stubPerl puts a fake perl first on PATH that runs the given shell script
+// body instead of the configure script.
+func stubPerl(t *testing.T, script string) {
+	t.Helper()
+
+	binDir := t.TempDir()
+	content := "#!/bin/sh\n" + script + "\n"
+	if err := os.WriteFile(filepath.Join(binDir, "perl"), []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestExtractor_SetConfigureJobs(t *testing.T) {
+	// Arrange: A stub perl logging how many configure runs are in flight
+	running := t.TempDir()
+	logFile := filepath.Join(t.TempDir(), "concurrency.log")
+	stubPerl(t, fmt.Sprintf(`touch %[1]s/$$
+ls %[1]s | wc -l >> %[2]s
+sleep 0.2
+rm %[1]s/$$`, running, logFile))
+
+	tarballPath := createTestTarball(t, map[string]string{
+		"Dist-1.0/META.json":   `{"name": "Dist", "version": "1.0"}`,
+		"Dist-1.0/Makefile.PL": "use ExtUtils::MakeMaker; WriteMakefile();",
+	})
+
+	const jobs = 2
+	ext := NewExtractor("")
+	ext.SetConfigureJobs(jobs)
+
+	// Act
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ext.ExtractWithConfigure(context.Background(), tarballPath); err != nil {
+				t.Errorf("ExtractWithConfigure() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("configure never ran: %v", err)
+	}
+	counts := strings.Fields(string(data))
+	if len(counts) != 6 {
+		t.Fatalf("configure ran %d times, want 6", len(counts))
+	}
+	for _, c := range counts {
+		if n, _ := strconv.Atoi(c); n > jobs {
+			t.Errorf("%d configure runs in flight, want at most %d", n, jobs)
+		}
+	}
+}
+
+func TestExtractor_ExtractWithConfigure_Offline(t *testing.T) {
+	tests := []struct {
+		name        string
+		dynamic     string
+		wantSkipped bool
+	}{
+		{name: "dynamic", dynamic: `"dynamic_config": 1,`, wantSkipped: true},
+		{name: "dynamic_config missing", dynamic: "", wantSkipped: true},
+		{name: "static", dynamic: `"dynamic_config": 0,`, wantSkipped: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: A stub perl that records whether configure ran
+			marker := filepath.Join(t.TempDir(), "configure-ran")
+			stubPerl(t, "touch "+marker)
+
+			metaJSON := `{
+				"name": "Dist",
+				"version": "1.0",
+				` + tt.dynamic + `
+				"prereqs": {"runtime": {"requires": {"Static::Dep": "1.0"}}}
+			}`
+			tarballPath := createTestTarball(t, map[string]string{
+				"Dist-1.0/META.json":   metaJSON,
+				"Dist-1.0/Makefile.PL": "use ExtUtils::MakeMaker; WriteMakefile();",
+			})
+
+			ext := NewExtractor("")
+			ext.SetOffline(true)
+
+			// Act
+			meta, err := ext.ExtractWithConfigure(context.Background(), tarballPath)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("ExtractWithConfigure() error = %v", err)
+			}
+			if _, err := os.Stat(marker); err == nil {
+				t.Error("configure ran in offline mode")
+			}
+			if meta.ConfigureSkipped != tt.wantSkipped {
+				t.Errorf("ConfigureSkipped = %v, want %v", meta.ConfigureSkipped, tt.wantSkipped)
+			}
+			if meta.Requirements["Static::Dep"] != "1.0" {
+				t.Errorf("Requirements[Static::Dep] = %q, want 1.0 from META.json", meta.Requirements["Static::Dep"])
+			}
+		})
+	}
+}
+
+func TestExtractor_SetConfigureOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]ConfigureOverride
+		wantArgs  string
+		wantEnv   string
+	}{
+		{name: "no override", wantArgs: "Makefile.PL", wantEnv: ""},
+		{
+			name:      "by name",
+			overrides: map[string]ConfigureOverride{"Dist": {Args: []string{"--no-test"}, Env: map[string]string{"DIST_OPT": "1"}}},
+			wantArgs:  "Makefile.PL --no-test",
+			wantEnv:   "1",
+		},
+		{
+			name: "versioned name wins",
+			overrides: map[string]ConfigureOverride{
+				"Dist":     {Args: []string{"--no-test"}},
+				"Dist-1.0": {Args: []string{"--legacy"}},
+			},
+			wantArgs: "Makefile.PL --legacy",
+		},
+		{
+			name:      "other distribution",
+			overrides: map[string]ConfigureOverride{"Other-Dist": {Args: []string{"--no-test"}}},
+			wantArgs:  "Makefile.PL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: A stub perl recording its arguments and environment
+			logFile := filepath.Join(t.TempDir(), "configure.log")
+			stubPerl(t, fmt.Sprintf(`echo "$*" > %[1]s
+echo "$DIST_OPT" >> %[1]s
+echo '{"name": "Dist", "version": "1.0"}' > MYMETA.json`, logFile))
+			t.Setenv("DIST_OPT", "")
+
+			tarballPath := createTestTarball(t, map[string]string{
+				"Dist-1.0/META.json":   `{"name": "Dist", "version": "1.0", "dynamic_config": 1}`,
+				"Dist-1.0/Makefile.PL": "use ExtUtils::MakeMaker; WriteMakefile();",
+			})
+			ext := NewExtractor("")
+			ext.SetConfigureOverrides(tt.overrides)
+
+			// Act
+			_, err := ext.ExtractWithConfigure(context.Background(), tarballPath)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("ExtractWithConfigure() error = %v", err)
+			}
+			data, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatalf("configure never ran: %v", err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if len(lines) != 2 || lines[0] != tt.wantArgs || lines[1] != tt.wantEnv {
+				t.Errorf("configure got args/env %q, want [%q %q]", lines, tt.wantArgs, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestExtractor_PAXHeaders(t *testing.T) {
+	// Arrange: a tarball as written by git archive, starting with a global
+	// PAX header, plus a per-file PAX record and a symlink
+	tarballPath := filepath.Join(t.TempDir(), "Dist-1.0.tar.gz")
+	f, err := os.Create(tarballPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	metaJSON := `{"name": "Dist", "version": "1.0", "provides": {"Dist": {"file": "lib/Dist.pm", "version": "1.0"}}}`
+	entries := []struct {
+		hdr  *tar.Header
+		body string
+	}{
+		{hdr: &tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "0123456789abcdef"}}},
+		{hdr: &tar.Header{Typeflag: tar.TypeDir, Name: "Dist-1.0/", Mode: 0755}},
+		{hdr: &tar.Header{Typeflag: tar.TypeReg, Name: "Dist-1.0/META.json", Mode: 0644, Size: int64(len(metaJSON)), PAXRecords: map[string]string{"mtime": "1700000000.5"}}, body: metaJSON},
+		{hdr: &tar.Header{Typeflag: tar.TypeSymlink, Name: "Dist-1.0/META.yml", Linkname: "META.json"}},
+	}
+	for _, e := range entries {
+		if err := tw.WriteHeader(e.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	f.Close()
+
+	ext := NewExtractor("")
+
+	t.Run("extract meta", func(t *testing.T) {
+		// Act
+		meta, err := ext.Extract(tarballPath)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		if meta.Name != "Dist" || string(meta.Provides["Dist"].Version) != "1.0" {
+			t.Errorf("Extract() = %+v, want Dist 1.0", meta)
+		}
+	})
+
+	t.Run("extract tarball", func(t *testing.T) {
+		// Act
+		destDir := t.TempDir()
+		distDir, err := ext.extractTarball(tarballPath, destDir)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("extractTarball() error = %v", err)
+		}
+		if distDir != filepath.Join(destDir, "Dist-1.0") {
+			t.Errorf("extractTarball() = %q, want %q", distDir, filepath.Join(destDir, "Dist-1.0"))
+		}
+		if _, err := os.Stat(filepath.Join(distDir, "META.json")); err != nil {
+			t.Errorf("META.json not extracted: %v", err)
+		}
+		entries, _ := os.ReadDir(destDir)
+		if len(entries) != 1 {
+			t.Errorf("destDir has %d entries, want only Dist-1.0", len(entries))
+		}
+	})
+}
+
+func TestExtractor_ParseYAML_ModuleBuild(t *testing.T) {
+	// Arrange: MYMETA.yml as written by Module::Build, in the META 1.4 layout
+	// with top-level requires sections and unquoted numeric versions
+	mymeta := `---
+abstract: 'Foo things'
+author:
+  - 'A. Author <author@example.com>'
+build_requires:
+  ExtUtils::CBuilder: 0
+  Test::More: 0.88
+configure_requires:
+  Module::Build: 0.42
+dynamic_config: 0
+generated_by: 'Module::Build version 0.4231'
+license: perl
+meta-spec:
+  url: http://module-build.sourceforge.net/META-spec-v1.4.html
+  version: 1.4
+name: Foo-Bar
+provides:
+  Foo::Bar:
+    file: lib/Foo/Bar.pm
+    version: 1.10
+recommends:
+  JSON::XS: 3.0
+requires:
+  List::Util: 1.10
+  Scalar::Util: '>= 1.14, < 2'
+  perl: 5.008001
+version: 1.10
+`
+
+	tests := []struct {
+		name       string
+		recommends bool
+		want       map[string]string
+	}{
+		{
+			name: "requires",
+			want: map[string]string{
+				"ExtUtils::CBuilder": "0",
+				"Test::More":         "0.88",
+				"Module::Build":      "0.42",
+				"List::Util":         "1.10",
+				"Scalar::Util":       ">= 1.14, < 2",
+				"perl":               "5.008001",
+			},
+		},
+		{
+			name:       "with recommends",
+			recommends: true,
+			want: map[string]string{
+				"ExtUtils::CBuilder": "0",
+				"Test::More":         "0.88",
+				"Module::Build":      "0.42",
+				"List::Util":         "1.10",
+				"Scalar::Util":       ">= 1.14, < 2",
+				"perl":               "5.008001",
+				"JSON::XS":           "3.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := NewExtractor("")
+			ext.SetIncludeRecommends(tt.recommends)
+
+			// Act
+			meta, err := ext.parseYAML([]byte(mymeta))
+
+			// Assert
+			if err != nil {
+				t.Fatalf("parseYAML() error = %v", err)
+			}
+			if !reflect.DeepEqual(meta.Requirements, tt.want) {
+				t.Errorf("Requirements = %v, want %v", meta.Requirements, tt.want)
+			}
+			if meta.Version != "1.10" || meta.Provides["Foo::Bar"].Version != "1.10" {
+				t.Errorf("Version = %q, Provides[Foo::Bar].Version = %q, want 1.10", meta.Version, meta.Provides["Foo::Bar"].Version)
+			}
+			if meta.MetaSpec != "1.4" {
+				t.Errorf("MetaSpec = %q, want 1.4", meta.MetaSpec)
+			}
+		})
+	}
+}
+
+func TestExtractor_SetKeepBuild(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepBuild bool
+		wantKept  bool
+	}{
+		{name: "removed by default", keepBuild: false, wantKept: false},
+		{name: "kept on failure", keepBuild: true, wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: A stub perl whose configure always fails
+			stubPerl(t, "exit 1")
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+
+			tarballPath := createTestTarball(t, map[string]string{
+				"Dist-1.0/META.json":   `{"name": "Dist", "version": "1.0", "dynamic_config": 1}`,
+				"Dist-1.0/Makefile.PL": "use ExtUtils::MakeMaker; WriteMakefile();",
+			})
+			ext := NewExtractor("")
+			ext.SetKeepBuild(tt.keepBuild)
+
+			// Act
+			meta, err := ext.ExtractWithConfigure(context.Background(), tarballPath)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("ExtractWithConfigure() error = %v", err)
+			}
+			kept, _ := filepath.Glob(filepath.Join(tmp, "yacm-configure-*"))
+			if got := len(kept) == 1; got != tt.wantKept {
+				t.Fatalf("build directories left = %v, want kept %v", kept, tt.wantKept)
+			}
+			if !tt.wantKept {
+				return
+			}
+			if _, err := os.Stat(filepath.Join(kept[0], "Dist-1.0", "Makefile.PL")); err != nil {
+				t.Errorf("kept build directory lacks the extracted dist: %v", err)
+			}
+			if len(meta.Warnings) != 1 || !strings.Contains(meta.Warnings[0], "build directory kept in "+kept[0]) {
+				t.Errorf("Warnings = %q, want naming %s", meta.Warnings, kept[0])
+			}
+		})
+	}
+}
+
+func TestExtractor_Flatten_Phases(t *testing.T) {
+	// Arrange: Foo is required in two phases; the runtime one is recorded
+	meta := &MetaFile{
+		Prereqs: map[string]map[string]interface{}{
+			"runtime":   {"requires": map[string]interface{}{"Foo": "1.0"}},
+			"build":     {"requires": map[string]interface{}{"Foo": "0", "Test::More": "0.98"}},
+			"configure": {"requires": map[string]interface{}{"ExtUtils::MakeMaker": "6.64"}},
+		},
+		ConfigureRequires: map[string]FlexVersion{"Module::Build": "0.42"},
+	}
+
+	// Act
+	NewExtractor("").Flatten(meta)
+
+	// Assert
+	want := map[string]string{
+		"Foo":                 "runtime",
+		"Test::More":          "build",
+		"ExtUtils::MakeMaker": "configure",
+		"Module::Build":       "configure",
+	}
+	if !reflect.DeepEqual(meta.Phases, want) {
+		t.Errorf("Phases = %v, want %v", meta.Phases, want)
+	}
+}
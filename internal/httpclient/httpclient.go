@@ -0,0 +1,45 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const projectURL = "https://github.com/frederic-klein/yacm"
+
+// Version is the yacm version reported in the default User-Agent.
+// It is set at build time with -ldflags "-X .../httpclient.Version=...".
+var Version = "dev"
+
+// DefaultUserAgent returns the User-Agent identifying yacm.
+func DefaultUserAgent() string {
+	return fmt.Sprintf("yacm/%s (+%s)", Version, projectURL)
+}
+
+// Transport sets the User-Agent header on every outgoing request.
+type Transport struct {
+	Base      http.RoundTripper // defaults to http.DefaultTransport
+	UserAgent string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.UserAgent)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// New creates an HTTP client sending the given User-Agent.
+// An empty userAgent selects DefaultUserAgent. See NewClient for timeouts,
+// retries, a proxy and rate limiting.
+func New(userAgent string) *http.Client {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	return &http.Client{Transport: &Transport{UserAgent: userAgent}}
+}
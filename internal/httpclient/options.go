@@ -0,0 +1,130 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// retryBackoff is the wait before the first retry; it doubles with each
+// further one. Replaced in tests.
+var retryBackoff = time.Second
+
+// Options configures the client built by NewClient. Zero values keep the
+// behavior of New.
+type Options struct {
+	UserAgent string        // DefaultUserAgent if empty
+	Timeout   time.Duration // per request, body included; zero for none
+	Retries   int           // retries of a request failing with a connection error or HTTP 5xx
+	Proxy     string        // proxy URL; empty uses $HTTPS_PROXY, $HTTP_PROXY and $NO_PROXY
+	RateLimit float64       // maximum requests per second; zero for no limit
+}
+
+// NewClient creates an HTTP client configured by opts, to be shared by the
+// index, MetaCPAN and tarball downloads so they all behave alike. It fails
+// on an invalid proxy URL.
+func NewClient(opts Options) (*http.Client, error) {
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent()
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		base.Proxy = http.ProxyURL(proxy)
+	}
+
+	var rt http.RoundTripper = base
+	if opts.RateLimit > 0 {
+		rt = &rateLimitTransport{base: rt, interval: time.Duration(float64(time.Second) / opts.RateLimit)}
+	}
+	if opts.Retries > 0 {
+		rt = &retryTransport{base: rt, retries: opts.Retries}
+	}
+	return &http.Client{
+		Transport: &Transport{Base: rt, UserAgent: opts.UserAgent},
+		Timeout:   opts.Timeout,
+	}, nil
+}
+
+// retryTransport repeats requests without a body, such as the GETs yacm
+// sends, that fail with a connection error or an HTTP 5xx status. Other
+// statuses, e.g. 404 or 429, are left to the caller.
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt == t.retries || req.Body != nil && req.Body != http.NoBody || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := Wait(req.Context(), backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a response or error may be transient.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+}
+
+// rateLimitTransport spaces requests at least interval apart.
+type rateLimitTransport struct {
+	base     http.RoundTripper
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(t.interval)
+	t.mu.Unlock()
+
+	if err := Wait(req.Context(), time.Until(start)); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Wait sleeps for d, returning early with the context's error when ctx is
+// done first.
+func Wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
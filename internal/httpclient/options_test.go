@@ -0,0 +1,160 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewClient_Timeout(t *testing.T) {
+	// Arrange: a server answering after 200ms
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"no timeout", 0, false},
+		{"long enough", 5 * time.Second, false},
+		{"too short", 20 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(Options{Timeout: tt.timeout})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			// Act
+			resp, err := client.Get(server.URL)
+
+			// Assert
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClient_Proxy(t *testing.T) {
+	// Arrange: a proxy answering every request itself
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.String() + " " + r.Header.Get("User-Agent"))
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(Options{Proxy: proxy.URL, UserAgent: "my-agent/1.0"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Act
+	resp, err := client.Get("http://cpan.invalid/modules/02packages.details.txt.gz")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if got, want := proxied.Load(), "http://cpan.invalid/modules/02packages.details.txt.gz my-agent/1.0"; got != want {
+		t.Errorf("proxy received %v, want %q", got, want)
+	}
+}
+
+func TestNewClient_InvalidProxy(t *testing.T) {
+	for _, proxy := range []string{"proxy.example.com:3128", "http://", "://x"} {
+		if _, err := NewClient(Options{Proxy: proxy}); err == nil {
+			t.Errorf("NewClient(Proxy: %q) succeeded, want an error", proxy)
+		}
+	}
+}
+
+func TestNewClient_Retries(t *testing.T) {
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = time.Second })
+
+	tests := []struct {
+		name       string
+		status     int // returned by the first two requests
+		retries    int
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"no retries", http.StatusServiceUnavailable, 0, http.StatusServiceUnavailable, 1},
+		{"recovers", http.StatusServiceUnavailable, 2, http.StatusOK, 3},
+		{"gives up", http.StatusBadGateway, 1, http.StatusBadGateway, 2},
+		{"not found is final", http.StatusNotFound, 3, http.StatusNotFound, 1},
+		{"rate limited is left to the caller", http.StatusTooManyRequests, 3, http.StatusTooManyRequests, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= 2 {
+					w.WriteHeader(tt.status)
+				}
+			}))
+			defer server.Close()
+			client, err := NewClient(Options{Retries: tt.retries})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			// Act
+			resp, err := client.Get(server.URL)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server called %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestNewClient_RateLimit(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client, err := NewClient(Options{RateLimit: 20})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Act: the third request may start 100ms after the first at the earliest
+	start := time.Now()
+	for range 3 {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// Assert
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 requests at 20/s took %v, want at least 100ms", elapsed)
+	}
+}
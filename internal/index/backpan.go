@@ -1,22 +1,44 @@
 package index
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/httpclient"
+	"github.com/frederic-klein/yacm/internal/logger"
 )
 
 const metacpanAPI = "https://fastapi.metacpan.org"
 
+const (
+	maxRateLimitRetries = 3                // retries after an HTTP 429 before giving up
+	maxRetryAfter       = 60 * time.Second // cap on a server-requested wait
+	defaultRetryAfter   = 5 * time.Second  // wait when Retry-After is missing or invalid
+)
+
 // BackPANIndex provides lookup for specific module versions via MetaCPAN API.
 type BackPANIndex struct {
 	apiURL     string
 	backpanDir string
 	client     *http.Client
+	log        *logger.Logger
+	sleep      func(context.Context, time.Duration) error // replaced in tests
+
+	scanned     map[string]bool          // tarballs in backpanDir already read by LookupLocal
+	local       map[string]localProvider // module -> best local tarball providing it
+	localAuthor string                   // author of tarballs directly in backpanDir, see SetLocalAuthor
+
+	mu         sync.Mutex
+	prefetched map[lookupKey]*BackPANResult // Lookup results kept by Prefetch
 }
 
 // BackPANResult contains the download URL for a specific module version.
@@ -24,6 +46,53 @@ type BackPANResult struct {
 	DownloadURL string `json:"download_url"`
 	Version     string `json:"version"`
 	Status      string `json:"status"`
+	Date        string `json:"date"` // release date, e.g. "2013-09-03T21:58:33"
+
+	// Pathname is the CPAN pathname of a LookupLocal result, whose
+	// DownloadURL is a file:// URL without one.
+	Pathname string `json:"-"`
+}
+
+// Released parses the release date. MetaCPAN reports it in UTC, usually
+// without a zone suffix.
+func (r *BackPANResult) Released() (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, r.Date); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid release date %q", r.Date)
+}
+
+// Dependency is a single prerequisite from MetaCPAN release metadata.
+type Dependency struct {
+	Module       string `json:"module"`
+	Version      string `json:"version"`
+	Phase        string `json:"phase"`
+	Relationship string `json:"relationship"`
+}
+
+// Release is the subset of MetaCPAN release metadata used for resolution.
+type Release struct {
+	Name         string       `json:"name"`
+	Distribution string       `json:"distribution"`
+	Version      string       `json:"version"`
+	DownloadURL  string       `json:"download_url"`
+	Provides     []string     `json:"provides"`
+	Dependencies []Dependency `json:"dependency"`
+	Metadata     struct {
+		DynamicConfig json.RawMessage `json:"dynamic_config"`
+	} `json:"metadata"`
+}
+
+// Dynamic reports whether the release's META sets dynamic_config, so that
+// its configure script may add prerequisites Dependencies does not list.
+func (r *Release) Dynamic() bool {
+	switch strings.Trim(string(r.Metadata.DynamicConfig), `" `) {
+	case "", "0", "false", "null":
+		return false
+	}
+	return true
 }
 
 // NewBackPANIndex creates a new BackPAN index.
@@ -31,27 +100,50 @@ func NewBackPANIndex(backpanDir string) *BackPANIndex {
 	return &BackPANIndex{
 		apiURL:     metacpanAPI,
 		backpanDir: backpanDir,
-		client:     &http.Client{},
+		client:     httpclient.New(""),
+		sleep:      httpclient.Wait,
+	}
+}
+
+// SetHTTPClient sets the client used for MetaCPAN requests. Nil restores
+// the default.
+func (idx *BackPANIndex) SetHTTPClient(client *http.Client) {
+	if client == nil {
+		client = httpclient.New("")
+	}
+	idx.client = client
+}
+
+// SetAPIURL points lookups at an alternative MetaCPAN API instance.
+func (idx *BackPANIndex) SetAPIURL(apiURL string) {
+	idx.apiURL = strings.TrimSuffix(apiURL, "/")
+}
+
+// SetLogger sets the logger used for per-request debug output.
+func (idx *BackPANIndex) SetLogger(log *logger.Logger) {
+	idx.log = log
+}
+
+// Lookup queries MetaCPAN for a specific module version, unless Prefetch
+// already did.
+func (idx *BackPANIndex) Lookup(ctx context.Context, module, version string) (*BackPANResult, error) {
+	if result, ok := idx.cachedLookup(module, version); ok {
+		idx.log.Debugf("Using prefetched download URL for %s %s", module, version)
+		return result, nil
 	}
+	return idx.lookup(ctx, module, version)
 }
 
-// Lookup queries MetaCPAN for a specific module version.
-func (idx *BackPANIndex) Lookup(module, version string) (*BackPANResult, error) {
+func (idx *BackPANIndex) lookup(ctx context.Context, module, version string) (*BackPANResult, error) {
 	// Build URL with version constraint
 	apiURL := fmt.Sprintf("%s/v1/download_url/%s", idx.apiURL, url.PathEscape(module))
 	if version != "" && version != "0" {
 		apiURL = fmt.Sprintf("%s?version=%s", apiURL, url.QueryEscape(version))
 	}
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	resp, err := idx.get(ctx, apiURL)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := idx.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("querying MetaCPAN: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -70,6 +162,179 @@ func (idx *BackPANIndex) Lookup(module, version string) (*BackPANResult, error)
 	return &result, nil
 }
 
+// Release fetches the metadata of a release, e.g. author "HAARG" and
+// name "Moo-2.005005", from MetaCPAN without downloading the tarball.
+func (idx *BackPANIndex) Release(ctx context.Context, author, name string) (*Release, error) {
+	apiURL := fmt.Sprintf("%s/v1/release/%s/%s", idx.apiURL, url.PathEscape(author), url.PathEscape(name))
+
+	resp, err := idx.get(ctx, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("release %s/%s not found", author, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("MetaCPAN API error: HTTP %d", resp.StatusCode)
+	}
+
+	// The document is either returned as-is or wrapped in a "release" key
+	var result struct {
+		Release
+		Wrapped *Release `json:"release"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	if result.Wrapped != nil {
+		return result.Wrapped, nil
+	}
+	return &result.Release, nil
+}
+
+// Provider finds the release containing module via MetaCPAN's module
+// endpoint. Unlike Lookup it also finds packages missing from the CPAN
+// index, e.g. internal ones only listed in a distribution's provides, so
+// callers should check the release really provides module.
+func (idx *BackPANIndex) Provider(ctx context.Context, module string) (*BackPANResult, error) {
+	doc, err := idx.module(ctx, module)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Author == "" || doc.Release == "" {
+		return nil, fmt.Errorf("no release provides module %s", module)
+	}
+
+	release, err := idx.Release(ctx, doc.Author, doc.Release)
+	if err != nil {
+		return nil, err
+	}
+	if release.DownloadURL == "" {
+		return nil, fmt.Errorf("release %s/%s has no download URL", doc.Author, doc.Release)
+	}
+	return &BackPANResult{DownloadURL: release.DownloadURL, Version: release.Version}, nil
+}
+
+// moduleDoc is the subset of MetaCPAN's module document naming the latest
+// release containing the module.
+type moduleDoc struct {
+	Author       string `json:"author"`
+	Release      string `json:"release"`
+	Distribution string `json:"distribution"`
+}
+
+// module fetches MetaCPAN's module document for module.
+func (idx *BackPANIndex) module(ctx context.Context, module string) (*moduleDoc, error) {
+	apiURL := fmt.Sprintf("%s/v1/module/%s", idx.apiURL, url.PathEscape(module))
+
+	resp, err := idx.get(ctx, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("no release provides module %s", module)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("MetaCPAN API error: HTTP %d", resp.StatusCode)
+	}
+
+	var doc moduleDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	return &doc, nil
+}
+
+// Releases lists every release, BackPAN ones included, of the distribution
+// MetaCPAN lists as providing module. Versions are distribution versions,
+// so callers should check what each release really provides.
+func (idx *BackPANIndex) Releases(ctx context.Context, module string) ([]BackPANResult, error) {
+	doc, err := idx.module(ctx, module)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Distribution == "" {
+		return nil, fmt.Errorf("no release provides module %s", module)
+	}
+
+	apiURL := fmt.Sprintf("%s/v1/release/versions/%s", idx.apiURL, url.PathEscape(doc.Distribution))
+	resp, err := idx.get(ctx, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("no releases of %s found", doc.Distribution)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("MetaCPAN API error: HTTP %d", resp.StatusCode)
+	}
+
+	var list struct {
+		Releases []BackPANResult `json:"releases"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	return list.Releases, nil
+}
+
+// get issues a JSON GET request to the MetaCPAN API. When rate-limited
+// (HTTP 429) it waits as long as the Retry-After header asks, capped at
+// maxRetryAfter, and retries up to maxRateLimitRetries times. The wait ends
+// early with the context's error when ctx is done.
+func (idx *BackPANIndex) get(ctx context.Context, apiURL string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+
+		idx.log.Debugf("GET %s", apiURL)
+		resp, err := idx.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("querying MetaCPAN: %w", err)
+		}
+		idx.log.Debugf("GET %s: HTTP %d", apiURL, resp.StatusCode)
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, nil
+		}
+		wait := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		resp.Body.Close()
+		idx.log.Infof("MetaCPAN rate limit reached, retrying in %s", wait)
+		if err := idx.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date, into a wait between zero and maxRetryAfter.
+func retryAfter(header string, now time.Time) time.Duration {
+	var wait time.Duration
+	if secs, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		wait = t.Sub(now)
+	} else {
+		return defaultRetryAfter
+	}
+	if wait < 0 {
+		return 0
+	}
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return wait
+}
+
 // EnsureDir creates the backpan modules directory if needed.
 func (idx *BackPANIndex) EnsureDir() error {
 	return os.MkdirAll(idx.backpanDir, 0755)
@@ -77,6 +342,10 @@ func (idx *BackPANIndex) EnsureDir() error {
 
 // LocalPath returns the local path for a downloaded BackPAN module.
 func (idx *BackPANIndex) LocalPath(downloadURL string) string {
+	// Local tarballs are used where they lie
+	if path, ok := strings.CutPrefix(downloadURL, "file://"); ok {
+		return filepath.FromSlash(path)
+	}
 	// Extract filename from URL
 	parts := strings.Split(downloadURL, "/")
 	filename := parts[len(parts)-1]
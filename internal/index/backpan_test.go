@@ -1,12 +1,16 @@
 package index
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestBackPANIndex_Lookup(t *testing.T) {
@@ -57,7 +61,7 @@ func TestBackPANIndex_Lookup(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Act
-			result, err := idx.Lookup(tt.module, tt.version)
+			result, err := idx.Lookup(context.Background(), tt.module, tt.version)
 
 			// Assert
 			if (err != nil) != tt.wantErr {
@@ -71,6 +75,233 @@ func TestBackPANIndex_Lookup(t *testing.T) {
 	}
 }
 
+func TestBackPANIndex_SetHTTPClient(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(BackPANResult{DownloadURL: "https://cpan.example.org/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz"})
+	}))
+	defer server.Close()
+
+	rt := &recordingTransport{}
+	idx := NewBackPANIndex(t.TempDir())
+	idx.SetAPIURL(server.URL)
+	idx.SetHTTPClient(&http.Client{Transport: rt})
+
+	// Act
+	_, err := idx.Lookup(context.Background(), "Foo", "== 1.0")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if len(rt.urls) != 1 || rt.urls[0] != server.URL+"/v1/download_url/Foo?version=%3D%3D+1.0" {
+		t.Errorf("requests through custom client = %v", rt.urls)
+	}
+}
+
+func TestBackPANIndex_Lookup_RateLimited(t *testing.T) {
+	tests := []struct {
+		name      string
+		limited   int // number of 429 responses before success
+		wantErr   bool
+		wantWaits int
+	}{
+		{name: "succeeds after waiting", limited: 1, wantWaits: 1},
+		{name: "gives up after bounded retries", limited: maxRateLimitRetries + 1, wantErr: true, wantWaits: maxRateLimitRetries},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= tt.limited {
+					w.Header().Set("Retry-After", "2")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				json.NewEncoder(w).Encode(BackPANResult{DownloadURL: "https://cpan.example.org/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz"})
+			}))
+			defer server.Close()
+
+			var waits []time.Duration
+			idx := NewBackPANIndex(t.TempDir())
+			idx.SetAPIURL(server.URL)
+			idx.sleep = func(_ context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+
+			// Act
+			result, err := idx.Lookup(context.Background(), "Foo", "")
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && result.DownloadURL == "" {
+				t.Errorf("DownloadURL is empty")
+			}
+			if len(waits) != tt.wantWaits {
+				t.Fatalf("waited %d times, want %d", len(waits), tt.wantWaits)
+			}
+			for _, d := range waits {
+				if d != 2*time.Second {
+					t.Errorf("waited %v, want 2s from Retry-After", d)
+				}
+			}
+		})
+	}
+}
+
+func TestBackPANIndex_Lookup_CancelledWhileRateLimited(t *testing.T) {
+	// Arrange: MetaCPAN asks for a minute's pause, the caller gives up sooner
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	idx := NewBackPANIndex(t.TempDir())
+	idx.SetAPIURL(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// Act
+	start := time.Now()
+	_, err := idx.Lookup(ctx, "Foo", "")
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Lookup() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Lookup() took %s, want the wait to end on cancellation", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "3", want: 3 * time.Second},
+		{header: "0", want: 0},
+		{header: "3600", want: maxRetryAfter},
+		{header: now.Add(10 * time.Second).Format(http.TimeFormat), want: 10 * time.Second},
+		{header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{header: "", want: defaultRetryAfter},
+		{header: "soon", want: defaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := retryAfter(tt.header, now); got != tt.want {
+				t.Errorf("retryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackPANIndex_Provider(t *testing.T) {
+	// Arrange: Foo::Util is only known as a package of the Foo-1.0 release
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/module/Foo::Util":
+			w.Write([]byte(`{"name":"Util.pm","author":"AUTHOR","release":"Foo-1.0","distribution":"Foo"}`))
+		case "/v1/release/AUTHOR/Foo-1.0":
+			w.Write([]byte(`{"name":"Foo-1.0","distribution":"Foo","version":"1.0","download_url":"https://cpan.metacpan.org/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	idx := NewBackPANIndex(t.TempDir())
+	idx.SetAPIURL(server.URL)
+
+	tests := []struct {
+		name    string
+		module  string
+		wantURL string
+		wantErr bool
+	}{
+		{name: "provided package", module: "Foo::Util", wantURL: "https://cpan.metacpan.org/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz"},
+		{name: "unknown module", module: "Bar::Util", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			result, err := idx.Provider(context.Background(), tt.module)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Provider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (result.DownloadURL != tt.wantURL || result.Version != "1.0") {
+				t.Errorf("Provider() = %+v, want %s at 1.0", result, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestBackPANIndex_Releases(t *testing.T) {
+	// Arrange: Foo::Util belongs to the Foo distribution, released twice
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/module/Foo::Util":
+			w.Write([]byte(`{"name":"Util.pm","author":"AUTHOR","release":"Foo-2.0","distribution":"Foo"}`))
+		case "/v1/release/versions/Foo":
+			w.Write([]byte(`{"releases":[{"name":"Foo-2.0","version":"2.0","download_url":"https://cpan.metacpan.org/authors/id/A/AU/AUTHOR/Foo-2.0.tar.gz","status":"latest"},` +
+				`{"name":"Foo-1.0","version":"1.0","download_url":"https://backpan.perl.org/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz","status":"backpan"}],"total":2}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	idx := NewBackPANIndex(t.TempDir())
+	idx.SetAPIURL(server.URL)
+
+	tests := []struct {
+		name         string
+		module       string
+		wantVersions []string
+		wantErr      bool
+	}{
+		{name: "released package", module: "Foo::Util", wantVersions: []string{"2.0", "1.0"}},
+		{name: "unknown module", module: "Bar", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			releases, err := idx.Releases(context.Background(), tt.module)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Releases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var versions []string
+			for _, rel := range releases {
+				versions = append(versions, rel.Version)
+			}
+			if !reflect.DeepEqual(versions, tt.wantVersions) {
+				t.Errorf("Releases() versions = %v, want %v", versions, tt.wantVersions)
+			}
+			if !tt.wantErr && releases[1].Status != "backpan" {
+				t.Errorf("Releases()[1] = %+v, want the BackPAN release", releases[1])
+			}
+		})
+	}
+}
+
 func TestBackPANIndex_LocalPath(t *testing.T) {
 	backpanDir := "/tmp/backpan-modules"
 	idx := NewBackPANIndex(backpanDir)
@@ -129,3 +360,28 @@ func TestBackPANIndex_Dir(t *testing.T) {
 		t.Errorf("Dir() = %q, want %q", got, backpanDir)
 	}
 }
+
+func TestBackPANResult_Released(t *testing.T) {
+	tests := []struct {
+		date    string
+		want    time.Time
+		wantErr bool
+	}{
+		{date: "2013-09-03T21:58:33", want: time.Date(2013, 9, 3, 21, 58, 33, 0, time.UTC)},
+		{date: "2013-09-03T21:58:33Z", want: time.Date(2013, 9, 3, 21, 58, 33, 0, time.UTC)},
+		{date: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			r := &BackPANResult{Date: tt.date}
+			got, err := r.Released()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Released() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Released() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,21 +2,29 @@ package index
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/httpclient"
+	"github.com/frederic-klein/yacm/internal/logger"
 )
 
 const (
 	defaultIndexPath = "modules/02packages.details.txt.gz"
-	cacheTTL         = 24 * time.Hour
+	cacheTTL         = 24 * time.Hour // default, see SetCacheTTL
 )
 
 // CPANIndex provides lookup for modules from 02packages.details.txt.
@@ -25,29 +33,86 @@ type CPANIndex struct {
 	cacheDir  string
 	modules   map[string]dist.CPANIndex
 	cacheFile string
+	client    *http.Client
+	log       *logger.Logger
+	refresh   bool
+	ttl       time.Duration
+	indexURL  string
+	updated   time.Time // Last-Updated from the index header
+
+	fuzzyCase bool
+	folded    map[string][]string // lower-cased name -> module names, built on first fuzzy miss
 }
 
 // NewCPANIndex creates a new CPAN index.
 func NewCPANIndex(mirror, cacheDir string) *CPANIndex {
 	return &CPANIndex{
-		mirror:    strings.TrimSuffix(mirror, "/"),
+		mirror:    strings.TrimRight(mirror, "/"),
 		cacheDir:  cacheDir,
 		modules:   make(map[string]dist.CPANIndex),
 		cacheFile: filepath.Join(cacheDir, "02packages.details.txt"),
+		client:    httpclient.New(""),
+		ttl:       cacheTTL,
 	}
 }
 
-// Load downloads and parses the CPAN index.
-func (idx *CPANIndex) Load() error {
+// SetHTTPClient sets the client used to download the index. Nil restores
+// the default.
+func (idx *CPANIndex) SetHTTPClient(client *http.Client) {
+	if client == nil {
+		client = httpclient.New("")
+	}
+	idx.client = client
+}
+
+// SetLogger sets the logger used for per-request debug output.
+func (idx *CPANIndex) SetLogger(log *logger.Logger) {
+	idx.log = log
+}
+
+// SetIndexURL loads the index from url, a full URL to a (possibly
+// historical) 02packages.details.txt[.gz], instead of the mirror's current
+// one. It is cached separately from the mirror's index.
+func (idx *CPANIndex) SetIndexURL(url string) {
+	idx.indexURL = url
+	sum := sha256.Sum256([]byte(url))
+	idx.cacheFile = filepath.Join(idx.cacheDir, fmt.Sprintf("02packages.details.%x.txt", sum[:6]))
+}
+
+// SetFuzzyCase makes Lookup fall back to a case-insensitive match when a
+// module is not in the index, as long as exactly one module matches. Each
+// such match is logged as a warning.
+func (idx *CPANIndex) SetFuzzyCase(fuzzy bool) {
+	idx.fuzzyCase = fuzzy
+}
+
+// SetCacheTTL sets how long a cached index is used before Load downloads
+// it again, e.g. less than the default 24 hours for a DarkPAN that changes
+// often. Zero restores the default.
+func (idx *CPANIndex) SetCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = cacheTTL
+	}
+	idx.ttl = ttl
+}
+
+// SetRefresh forces Load to download the index even if the cache is fresh.
+func (idx *CPANIndex) SetRefresh(refresh bool) {
+	idx.refresh = refresh
+}
+
+// Load downloads and parses the CPAN index. The download is aborted when
+// ctx is done.
+func (idx *CPANIndex) Load(ctx context.Context) error {
 	if err := os.MkdirAll(idx.cacheDir, 0755); err != nil {
 		return fmt.Errorf("creating cache dir: %w", err)
 	}
 
-	if idx.isCacheValid() {
+	if !idx.refresh && idx.isCacheValid() {
 		return idx.parseCache()
 	}
 
-	if err := idx.download(); err != nil {
+	if err := idx.download(ctx); err != nil {
 		return err
 	}
 
@@ -59,41 +124,128 @@ func (idx *CPANIndex) isCacheValid() bool {
 	if err != nil {
 		return false
 	}
-	return time.Since(info.ModTime()) < cacheTTL
+	return time.Since(info.ModTime()) < idx.ttl
 }
 
-func (idx *CPANIndex) download() error {
-	url := fmt.Sprintf("%s/%s", idx.mirror, defaultIndexPath)
+// CacheAge returns how long ago the cached index was written,
+// or zero if there is no cached index.
+func (idx *CPANIndex) CacheAge() time.Duration {
+	info, err := os.Stat(idx.cacheFile)
+	if err != nil {
+		return 0
+	}
+	return time.Since(info.ModTime())
+}
+
+// URL returns where the index is downloaded from: the URL given to
+// SetIndexURL, or the mirror's 02packages.details.txt.gz.
+func (idx *CPANIndex) URL() string {
+	if idx.indexURL != "" {
+		return idx.indexURL
+	}
+	return fmt.Sprintf("%s/%s", idx.mirror, defaultIndexPath)
+}
+
+// LastUpdated returns the Last-Updated time from the loaded index's header,
+// or the zero time if it had none.
+func (idx *CPANIndex) LastUpdated() time.Time {
+	return idx.updated
+}
+
+func (idx *CPANIndex) download(ctx context.Context) error {
+	url := idx.URL()
 
-	resp, err := http.Get(url)
+	idx.log.Debugf("GET %s", url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := idx.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("downloading index: %w", err)
 	}
 	defer resp.Body.Close()
+	idx.log.Debugf("GET %s: HTTP %d", url, resp.StatusCode)
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("downloading index: HTTP %d", resp.StatusCode)
 	}
 
-	gzReader, err := gzip.NewReader(resp.Body)
+	body, err := decodeIndexBody(resp)
+	if errors.Is(err, errErrorPage) {
+		return fmt.Errorf("downloading index from %s: %w", url, err)
+	}
 	if err != nil {
 		return fmt.Errorf("decompressing index: %w", err)
 	}
-	defer gzReader.Close()
 
-	outFile, err := os.Create(idx.cacheFile)
+	// Write to a per-process temp file first, then rename, so concurrent
+	// runs never observe or produce a truncated cache file
+	outFile, err := os.CreateTemp(idx.cacheDir, filepath.Base(idx.cacheFile)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("creating cache file: %w", err)
 	}
-	defer outFile.Close()
+	tmpPath := outFile.Name()
 
-	if _, err := io.Copy(outFile, gzReader); err != nil {
+	_, err = io.Copy(outFile, body)
+	outFile.Close()
+	if err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("writing cache file: %w", err)
 	}
 
+	if err := os.Rename(tmpPath, idx.cacheFile); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("renaming cache file: %w", err)
+	}
+
 	return nil
 }
 
+// errErrorPage reports a download answered with something other than an
+// index, typically a proxy's HTML error page sent with HTTP 200.
+var errErrorPage = errors.New("mirror returned non-gzip content, likely an error page")
+
+// decodeIndexBody returns the uncompressed index from resp. A gzip
+// Content-Encoding left in place by the transport is decoded first; the
+// remaining body is then gunzipped only if it starts with the gzip magic,
+// since mirrors serve 02packages.details.txt.gz both gzipped and plain.
+// A plain body that is HTML fails with errErrorPage.
+func decodeIndexBody(resp *http.Response) (io.Reader, error) {
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		transport, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		body = transport
+	}
+
+	br := bufio.NewReader(body)
+	if magic, _ := br.Peek(2); !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		if isHTML(resp.Header.Get("Content-Type"), br) {
+			return nil, errErrorPage
+		}
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// isHTML reports whether a body declared as contentType and starting with
+// what br holds is an HTML page rather than an index, whose first line is
+// a header such as "File: 02packages.details.txt".
+func isHTML(contentType string, br *bufio.Reader) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == "text/html" {
+		return true
+	}
+	start, _ := br.Peek(512)
+	return bytes.HasPrefix(bytes.TrimLeft(start, " \t\r\n"), []byte("<"))
+}
+
+// indexLineBytes is a rough average length of an index line, used to size
+// the module map up front.
+const indexLineBytes = 64
+
 func (idx *CPANIndex) parseCache() error {
 	file, err := os.Open(idx.cacheFile)
 	if err != nil {
@@ -101,45 +253,125 @@ func (idx *CPANIndex) parseCache() error {
 	}
 	defer file.Close()
 
+	if info, err := file.Stat(); err == nil && len(idx.modules) == 0 {
+		idx.modules = make(map[string]dist.CPANIndex, info.Size()/indexLineBytes)
+	}
+
+	// Many modules share a distribution and version, so those strings are
+	// interned rather than allocated once per line.
+	interned := make(map[string]string)
+	intern := func(b []byte) string {
+		if s, ok := interned[string(b)]; ok {
+			return s
+		}
+		s := string(b)
+		interned[s] = s
+		return s
+	}
+
 	scanner := bufio.NewScanner(file)
 	inHeader := true
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := scanner.Bytes()
 
-		// Skip header until empty line
+		// Skip header until empty line, noting when the index was written
 		if inHeader {
-			if line == "" {
+			if len(line) == 0 {
 				inHeader = false
+			} else if value, ok := bytes.CutPrefix(line, []byte("Last-Updated:")); ok {
+				if t, err := time.Parse(time.RFC1123, string(bytes.TrimSpace(value))); err == nil {
+					idx.updated = t
+				}
 			}
 			continue
 		}
 
 		// Parse: Module::Name \t version \t A/AU/AUTHOR/Dist.tar.gz
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
+		module, rest := nextField(line)
+		version, rest := nextField(rest)
+		pathname, _ := nextField(rest)
+		if len(pathname) == 0 {
 			continue
 		}
 
-		module := fields[0]
-		version := fields[1]
-		pathname := fields[2]
-
 		// Keep "undef" as-is so satisfies() can handle it properly
-		idx.modules[module] = dist.CPANIndex{
-			Module:   module,
-			Version:  version,
-			Pathname: pathname,
+		name := string(module)
+		idx.modules[name] = dist.CPANIndex{
+			Module:   name,
+			Version:  intern(version),
+			Pathname: intern(pathname),
+			Mirror:   idx.mirror,
 		}
 	}
 
 	return scanner.Err()
 }
 
-// Lookup finds a module in the index.
+// nextField returns the first whitespace-separated field of b and the
+// remainder after it, without allocating.
+func nextField(b []byte) (field, rest []byte) {
+	start := 0
+	for start < len(b) && isSpace(b[start]) {
+		start++
+	}
+	end := start
+	for end < len(b) && !isSpace(b[end]) {
+		end++
+	}
+	return b[start:end], b[end:]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// Merge adds the entries of other to idx, e.g. to layer a DarkPAN index over
+// CPAN. When both list a module the higher version wins and on equal
+// versions the entry already in idx is kept, so merging indexes in priority
+// order gives reproducible results. Entries keep the mirror they came from.
+func (idx *CPANIndex) Merge(other *CPANIndex) {
+	idx.folded = nil
+	for module, entry := range other.modules {
+		have, ok := idx.modules[module]
+		if !ok || dist.CompareVersions(entry.Version, have.Version) > 0 {
+			idx.modules[module] = entry
+		}
+	}
+}
+
+// Lookup finds a module in the index. With SetFuzzyCase, the returned
+// entry's Module may differ from module in case.
 func (idx *CPANIndex) Lookup(module string) (dist.CPANIndex, bool) {
 	entry, ok := idx.modules[module]
-	return entry, ok
+	if ok || !idx.fuzzyCase {
+		return entry, ok
+	}
+
+	if idx.folded == nil {
+		idx.folded = make(map[string][]string)
+		for name := range idx.modules {
+			key := strings.ToLower(name)
+			idx.folded[key] = append(idx.folded[key], name)
+		}
+	}
+	candidates := idx.folded[strings.ToLower(module)]
+	switch len(candidates) {
+	case 0:
+		return dist.CPANIndex{}, false
+	case 1:
+		idx.log.Warnf("%s is not in the index; using %s, which differs only in case", module, candidates[0])
+		return idx.modules[candidates[0]], true
+	default:
+		sort.Strings(candidates)
+		idx.log.Warnf("%s is not in the index and matches %s ignoring case; not guessing", module, strings.Join(candidates, ", "))
+		return dist.CPANIndex{}, false
+	}
+}
+
+// Count returns the number of modules in the index.
+func (idx *CPANIndex) Count() int {
+	return len(idx.modules)
 }
 
 // Mirror returns the configured mirror URL.
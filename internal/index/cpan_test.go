@@ -3,11 +3,20 @@ package index
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/httpclient"
+	"github.com/frederic-klein/yacm/internal/logger"
 )
 
 func TestCPANIndex_Lookup_NotLoaded(t *testing.T) {
@@ -26,6 +35,7 @@ func TestCPANIndex_ParseCache(t *testing.T) {
 	content := `File:         02packages.details.txt
 URL:          http://www.perl.com/CPAN/modules/02packages.details.txt
 Description:  Package names found in directory
+Last-Updated: Tue, 02 Jan 2024 03:04:05 GMT
 
 JSON	2.97001	M/MA/MAKAMAKA/JSON-2.97001.tar.gz
 Moo	2.005005	H/HA/HAARG/Moo-2.005005.tar.gz
@@ -39,6 +49,12 @@ Module::With::Undef	undef	A/AU/AUTHOR/Module-With-Undef-1.0.tar.gz
 	if err := idx.parseCache(); err != nil {
 		t.Fatalf("parseCache() error = %v", err)
 	}
+	if got := idx.Count(); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+	if got, want := idx.LastUpdated(), time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("LastUpdated() = %v, want %v", got, want)
+	}
 
 	tests := []struct {
 		module      string
@@ -70,6 +86,98 @@ Module::With::Undef	undef	A/AU/AUTHOR/Module-With-Undef-1.0.tar.gz
 	}
 }
 
+func TestCPANIndex_Lookup_FuzzyCase(t *testing.T) {
+	cacheDir := t.TempDir()
+	content := "File: 02packages.details.txt\n\n" +
+		"JSON::PP\t4.16\tI/IS/ISHIGAKI/JSON-PP-4.16.tar.gz\n" +
+		"Foo::Bar\t1.0\tA/AU/AUTHOR/Foo-Bar-1.0.tar.gz\n" +
+		"Foo::BAR\t1.0\tA/AU/AUTHOR/Foo-BAR-1.0.tar.gz\n"
+	if err := os.WriteFile(filepath.Join(cacheDir, "02packages.details.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		fuzzy      bool
+		module     string
+		wantModule string
+		wantWarn   string
+	}{
+		{name: "exact", fuzzy: true, module: "JSON::PP", wantModule: "JSON::PP"},
+		{name: "case typo without fuzzy", fuzzy: false, module: "JSON::pp"},
+		{name: "case typo", fuzzy: true, module: "JSON::pp", wantModule: "JSON::PP", wantWarn: "JSON::pp is not in the index; using JSON::PP"},
+		{name: "ambiguous", fuzzy: true, module: "foo::bar", wantWarn: "matches Foo::BAR, Foo::Bar ignoring case"},
+		{name: "missing", fuzzy: true, module: "No::Such"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var logs bytes.Buffer
+			idx := NewCPANIndex("https://cpan.metacpan.org", cacheDir)
+			idx.SetLogger(logger.New(&logs, logger.LevelWarn))
+			idx.SetFuzzyCase(tt.fuzzy)
+			if err := idx.parseCache(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			entry, found := idx.Lookup(tt.module)
+
+			// Assert
+			if found != (tt.wantModule != "") || entry.Module != tt.wantModule {
+				t.Errorf("Lookup(%q) = %q, %v, want %q", tt.module, entry.Module, found, tt.wantModule)
+			}
+			if tt.wantWarn == "" && logs.Len() > 0 || !strings.Contains(logs.String(), tt.wantWarn) {
+				t.Errorf("log = %q, want %q", logs.String(), tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestCPANIndex_Merge(t *testing.T) {
+	// Arrange: CPAN and a DarkPAN both listing JSON and Moo
+	load := func(mirror, packages string) *CPANIndex {
+		cacheDir := t.TempDir()
+		content := "File: 02packages.details.txt\n\n" + packages
+		if err := os.WriteFile(filepath.Join(cacheDir, "02packages.details.txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		idx := NewCPANIndex(mirror, cacheDir)
+		if err := idx.parseCache(); err != nil {
+			t.Fatalf("parseCache() error = %v", err)
+		}
+		return idx
+	}
+	cpan := load("https://cpan.example.org", "JSON\t2.0\tM/MA/MAKAMAKA/JSON-2.0.tar.gz\nMoo\t2.0\tH/HA/HAARG/Moo-2.0.tar.gz\n")
+	darkpan := load("https://darkpan.example.org", "JSON\t4.0\tD/DA/DARK/JSON-4.0.tar.gz\nMoo\t2.0\tD/DA/DARK/Moo-2.0.tar.gz\nInternal\t1.0\tD/DA/DARK/Internal-1.0.tar.gz\n")
+
+	// Act
+	cpan.Merge(darkpan)
+
+	// Assert
+	tests := []struct {
+		module     string
+		wantPath   string
+		wantMirror string
+	}{
+		{"JSON", "D/DA/DARK/JSON-4.0.tar.gz", "https://darkpan.example.org"}, // higher version wins
+		{"Moo", "H/HA/HAARG/Moo-2.0.tar.gz", "https://cpan.example.org"},     // tie keeps priority index
+		{"Internal", "D/DA/DARK/Internal-1.0.tar.gz", "https://darkpan.example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			entry, found := cpan.Lookup(tt.module)
+			if !found {
+				t.Fatalf("Lookup(%q) not found", tt.module)
+			}
+			if entry.Pathname != tt.wantPath || entry.Mirror != tt.wantMirror {
+				t.Errorf("Lookup(%q) = %s from %s, want %s from %s", tt.module, entry.Pathname, entry.Mirror, tt.wantPath, tt.wantMirror)
+			}
+		})
+	}
+}
+
 func TestCPANIndex_Download(t *testing.T) {
 	// Arrange: Create a mock server with properly gzipped content
 	var gzippedContent bytes.Buffer
@@ -91,7 +199,7 @@ func TestCPANIndex_Download(t *testing.T) {
 	idx := NewCPANIndex(server.URL, cacheDir)
 
 	// Act
-	err := idx.download()
+	err := idx.download(context.Background())
 
 	// Assert
 	if err != nil {
@@ -103,6 +211,143 @@ func TestCPANIndex_Download(t *testing.T) {
 	}
 }
 
+func TestCPANIndex_Download_Encodings(t *testing.T) {
+	packages := []byte("File: 02packages\n\nJSON\t2.0\tM/MA/MAKAMAKA/JSON-2.0.tar.gz\n")
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write(data)
+		gw.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name            string
+		body            []byte
+		contentEncoding string
+		// rawTransport disables Go's transparent decoding, so the
+		// Content-Encoding header reaches download untouched.
+		rawTransport bool
+	}{
+		{name: "gzipped file", body: gzipped(packages)},
+		{name: "plain body", body: packages},
+		{name: "transport gzip over plain file", body: gzipped(packages), contentEncoding: "gzip"},
+		{name: "transport gzip over gzipped file", body: gzipped(gzipped(packages)), contentEncoding: "gzip"},
+		{name: "undecoded transport gzip over gzipped file", body: gzipped(gzipped(packages)), contentEncoding: "gzip", rawTransport: true},
+		{name: "undecoded transport gzip over plain file", body: gzipped(packages), contentEncoding: "gzip", rawTransport: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			idx := NewCPANIndex(server.URL, t.TempDir())
+			if tt.rawTransport {
+				idx.client = &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			}
+
+			// Act
+			err := idx.download(context.Background())
+
+			// Assert
+			if err != nil {
+				t.Fatalf("download() error = %v", err)
+			}
+			got, err := os.ReadFile(idx.cacheFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, packages) {
+				t.Errorf("cached index = %q, want %q", got, packages)
+			}
+		})
+	}
+}
+
+func TestCPANIndex_Download_ErrorPage(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "HTML page", contentType: "text/html; charset=utf-8", body: "<!DOCTYPE html>\n<html><body>Proxy error</body></html>\n"},
+		{name: "HTML without content type", contentType: "application/octet-stream", body: "\n<html><body>Access denied</body></html>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: a proxy answering with an error page and HTTP 200
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			cacheDir := t.TempDir()
+			idx := NewCPANIndex(server.URL, cacheDir)
+
+			// Act
+			err := idx.download(context.Background())
+
+			// Assert
+			if err == nil || !strings.Contains(err.Error(), "mirror returned non-gzip content, likely an error page") {
+				t.Fatalf("download() error = %v, want a non-gzip content error", err)
+			}
+			entries, err := os.ReadDir(cacheDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("cache dir holds %v, want no files", entries)
+			}
+		})
+	}
+}
+
+func TestCPANIndex_SetIndexURL(t *testing.T) {
+	// Arrange: a historical index at a custom path next to the current one
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/modules/02packages.details.txt.gz":
+			gw := gzip.NewWriter(w)
+			gw.Write([]byte("File: 02packages\n\nJSON\t4.10\tI/IS/ISHIGAKI/JSON-4.10.tar.gz\n"))
+			gw.Close()
+		case "/archive/2012-01-01/02packages.details.txt":
+			w.Write([]byte("File: 02packages\n\nJSON\t2.53\tM/MA/MAKAMAKA/JSON-2.53.tar.gz\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	current := NewCPANIndex(server.URL, cacheDir)
+	historical := NewCPANIndex(server.URL, cacheDir)
+	historical.SetIndexURL(server.URL + "/archive/2012-01-01/02packages.details.txt")
+
+	// Act
+	errCurrent := current.Load(context.Background())
+	errHistorical := historical.Load(context.Background())
+
+	// Assert
+	if errCurrent != nil || errHistorical != nil {
+		t.Fatalf("Load() errors = %v, %v", errCurrent, errHistorical)
+	}
+	if entry, _ := historical.Lookup("JSON"); entry.Version != "2.53" {
+		t.Errorf("historical JSON version = %q, want 2.53", entry.Version)
+	}
+	if entry, _ := current.Lookup("JSON"); entry.Version != "4.10" {
+		t.Errorf("current JSON version = %q, want 4.10", entry.Version)
+	}
+}
+
 func TestCPANIndex_Mirror(t *testing.T) {
 	tests := []struct {
 		input string
@@ -110,6 +355,8 @@ func TestCPANIndex_Mirror(t *testing.T) {
 	}{
 		{"https://cpan.metacpan.org", "https://cpan.metacpan.org"},
 		{"https://cpan.metacpan.org/", "https://cpan.metacpan.org"},
+		{"https://mirror.example.com/pub/CPAN/", "https://mirror.example.com/pub/CPAN"},
+		{"https://mirror.example.com/pub/CPAN//", "https://mirror.example.com/pub/CPAN"},
 	}
 
 	for _, tt := range tests {
@@ -121,3 +368,240 @@ func TestCPANIndex_Mirror(t *testing.T) {
 		})
 	}
 }
+
+func TestCPANIndex_Download_UserAgent(t *testing.T) {
+	// Arrange
+	var gzippedContent bytes.Buffer
+	gw := gzip.NewWriter(&gzippedContent)
+	gw.Write([]byte("File: 02packages\n\n"))
+	gw.Close()
+
+	var gotUA string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		w.Write(gzippedContent.Bytes())
+	}))
+	defer server.Close()
+
+	idx := NewCPANIndex(server.URL, t.TempDir())
+	idx.SetHTTPClient(httpclient.New("yacm/1.2.3 (+https://github.com/frederic-klein/yacm)"))
+
+	// Act
+	if err := idx.download(context.Background()); err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+
+	// Assert
+	if gotUA != "yacm/1.2.3 (+https://github.com/frederic-klein/yacm)" {
+		t.Errorf("User-Agent = %q", gotUA)
+	}
+}
+
+func TestCPANIndex_SetHTTPClient(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("File: 02packages\n\nJSON\t2.0\tM/MA/MAKAMAKA/JSON-2.0.tar.gz\n"))
+	}))
+	defer server.Close()
+
+	rt := &recordingTransport{}
+	idx := NewCPANIndex(server.URL, t.TempDir())
+	idx.SetHTTPClient(&http.Client{Transport: rt})
+
+	// Act
+	err := idx.download(context.Background())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if want := []string{server.URL + "/modules/02packages.details.txt.gz"}; !slices.Equal(rt.urls, want) {
+		t.Errorf("requests through custom client = %v, want %v", rt.urls, want)
+	}
+}
+
+// recordingTransport records the URL of every request it forwards.
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.urls = append(rt.urls, req.URL.String())
+	rt.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCPANIndex_CacheAge(t *testing.T) {
+	// Arrange
+	cacheDir := t.TempDir()
+	idx := NewCPANIndex("https://cpan.metacpan.org", cacheDir)
+
+	if age := idx.CacheAge(); age != 0 {
+		t.Errorf("CacheAge() without cache = %v, want 0", age)
+	}
+
+	if err := os.WriteFile(idx.cacheFile, []byte("File: 02packages\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-72 * time.Hour)
+	if err := os.Chtimes(idx.cacheFile, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	age := idx.CacheAge()
+
+	// Assert
+	if age < 72*time.Hour || age > 73*time.Hour {
+		t.Errorf("CacheAge() = %v, want about 72h", age)
+	}
+}
+
+func TestCPANIndex_SetCacheTTL(t *testing.T) {
+	// Arrange: a public mirror and a DarkPAN, both cached two hours ago
+	// and both since updated to Foo 2.0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("File: 02packages\n\nFoo\t2.0\tA/AU/AUTHOR/Foo-2.0.tar.gz\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		mirror      string
+		ttl         time.Duration
+		wantVersion string
+	}{
+		{name: "default TTL keeps the cache", mirror: server.URL + "/cpan", wantVersion: "1.0"},
+		{name: "shorter TTL refreshes", mirror: server.URL + "/darkpan", ttl: time.Hour, wantVersion: "2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := NewCPANIndex(tt.mirror, t.TempDir())
+			idx.SetCacheTTL(tt.ttl)
+			if err := os.WriteFile(idx.cacheFile, []byte("File: 02packages\n\nFoo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mtime := time.Now().Add(-2 * time.Hour)
+			if err := os.Chtimes(idx.cacheFile, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			// Act
+			err := idx.Load(context.Background())
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if entry, _ := idx.Lookup("Foo"); entry.Version != tt.wantVersion {
+				t.Errorf("Foo version = %q, want %q", entry.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestCPANIndex_Download_Concurrent(t *testing.T) {
+	// Arrange: A large index so concurrent writes would overlap
+	var content strings.Builder
+	content.WriteString("File: 02packages\n\n")
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&content, "Module%d\t1.0\tA/AU/AUTHOR/Dist%d-1.0.tar.gz\n", i, i)
+	}
+	var gzippedContent bytes.Buffer
+	gw := gzip.NewWriter(&gzippedContent)
+	gw.Write([]byte(content.String()))
+	gw.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gzippedContent.Bytes())
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+
+	// Act
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = NewCPANIndex(server.URL, cacheDir).download(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("download() %d error = %v", i, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, "02packages.details.txt"))
+	if err != nil {
+		t.Fatalf("reading cache file: %v", err)
+	}
+	if string(data) != content.String() {
+		t.Errorf("cache file has %d bytes, want %d", len(data), content.Len())
+	}
+
+	entries, _ := os.ReadDir(cacheDir)
+	if len(entries) != 1 {
+		t.Errorf("cache dir has %d entries, want only the cache file", len(entries))
+	}
+}
+
+// writeBenchIndex writes a cache file shaped like the real index, with
+// several modules per distribution.
+func writeBenchIndex(b *testing.B, dists int) string {
+	b.Helper()
+
+	var buf bytes.Buffer
+	buf.WriteString("File: 02packages.details.txt\n\n")
+	for i := 0; i < dists; i++ {
+		for j := 0; j < 5; j++ {
+			fmt.Fprintf(&buf, "Dist%d::Module%d\t1.%d\tA/AU/AUTHOR/Dist%d-1.%d.tar.gz\n", i, j, i%10, i, i%10)
+		}
+	}
+	cacheDir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(cacheDir, "02packages.details.txt"), buf.Bytes(), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return cacheDir
+}
+
+func BenchmarkParseCache(b *testing.B) {
+	cacheDir := writeBenchIndex(b, 20000)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		idx := NewCPANIndex("https://cpan.metacpan.org", cacheDir)
+		if err := idx.parseCache(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	idx := NewCPANIndex("https://cpan.metacpan.org", writeBenchIndex(b, 20000))
+	if err := idx.parseCache(); err != nil {
+		b.Fatal(err)
+	}
+	modules := make([]string, 1000)
+	for i := range modules {
+		modules[i] = fmt.Sprintf("Dist%d::Module%d", i*17, i%5)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, ok := idx.Lookup(modules[i%len(modules)]); !ok {
+			b.Fatal("module not found")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package index
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/extractor"
+)
+
+// localProvider is a tarball in the backpan directory whose META provides
+// a module.
+type localProvider struct {
+	path     string
+	pathname string // e.g. "A/AU/AUTHOR/Foo-1.0.tar.gz", empty if unknown
+	version  string
+}
+
+// LookupLocal finds a tarball in the backpan directory whose META provides
+// module, for modules neither the CPAN index nor MetaCPAN know about, e.g.
+// in a curated offline set. When several do, the one providing the highest
+// version wins. The result's DownloadURL is a file:// URL to the tarball,
+// so LocalPath maps it back to the file. Its Pathname comes from where the
+// tarball lies, e.g. A/AU/AUTHOR/Foo-1.0.tar.gz or the same below
+// authors/id/, or for tarballs directly in the directory from the author
+// set with SetLocalAuthor; tarballs with neither are rejected, as snapshots
+// need an author pathname. Tarballs are read once; ones added to the
+// directory later are picked up by the next call.
+func (idx *BackPANIndex) LookupLocal(module string) (*BackPANResult, error) {
+	if err := idx.scanLocal(); err != nil {
+		return nil, err
+	}
+
+	p, ok := idx.local[module]
+	if !ok {
+		return nil, fmt.Errorf("no tarball in %s provides module %s", idx.backpanDir, module)
+	}
+	if p.pathname == "" {
+		return nil, fmt.Errorf("%s provides module %s but has no author pathname; move it to A/AU/AUTHOR/ in %s or set a local author", p.path, module, idx.backpanDir)
+	}
+	path, err := filepath.Abs(p.path)
+	if err != nil {
+		return nil, err
+	}
+	return &BackPANResult{DownloadURL: "file://" + filepath.ToSlash(path), Version: p.version, Pathname: p.pathname}, nil
+}
+
+// SetLocalAuthor sets the CPAN author, e.g. "LOCAL", under which
+// LookupLocal lists tarballs lying directly in the backpan directory.
+func (idx *BackPANIndex) SetLocalAuthor(author string) {
+	idx.localAuthor = strings.ToUpper(author)
+}
+
+// scanLocal reads the META of each tarball in the backpan directory, or
+// below it, not read before and records the modules it provides.
+func (idx *BackPANIndex) scanLocal() error {
+	if _, err := os.Stat(idx.backpanDir); os.IsNotExist(err) {
+		return nil
+	}
+	if idx.scanned == nil {
+		idx.scanned = make(map[string]bool)
+		idx.local = make(map[string]localProvider)
+	}
+
+	var names []string // relative to backpanDir, slash-separated
+	err := filepath.WalkDir(idx.backpanDir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(idx.backpanDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !e.IsDir() && !idx.scanned[name] && isTarball(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", idx.backpanDir, err)
+	}
+	sort.Strings(names)
+
+	ext := extractor.NewExtractor("")
+	for _, name := range names {
+		idx.scanned[name] = true
+		path := filepath.Join(idx.backpanDir, filepath.FromSlash(name))
+		meta, err := ext.Extract(path)
+		if err != nil {
+			idx.log.Debugf("Skipping %s: %v", path, err)
+			continue
+		}
+		for module, entry := range meta.Provides {
+			version := string(entry.Version)
+			if version == "" {
+				version = string(meta.Version)
+			}
+			if have, ok := idx.local[module]; ok && dist.CompareVersions(version, have.version) <= 0 {
+				continue
+			}
+			idx.local[module] = localProvider{path: path, pathname: idx.localPathname(name), version: version}
+		}
+	}
+	return nil
+}
+
+// localPathname returns the CPAN pathname of the tarball at name, relative
+// to the backpan directory, or "" if it has none.
+func (idx *BackPANIndex) localPathname(name string) string {
+	name = strings.TrimPrefix(name, "authors/id/")
+	parts := strings.Split(name, "/")
+	if len(parts) == 1 {
+		if len(idx.localAuthor) < 2 {
+			return ""
+		}
+		return authorDir(idx.localAuthor) + "/" + name
+	}
+	if len(parts) < 4 || len(parts[2]) < 2 || strings.Join(parts[:3], "/") != authorDir(parts[2]) {
+		return ""
+	}
+	return name
+}
+
+// authorDir returns the directory of the uploads of author, at least two
+// characters long, e.g. "A/AU/AUTHOR".
+func authorDir(author string) string {
+	return author[:1] + "/" + author[:2] + "/" + author
+}
+
+func isTarball(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar")
+}
@@ -0,0 +1,146 @@
+package index
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackPANIndex_LookupLocal(t *testing.T) {
+	// Arrange: two local releases of Foo, one also providing Foo::Util
+	dir := t.TempDir()
+	writeLocalTarball(t, filepath.Join(dir, "A", "AU", "AUTHOR", "Foo-1.0.tar.gz"), "Foo-1.0",
+		`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"},"Foo::Util":{"file":"lib/Foo/Util.pm"}}}`)
+	writeLocalTarball(t, filepath.Join(dir, "Foo-0.9.tar.gz"), "Foo-0.9",
+		`{"name":"Foo","version":"0.9","provides":{"Foo":{"file":"lib/Foo.pm","version":"0.9"}}}`)
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a tarball"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx := NewBackPANIndex(dir)
+
+	tests := []struct {
+		name        string
+		module      string
+		wantFile    string
+		wantVersion string
+		wantErr     bool
+	}{
+		{name: "highest version wins", module: "Foo", wantFile: "A/AU/AUTHOR/Foo-1.0.tar.gz", wantVersion: "1.0"},
+		{name: "version from the release", module: "Foo::Util", wantFile: "A/AU/AUTHOR/Foo-1.0.tar.gz", wantVersion: "1.0"},
+		{name: "not provided", module: "Bar", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			result, err := idx.LookupLocal(tt.module)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupLocal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := idx.LocalPath(result.DownloadURL); got != filepath.Join(dir, filepath.FromSlash(tt.wantFile)) {
+				t.Errorf("LocalPath(DownloadURL) = %s, want %s", got, filepath.Join(dir, tt.wantFile))
+			}
+			if result.Pathname != tt.wantFile {
+				t.Errorf("Pathname = %s, want %s", result.Pathname, tt.wantFile)
+			}
+			if result.Version != tt.wantVersion {
+				t.Errorf("Version = %s, want %s", result.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestBackPANIndex_LookupLocal_NewTarball(t *testing.T) {
+	// Arrange: Bar is only added after the directory was first scanned
+	dir := t.TempDir()
+	idx := NewBackPANIndex(dir)
+	idx.SetLocalAuthor("LOCAL")
+	if _, err := idx.LookupLocal("Bar"); err == nil {
+		t.Fatal("LookupLocal() found Bar in an empty directory")
+	}
+	writeLocalTarball(t, filepath.Join(dir, "Bar-2.0.tar.gz"), "Bar-2.0",
+		`{"name":"Bar","version":"2.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"2.0"}}}`)
+
+	// Act
+	result, err := idx.LookupLocal("Bar")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("LookupLocal() error = %v", err)
+	}
+	if result.Version != "2.0" {
+		t.Errorf("Version = %s, want 2.0", result.Version)
+	}
+}
+
+func TestBackPANIndex_LookupLocal_Pathname(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		localAuthor  string
+		wantPathname string
+		wantErr      bool
+	}{
+		{name: "author directory", file: "A/AU/AUTHOR/Foo-1.0.tar.gz", wantPathname: "A/AU/AUTHOR/Foo-1.0.tar.gz"},
+		{name: "below authors/id", file: "authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz", wantPathname: "A/AU/AUTHOR/Foo-1.0.tar.gz"},
+		{name: "flat with local author", file: "Foo-1.0.tar.gz", localAuthor: "local", wantPathname: "L/LO/LOCAL/Foo-1.0.tar.gz"},
+		{name: "flat without local author", file: "Foo-1.0.tar.gz", wantErr: true},
+		{name: "not an author directory", file: "vendor/Foo-1.0.tar.gz", wantErr: true},
+		{name: "mismatched author directory", file: "B/AU/AUTHOR/Foo-1.0.tar.gz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			dir := t.TempDir()
+			writeLocalTarball(t, filepath.Join(dir, filepath.FromSlash(tt.file)), "Foo-1.0",
+				`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`)
+			idx := NewBackPANIndex(dir)
+			idx.SetLocalAuthor(tt.localAuthor)
+
+			// Act
+			result, err := idx.LookupLocal("Foo")
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupLocal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && result.Pathname != tt.wantPathname {
+				t.Errorf("Pathname = %s, want %s", result.Pathname, tt.wantPathname)
+			}
+		})
+	}
+}
+
+func writeLocalTarball(t *testing.T, path, distName, metaJSON string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	hdr := &tar.Header{Name: distName + "/META.json", Mode: 0644, Size: int64(len(metaJSON))}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(metaJSON)); err != nil {
+		t.Fatal(err)
+	}
+}
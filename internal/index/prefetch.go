@@ -0,0 +1,68 @@
+package index
+
+import (
+	"context"
+	"sync"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// lookupKey identifies a Lookup query.
+type lookupKey struct {
+	module  string
+	version string
+}
+
+// Prefetch runs Lookup for every module and version in reqs, up to workers
+// queries at once, and keeps the results so that later Lookup calls for
+// them are answered without a request, e.g. for the exact pins of a large
+// cpanfile before the resolver walks it one requirement at a time. Failed
+// queries are not kept; Lookup repeats them. Queries not yet started when
+// ctx is done are skipped. It returns the number of results kept.
+func (idx *BackPANIndex) Prefetch(ctx context.Context, reqs []dist.VersionReq, workers int) int {
+	if workers < 1 {
+		workers = 1
+	}
+
+	queries := make(chan lookupKey, len(reqs))
+	for _, req := range reqs {
+		queries <- lookupKey{module: req.Module, version: req.Version}
+	}
+	close(queries)
+
+	var wg sync.WaitGroup
+	var kept int
+	for range min(workers, len(reqs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queries {
+				if ctx.Err() != nil {
+					continue
+				}
+				result, err := idx.lookup(ctx, key.module, key.version)
+				if err != nil {
+					idx.log.Debugf("Prefetching %s %s: %v", key.module, key.version, err)
+					continue
+				}
+				idx.mu.Lock()
+				if idx.prefetched == nil {
+					idx.prefetched = make(map[lookupKey]*BackPANResult)
+				}
+				idx.prefetched[key] = result
+				kept++
+				idx.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return kept
+}
+
+// cachedLookup returns the result Prefetch kept for module and version.
+func (idx *BackPANIndex) cachedLookup(module, version string) (*BackPANResult, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	result, ok := idx.prefetched[lookupKey{module: module, version: version}]
+	return result, ok
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestBackPANIndex_Prefetch(t *testing.T) {
+	// Arrange: a MetaCPAN API answering slowly, tracking concurrent requests
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		module := strings.TrimPrefix(r.URL.Path, "/v1/download_url/")
+		mu.Lock()
+		requests[module]++
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if module == "Missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BackPANResult{
+			DownloadURL: "https://cpan.metacpan.org/authors/id/A/AU/AUTHOR/" + module + "-" + r.URL.Query().Get("version")[3:] + ".tar.gz",
+			Version:     r.URL.Query().Get("version")[3:],
+		})
+	}))
+	defer server.Close()
+
+	idx := NewBackPANIndex(t.TempDir())
+	idx.SetAPIURL(server.URL)
+	pins := []dist.VersionReq{
+		{Module: "Foo", Version: "== 1.0"},
+		{Module: "Bar", Version: "== 2.0"},
+		{Module: "Baz", Version: "== 3.0"},
+		{Module: "Qux", Version: "== 4.0"},
+		{Module: "Missing", Version: "== 1.0"},
+	}
+
+	// Act
+	kept := idx.Prefetch(context.Background(), pins, 3)
+
+	// Assert
+	if kept != 4 {
+		t.Errorf("Prefetch() = %d, want 4", kept)
+	}
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Errorf("%d lookups ran at once, want 2 to 3", maxInFlight)
+	}
+	for _, pin := range pins[:4] {
+		result, err := idx.Lookup(context.Background(), pin.Module, pin.Version)
+		if err != nil {
+			t.Fatalf("Lookup(%s) error = %v", pin.Module, err)
+		}
+		if want := pin.Module + "-" + pin.Version[3:] + ".tar.gz"; !strings.HasSuffix(result.DownloadURL, want) {
+			t.Errorf("Lookup(%s) = %q, want a URL ending in %s", pin.Module, result.DownloadURL, want)
+		}
+		if requests[pin.Module] != 1 {
+			t.Errorf("%s looked up %d times, want once", pin.Module, requests[pin.Module])
+		}
+	}
+	if _, err := idx.Lookup(context.Background(), "Missing", "== 1.0"); err == nil {
+		t.Error("Lookup(Missing) succeeded, want not found")
+	}
+	if requests["Missing"] != 2 {
+		t.Errorf("Missing looked up %d times, want twice as failures are not kept", requests["Missing"])
+	}
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Level controls which messages a Logger emits.
+type Level int
+
+const (
+	LevelError Level = iota // errors only (--quiet)
+	LevelWarn               // warnings and errors (default)
+	LevelInfo               // progress information (--verbose)
+	LevelDebug              // per-request detail (-vv, --debug)
+)
+
+// Logger writes leveled messages to a writer.
+// A nil *Logger is valid and discards everything.
+type Logger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	level    Level
+	warnings int
+}
+
+// New creates a logger that writes messages at or below level to w.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{w: w, level: level}
+}
+
+// Enabled reports whether messages at the given level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level <= l.level
+}
+
+// Errorf logs an error message.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, "Error: ", format, args...)
+}
+
+// Warnf logs a warning message. Warnings are counted even when the level
+// hides them.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	if l != nil {
+		l.mu.Lock()
+		l.warnings++
+		l.mu.Unlock()
+	}
+	l.logf(LevelWarn, "Warning: ", format, args...)
+}
+
+// Noticef logs a warning that is not counted by Warnings, for advice that
+// does not make the result wrong, e.g. a stale cached index.
+func (l *Logger) Noticef(format string, args ...interface{}) {
+	l.logf(LevelWarn, "Warning: ", format, args...)
+}
+
+// Warnings returns the number of warnings logged so far.
+func (l *Logger) Warnings() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.warnings
+}
+
+// Infof logs an informational message.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, "", format, args...)
+}
+
+// Debugf logs a debug message.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, "", format, args...)
+}
+
+func (l *Logger) logf(level Level, prefix, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, prefix+format+"\n", args...)
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLogger_Levels(t *testing.T) {
+	tests := []struct {
+		name  string
+		level Level
+		want  string
+	}{
+		{"quiet", LevelError, "Error: e\n"},
+		{"default", LevelWarn, "Error: e\nWarning: w\nWarning: n\n"},
+		{"verbose", LevelInfo, "Error: e\nWarning: w\nWarning: n\ni\n"},
+		{"debug", LevelDebug, "Error: e\nWarning: w\nWarning: n\ni\nd\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(&buf, tt.level)
+
+			log.Errorf("e")
+			log.Warnf("w")
+			log.Noticef("n")
+			log.Infof("i")
+			log.Debugf("d")
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogger_Nil(t *testing.T) {
+	var log *Logger
+
+	// Should not panic
+	log.Warnf("ignored")
+
+	if log.Enabled(LevelError) {
+		t.Error("nil logger should not be enabled")
+	}
+}
+
+func TestLogger_Warnings(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(&buf, LevelError)
+
+	log.Warnf("hidden")
+	log.Errorf("e")
+	log.Warnf("hidden too")
+	log.Noticef("not counted")
+
+	if got := log.Warnings(); got != 2 {
+		t.Errorf("Warnings() = %d, want 2", got)
+	}
+	if got := (*Logger)(nil).Warnings(); got != 0 {
+		t.Errorf("nil Warnings() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,96 @@
+package resolver
+
+import (
+	"sort"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// coreRange is the span of perl releases shipping a module in core.
+type coreRange struct {
+	added   string // first stable perl shipping the module
+	removed string // first stable perl no longer shipping it, empty if still core
+}
+
+// coreReleases records when modules in coreModules entered (or left) core,
+// following Module::CoreList. Modules missing here ship with every perl 5
+// that yacm supports.
+var coreReleases = map[string]coreRange{
+	// Added in 5.6
+	"Term::ANSIColor": {added: "5.6"},
+
+	// Added in 5.8
+	"Digest::MD5": {added: "5.8"}, "Encode": {added: "5.8"},
+	"Encode::Alias": {added: "5.8"}, "Encode::Config": {added: "5.8"},
+	"Encode::Encoding": {added: "5.8"}, "Encode::Guess": {added: "5.8"},
+	"Encode::MIME::Header": {added: "5.8"}, "Filter::Simple": {added: "5.8"},
+	"I18N::LangTags": {added: "5.8"}, "I18N::Langinfo": {added: "5.8"},
+	"List::Util": {added: "5.8"}, "Locale::Maketext": {added: "5.8"},
+	"MIME::Base64": {added: "5.8"}, "MIME::QuotedPrint": {added: "5.8"},
+	"Math::BigRat": {added: "5.8"}, "Memoize": {added: "5.8"},
+	"Net::Cmd": {added: "5.8"}, "Net::Config": {added: "5.8"},
+	"Net::Domain": {added: "5.8"}, "Net::FTP": {added: "5.8"},
+	"Net::NNTP": {added: "5.8"}, "Net::Netrc": {added: "5.8"},
+	"Net::POP3": {added: "5.8"}, "Net::SMTP": {added: "5.8"},
+	"Net::Time": {added: "5.8"}, "PerlIO::encoding": {added: "5.8"},
+	"PerlIO::scalar": {added: "5.8"}, "PerlIO::via": {added: "5.8"},
+	"PerlIO::via::QuotedPrint": {added: "5.8"}, "Scalar::Util": {added: "5.8"},
+	"Storable": {added: "5.8"}, "Test::Builder": {added: "5.8"},
+	"Test::Builder::Module": {added: "5.10"}, "Test::Builder::Tester": {added: "5.8"},
+	"Test::More": {added: "5.8"}, "Test::Simple": {added: "5.8"},
+	"Text::Balanced": {added: "5.8"}, "Tie::File": {added: "5.8"},
+	"Tie::Memoize": {added: "5.8"}, "Time::HiRes": {added: "5.8"},
+	"Unicode::Collate": {added: "5.8"}, "Unicode::Normalize": {added: "5.8"},
+	"Unicode::UCD": {added: "5.8"}, "bigint": {added: "5.8"},
+	"bignum": {added: "5.8"}, "bigrat": {added: "5.8"},
+	"encoding": {added: "5.8"}, "threads": {added: "5.8"},
+	"threads::shared": {added: "5.8"},
+
+	// Added in 5.10
+	"Hash::Util::FieldHash": {added: "5.10"}, "IPC::Cmd": {added: "5.10"},
+	"Pod::Simple": {added: "5.10"}, "Time::Piece": {added: "5.10"},
+	"Time::Seconds": {added: "5.10"}, "encoding::warnings": {added: "5.10"},
+	"feature": {added: "5.10"}, "mro": {added: "5.10"},
+	"version": {added: "5.10"}, "parent": {added: "5.10.1"},
+
+	// Added in 5.12 and later
+	"List::Util::XS": {added: "5.12"},
+	"Sub::Util":      {added: "5.22"},
+
+	// Removed in 5.32
+	"Pod::Find":         {added: "5.6", removed: "5.32"},
+	"Pod::InputObjects": {added: "5.6", removed: "5.32"},
+	"Pod::ParseUtils":   {added: "5.6", removed: "5.32"},
+	"Pod::Parser":       {added: "5.6", removed: "5.32"},
+	"Pod::PlainText":    {added: "5.6", removed: "5.32"},
+	"Pod::Select":       {added: "5.6", removed: "5.32"},
+}
+
+// IsCoreFor reports whether module ships with the given perl version, e.g.
+// "5.36" or "5.036". An empty version matches every module yacm treats as
+// core.
+func IsCoreFor(module, perl string) bool {
+	if !coreModules[module] {
+		return false
+	}
+	r, ok := coreReleases[module]
+	if !ok || perl == "" {
+		return true
+	}
+	if dist.CompareVersions(perl, r.added) < 0 {
+		return false
+	}
+	return r.removed == "" || dist.CompareVersions(perl, r.removed) < 0
+}
+
+// CoreModules returns the sorted list of modules considered core for perl.
+func CoreModules(perl string) []string {
+	var modules []string
+	for module := range coreModules {
+		if IsCoreFor(module, perl) {
+			modules = append(modules, module)
+		}
+	}
+	sort.Strings(modules)
+	return modules
+}
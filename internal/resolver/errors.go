@@ -0,0 +1,33 @@
+package resolver
+
+import "fmt"
+
+// Error kinds reported by the resolver.
+const (
+	KindUnresolved = "unresolved" // no release found for the module
+	KindConflict   = "conflict"   // resolved release does not satisfy a requirement
+	KindDownload   = "download"   // the release tarball could not be downloaded
+	KindCycle      = "cycle"      // the module requires itself, see SetCyclePolicy
+)
+
+// Error describes why resolving a module failed.
+type Error struct {
+	Kind   string
+	Module string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	switch e.Kind {
+	case KindDownload:
+		return fmt.Sprintf("downloading %s: %v", e.Module, e.Err)
+	case KindConflict:
+		return fmt.Sprintf("unsatisfied requirements: %v", e.Err)
+	default:
+		return fmt.Sprintf("resolving %s: %v", e.Module, e.Err)
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,44 @@
+package resolver
+
+// EventKind identifies a resolution step reported to an observer.
+type EventKind string
+
+// Event kinds, in the order they occur for a module.
+const (
+	EventStarted    EventKind = "started"    // resolving a module began
+	EventFound      EventKind = "found"      // a release was picked on CPAN or BackPAN
+	EventDownloaded EventKind = "downloaded" // the release tarball is available locally
+	EventExtracted  EventKind = "extracted"  // metadata was read, after running configure if needed
+	EventResolved   EventKind = "resolved"   // the distribution was recorded
+	EventSkipped    EventKind = "skipped"    // the module was not resolved, see Reason
+)
+
+// Reasons for EventSkipped.
+const (
+	SkipCore      = "core"      // shipped with perl
+	SkipCircular  = "circular"  // already being resolved further up
+	SkipNamespace = "namespace" // excluded with SetSkipNamespaces
+)
+
+// Event describes one resolution step for a module.
+type Event struct {
+	Kind     EventKind
+	Module   string
+	Version  string // requested version constraint
+	Pathname string // release pathname, from EventFound on
+	Source   string // "cpan" or "backpan", from EventFound on
+	Dist     string // distribution name, for EventResolved
+	Reason   string // for EventSkipped
+}
+
+// SetObserver registers fn to be called synchronously for every resolution
+// event, e.g. to drive a progress display. Nil removes the observer.
+func (r *Resolver) SetObserver(fn func(Event)) {
+	r.observer = fn
+}
+
+func (r *Resolver) emit(e Event) {
+	if r.observer != nil {
+		r.observer(e)
+	}
+}
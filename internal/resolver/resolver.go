@@ -1,117 +1,727 @@
 package resolver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/frederic-klein/yacm/internal/dist"
 	"github.com/frederic-klein/yacm/internal/downloader"
 	"github.com/frederic-klein/yacm/internal/extractor"
 	"github.com/frederic-klein/yacm/internal/index"
+	"github.com/frederic-klein/yacm/internal/logger"
 )
 
 // Resolver resolves module dependencies recursively.
 type Resolver struct {
-	cpanIndex   *index.CPANIndex
-	backpan     *index.BackPANIndex
-	downloader  *downloader.Downloader
-	extractor   *extractor.Extractor
-	resolved    map[string]*dist.Dist
-	resolving   map[string]bool
-	verbose     bool
-	logFn       func(string, ...interface{})
+	cpanIndex  *index.CPANIndex
+	backpan    *index.BackPANIndex
+	downloader *downloader.Downloader
+	extractor  *extractor.Extractor
+	resolved   map[string]*dist.Dist
+	resolving  []string // modules being resolved, outermost first
+	requested  map[string]bool
+	aliases    map[string]string // requested name -> indexed name, for fuzzy-case matches
+	undefSeen  map[string]bool   // modules already warned about for an undef version
+	log        *logger.Logger
+	observer   func(Event)
+
+	includeDevelop bool
+	includeCore    bool
+	metaAPI        bool
+	lazyDownload   bool
+	apiWorkers     int // concurrent MetaCPAN prefetch lookups, 0 for none
+	upgrade        bool
+	preferBackPAN  bool
+	versionPolicy  VersionPolicy
+	cyclePolicy    CyclePolicy
+	collectErrors  bool
+	shallow        map[string]bool
+	noTransitive   bool
+	skipNamespaces []string          // without trailing "::"
+	constraints    map[string]string // module -> constraint ANDed with every request
+	maxBackPANAge  time.Duration
+	pinned         []string              // pathnames passed to SetPinnedDists
+	pins           map[string]pinnedDist // provided module -> pinned dist, once loaded
 }
 
-// NewResolver creates a new dependency resolver.
-// If dockerImage is non-empty, configure steps run inside that Docker container.
-func NewResolver(cpan *index.CPANIndex, backpan *index.BackPANIndex, dl *downloader.Downloader, verbose bool, dockerImage string) *Resolver {
-	var ext *extractor.Extractor
-	if dockerImage != "" {
-		ext = extractor.NewDockerExtractor(dockerImage)
-	} else {
-		ext = extractor.NewExtractor()
-	}
+// VersionPolicy selects the release picked when several satisfy a
+// requirement.
+type VersionPolicy string
+
+const (
+	VersionLatest  VersionPolicy = "latest"  // the newest, as listed by the CPAN index
+	VersionMinimum VersionPolicy = "minimum" // the oldest, to test against minimum versions
+)
+
+// CyclePolicy selects what happens when a module turns out to require
+// itself through its prerequisites.
+type CyclePolicy string
+
+const (
+	CycleSkip  CyclePolicy = "skip"  // ignore the requirement closing the cycle
+	CycleWarn  CyclePolicy = "warn"  // the same, with a warning naming the cycle
+	CycleError CyclePolicy = "error" // fail to resolve the module
+)
 
+// pinnedDist is a distribution forced by SetPinnedDists.
+type pinnedDist struct {
+	pathname string
+	meta     *extractor.MetaFile
+}
+
+// NewResolver creates a new dependency resolver.
+func NewResolver(cpan *index.CPANIndex, backpan *index.BackPANIndex, dl *downloader.Downloader, ext *extractor.Extractor, log *logger.Logger) *Resolver {
 	return &Resolver{
 		cpanIndex:  cpan,
 		backpan:    backpan,
 		downloader: dl,
 		extractor:  ext,
 		resolved:   make(map[string]*dist.Dist),
-		resolving:  make(map[string]bool),
-		verbose:    verbose,
-		logFn: func(format string, args ...interface{}) {
-			if verbose {
-				fmt.Printf(format+"\n", args...)
-			}
-		},
+		requested:  make(map[string]bool),
+		aliases:    make(map[string]string),
+		undefSeen:  make(map[string]bool),
+		log:        log,
+	}
+}
+
+// SetIncludeDevelop makes the resolver also resolve the develop-phase
+// prerequisites declared in each distribution's META.
+func (r *Resolver) SetIncludeDevelop(include bool) {
+	r.includeDevelop = include
+}
+
+// SetIncludeCoreModules makes the resolver resolve modules shipped with
+// perl from CPAN like any other, e.g. for a self-contained bundle. perl
+// itself is still skipped.
+func (r *Resolver) SetIncludeCoreModules(include bool) {
+	r.includeCore = include
+}
+
+// SetMetaAPI makes the resolver take prerequisites from MetaCPAN release
+// metadata instead of downloading and configuring each tarball. This is
+// faster but misses dynamic prerequisites. Tarballs are still used when
+// the metadata is unavailable.
+func (r *Resolver) SetMetaAPI(enabled bool) {
+	r.metaAPI = enabled
+}
+
+// SetLazyDownload makes the resolver try MetaCPAN release metadata first,
+// like SetMetaAPI, but still download and configure the tarball of a
+// release with dynamic_config, or whose metadata is unavailable, so
+// dynamic prerequisites are not missed.
+func (r *Resolver) SetLazyDownload(enabled bool) {
+	r.lazyDownload = enabled
+}
+
+// SetMetaCPANWorkers makes Resolve look up the MetaCPAN download URLs of
+// exact top-level pins the CPAN index cannot satisfy up to workers at a
+// time before resolving, instead of one by one as the walk reaches them.
+// Zero disables the prefetch.
+func (r *Resolver) SetMetaCPANWorkers(workers int) {
+	r.apiWorkers = workers
+}
+
+// SetUpgrade makes the resolver treat every version constraint as a
+// minimum, so the latest CPAN release wins over a lower exact pin.
+func (r *Resolver) SetUpgrade(upgrade bool) {
+	r.upgrade = upgrade
+}
+
+// SetPreferBackPAN makes the resolver look up exact version pins
+// ("== 1.23") on MetaCPAN without consulting the CPAN index, so the
+// release MetaCPAN lists for that version is always used.
+func (r *Resolver) SetPreferBackPAN(prefer bool) {
+	r.preferBackPAN = prefer
+}
+
+// SetVersionPolicy selects which release satisfying a requirement is
+// used. With VersionMinimum the oldest release MetaCPAN lists for the
+// providing distribution is taken, falling back to the usual lookup when
+// MetaCPAN has none. The default is VersionLatest.
+func (r *Resolver) SetVersionPolicy(policy VersionPolicy) {
+	r.versionPolicy = policy
+}
+
+// SetCyclePolicy selects how circular dependencies are handled. Such a
+// requirement is normally skipped, as the module is already being
+// resolved; CycleWarn also logs the cycle, e.g. "Foo -> Bar -> Foo", and
+// CycleError fails with it. The default is CycleSkip.
+func (r *Resolver) SetCyclePolicy(policy CyclePolicy) {
+	r.cyclePolicy = policy
+}
+
+// SetShallowModules marks modules that are resolved to a distribution but
+// whose own prerequisites are not followed, e.g. large frameworks whose
+// dependencies are managed separately.
+func (r *Resolver) SetShallowModules(modules []string) {
+	r.shallow = make(map[string]bool, len(modules))
+	for _, m := range modules {
+		r.shallow[m] = true
+	}
+}
+
+// SetNoTransitive makes the resolver pick a distribution for each module
+// passed to Resolve without following any prerequisites, like
+// SetShallowModules for every top-level module, e.g. for a minimal
+// manifest of direct dependencies. The distributions still list their
+// requirements.
+func (r *Resolver) SetNoTransitive(enabled bool) {
+	r.noTransitive = enabled
+}
+
+// SetSkipNamespaces excludes whole namespaces from resolution, e.g.
+// "Acme::" for Acme and every module below it. Matching modules are treated
+// like core modules: neither they nor their prerequisites are resolved.
+func (r *Resolver) SetSkipNamespaces(namespaces []string) {
+	r.skipNamespaces = r.skipNamespaces[:0]
+	for _, ns := range namespaces {
+		if ns = strings.TrimSuffix(ns, "::"); ns != "" {
+			r.skipNamespaces = append(r.skipNamespaces, ns)
+		}
 	}
 }
 
-// Resolve resolves all dependencies for the given requirements.
-func (r *Resolver) Resolve(reqs []dist.VersionReq) ([]*dist.Dist, error) {
+// SetConstraints sets version constraints by module, e.g. "< 2" for Foo,
+// that are combined with every request for that module, top-level or
+// transitive, like pip's constraints files. They are never resolved on
+// their own.
+func (r *Resolver) SetConstraints(constraints map[string]string) {
+	r.constraints = constraints
+}
+
+// SetMaxBackPANAge makes resolution fail when a requirement can only be
+// met by a BackPAN release older than age. Zero disables the check.
+func (r *Resolver) SetMaxBackPANAge(age time.Duration) {
+	r.maxBackPANAge = age
+}
+
+// SetPinnedDists forces distributions by pathname, e.g. a patched
+// A/AU/AUTHOR/Foo-1.23.tar.gz: any module one of them provides is resolved
+// to it, whatever the index says. The tarballs are fetched from the CPAN
+// mirror when Resolve starts.
+func (r *Resolver) SetPinnedDists(pathnames []string) {
+	r.pinned = pathnames
+	r.pins = nil
+}
+
+// SetCollectErrors makes Resolve continue past requirements that fail to
+// resolve and report all failures at the end, instead of stopping at the
+// first one.
+func (r *Resolver) SetCollectErrors(collect bool) {
+	r.collectErrors = collect
+}
+
+// Resolve resolves all dependencies for the given requirements and returns
+// the distributions sorted by name. A distribution providing several
+// modules may be listed more than once.
+// If ctx is cancelled, the distributions resolved so far are returned
+// together with the context error. With SetCollectErrors, they are also
+// returned together with the joined errors of every failed requirement.
+//
+// Test and develop requirements are resolved last, so every distribution
+// that is also needed at runtime is recorded with its runtime phase.
+func (r *Resolver) Resolve(ctx context.Context, reqs []dist.VersionReq) ([]*dist.Dist, error) {
+	if err := r.loadPins(ctx); err != nil {
+		return nil, err
+	}
+	if r.apiWorkers > 0 {
+		r.prefetch(ctx, reqs)
+	}
+
+	reqs = append([]dist.VersionReq(nil), reqs...)
+	sort.SliceStable(reqs, func(i, j int) bool {
+		return !reqs[i].Phase.IsTestOnly() && reqs[j].Phase.IsTestOnly()
+	})
+
+	var errs []error
+	resolved := make([]dist.VersionReq, 0, len(reqs))
 	for _, req := range reqs {
-		if err := r.resolveOne(req.Module, req.Version); err != nil {
+		r.requested[req.Module] = true
+		if len(req.Options) > 0 {
+			r.log.Warnf("%s: unsupported source options %s, resolving from CPAN", req.Module, formatOptions(req.Options))
+		}
+		if err := r.resolveOne(ctx, req.Module, req.Version, req.Phase, ""); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return r.dists(), ctxErr
+			}
+			// Once the mirror is given up on, every remaining download
+			// would fail the same way
+			if !r.collectErrors || errors.Is(err, downloader.ErrMirrorUnavailable) {
+				return nil, err
+			}
+			// Reported once, through the joined error
+			errs = append(errs, err)
+			continue
+		}
+		resolved = append(resolved, req)
+	}
+
+	if err := r.validate(resolved); err != nil {
+		if !r.collectErrors {
 			return nil, err
 		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return r.dists(), errors.Join(errs...)
+	}
+	return r.dists(), nil
+}
+
+// cycleStart returns the index in r.resolving of the module whose
+// prerequisites lead back to module, or -1 if none does. Besides module
+// itself, that is a module of the same distribution, e.g. Foo when Bar,
+// required by Foo, requires Foo::Util from the Foo distribution.
+func (r *Resolver) cycleStart(module string) int {
+	if i := slices.Index(r.resolving, module); i >= 0 {
+		return i
+	}
+	d, ok := r.resolved[module]
+	if !ok {
+		return -1
+	}
+	return slices.IndexFunc(r.resolving, func(m string) bool {
+		other := r.resolved[m]
+		return other != nil && other.Name == d.Name
+	})
+}
+
+// prefetch looks up the MetaCPAN download URLs of the exact pins in reqs
+// that resolveOne would send to BackPAN, so its lookups hit the cache.
+func (r *Resolver) prefetch(ctx context.Context, reqs []dist.VersionReq) {
+	var pins []dist.VersionReq
+	for _, req := range reqs {
+		if r.skipCore(req.Module) || r.skipNamespace(req.Module) {
+			continue
+		}
+		if _, pinned := r.pins[req.Module]; pinned {
+			continue
+		}
+		version := r.withConstraint(req.Module, r.constraint(req.Version))
+		if !isExact(version) {
+			continue
+		}
+		if !r.preferBackPAN {
+			if entry, found := r.cpanIndex.Lookup(req.Module); found && satisfies(entry.Version, version) {
+				continue
+			}
+		}
+		pins = append(pins, dist.VersionReq{Module: req.Module, Version: version})
 	}
+	if len(pins) == 0 {
+		return
+	}
+
+	r.log.Infof("Prefetching MetaCPAN download URLs for %d exact pins", len(pins))
+	kept := r.backpan.Prefetch(ctx, pins, r.apiWorkers)
+	r.log.Debugf("Prefetched %d of %d download URLs", kept, len(pins))
+}
+
+// TopLevel returns the sorted modules passed to Resolve directly, as
+// opposed to those pulled in as prerequisites.
+func (r *Resolver) TopLevel() []string {
+	modules := make([]string, 0, len(r.requested))
+	for mod := range r.requested {
+		modules = append(modules, mod)
+	}
+	sort.Strings(modules)
+	return modules
+}
 
+// dists returns the distributions resolved so far, sorted by name.
+func (r *Resolver) dists() []*dist.Dist {
 	dists := make([]*dist.Dist, 0, len(r.resolved))
 	for _, d := range r.resolved {
 		dists = append(dists, d)
 	}
-	return dists, nil
+	// Sorted, so that callers deduplicating the result (a distribution is
+	// listed once per module it provides) always see the same order
+	sort.Slice(dists, func(i, j int) bool {
+		if dists[i].Name != dists[j].Name {
+			return dists[i].Name < dists[j].Name
+		}
+		return dists[i].Pathname < dists[j].Pathname
+	})
+	return dists
 }
 
-func (r *Resolver) resolveOne(module, version string) error {
+// validate re-checks every top-level requirement against the version
+// provided by the distribution it resolved to. This guards against fallback
+// paths that end up with a release not matching the original request.
+func (r *Resolver) validate(reqs []dist.VersionReq) error {
+	var unsatisfied, modules []string
+	for _, req := range reqs {
+		if r.skipCore(req.Module) || r.skipNamespace(req.Module) {
+			continue
+		}
+		module := req.Module
+		if canonical, ok := r.aliases[module]; ok {
+			module = canonical
+		}
+		d, ok := r.resolved[module]
+		if !ok {
+			unsatisfied = append(unsatisfied, fmt.Sprintf("%s %s (not resolved)", req.Module, req.Version))
+			modules = append(modules, req.Module)
+			continue
+		}
+		have := d.Provides[module]
+		if !satisfies(have, r.withConstraint(module, r.constraint(req.Version))) {
+			unsatisfied = append(unsatisfied, fmt.Sprintf("%s %s (resolved %s from %s)", req.Module, req.Version, have, d.Name))
+			modules = append(modules, req.Module)
+		}
+	}
+
+	if len(unsatisfied) > 0 {
+		for _, u := range unsatisfied {
+			r.log.Errorf("unsatisfied requirement: %s", u)
+		}
+		return &Error{
+			Kind:   KindConflict,
+			Module: strings.Join(modules, ", "),
+			Err:    errors.New(strings.Join(unsatisfied, "; ")),
+		}
+	}
+	return nil
+}
+
+// resolveOne resolves module at version and its prerequisites. requester is
+// the name of the distribution requiring it, empty for a top-level
+// requirement.
+func (r *Resolver) resolveOne(ctx context.Context, module, version string, phase dist.Phase, requester string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Skip perl core modules
-	if isCore(module) {
+	if r.skipCore(module) {
+		r.emit(Event{Kind: EventSkipped, Module: module, Version: version, Reason: SkipCore})
+		return nil
+	}
+	if r.skipNamespace(module) {
+		r.log.Debugf("Skipping %s: excluded namespace", module)
+		r.emit(Event{Kind: EventSkipped, Module: module, Version: version, Reason: SkipNamespace})
 		return nil
 	}
 
+	if canonical, ok := r.aliases[module]; ok {
+		module = canonical
+	}
+	version = r.withConstraint(module, r.constraint(version))
+
+	// A module being resolved further up is usually resolved already and
+	// simply reused, unless the cycle is to be reported
+	cycleAt := r.cycleStart(module)
+	reportCycle := cycleAt >= 0 && (r.cyclePolicy == CycleWarn || r.cyclePolicy == CycleError)
+
 	// Check if already resolved with compatible version
-	if d, ok := r.resolved[module]; ok {
-		if satisfies(d.Provides[module], version) {
+	if d, ok := r.resolved[module]; ok && !reportCycle {
+		if r.satisfiedBy(module, d.Provides[module], version) {
 			return nil
 		}
 	}
 
 	// Detect circular dependency
-	if r.resolving[module] {
-		r.logFn("Skipping circular dependency: %s", module)
+	if cycleAt >= 0 {
+		cycle := strings.Join(append(slices.Clone(r.resolving[cycleAt:]), module), " -> ")
+		switch r.cyclePolicy {
+		case CycleError:
+			return &Error{Kind: KindCycle, Module: module, Err: fmt.Errorf("circular dependency %s", cycle)}
+		case CycleWarn:
+			r.log.Warnf("Skipping circular dependency: %s", cycle)
+		default:
+			r.log.Infof("Skipping circular dependency: %s", cycle)
+		}
+		r.emit(Event{Kind: EventSkipped, Module: module, Version: version, Reason: SkipCircular})
 		return nil
 	}
-	r.resolving[module] = true
-	defer func() { delete(r.resolving, module) }()
+	r.resolving = append(r.resolving, module)
+	defer func() { r.resolving = r.resolving[:len(r.resolving)-1] }()
 
-	r.logFn("Resolving: %s %s", module, version)
+	r.log.Infof("Resolving: %s %s", module, version)
+	r.emit(Event{Kind: EventStarted, Module: module, Version: version})
 
-	// Try CPAN first
-	entry, found := r.cpanIndex.Lookup(module)
-	var downloadURL, pathname, source string
+	// Try CPAN first. The index version only selects the release; the
+	// provides recorded for it always come from the tarball's META (see
+	// newDist), which may be newer than what the index lists.
+	pin, pinned := r.pins[module]
+	var entry dist.CPANIndex
+	var found bool
+	if !pinned && r.preferBackPAN && isExact(version) {
+		r.log.Infof("  Exact pin, skipping the CPAN index")
+	} else {
+		entry, found = r.cpanIndex.Lookup(module)
+	}
+	if !pinned && found && entry.Module != "" && entry.Module != module {
+		// A case-insensitive match: resolve under the indexed name
+		r.aliases[module] = entry.Module
+		return r.resolveOne(ctx, entry.Module, version, phase, requester)
+	}
+	var downloadURL, pathname, source, origin string
+	viaProvider, viaLocal := false, false
+	var oldest *index.BackPANResult
+	if !pinned && r.versionPolicy == VersionMinimum {
+		oldest = r.oldestRelease(ctx, module, version)
+	}
 
-	if found && satisfies(entry.Version, version) {
+	if pinned {
+		pathname = pin.pathname
+		downloadURL = downloader.TarballURL(r.cpanIndex.Mirror(), pathname)
+		source = "cpan"
+		origin = "pinned"
+		r.log.Infof("  Using pinned %s", pathname)
+	} else if oldest != nil {
+		downloadURL = oldest.DownloadURL
+		pathname = extractPathname(downloadURL)
+		source = "backpan"
+		origin = "oldest satisfying release on MetaCPAN"
+		if err := r.checkBackPANAge(oldest, pathname); err != nil {
+			return &Error{Kind: KindUnresolved, Module: module, Err: err}
+		}
+		r.log.Infof("  Oldest satisfying release: %s", pathname)
+	} else if found && r.satisfiedBy(module, entry.Version, version) {
 		pathname = entry.Pathname
-		downloadURL = fmt.Sprintf("%s/authors/id/%s", r.cpanIndex.Mirror(), pathname)
+		mirror := entry.Mirror
+		if mirror == "" {
+			mirror = r.cpanIndex.Mirror()
+		}
+		downloadURL = downloader.TarballURL(mirror, pathname)
 		source = "cpan"
-		r.logFn("  Found on CPAN: %s", pathname)
+		origin = "from CPAN index"
+		r.log.Infof("  Found on CPAN: %s", pathname)
 	} else {
 		// Fallback to BackPAN
-		r.logFn("  Trying BackPAN for %s %s", module, version)
-		result, err := r.backpan.Lookup(module, version)
+		r.log.Infof("  Trying BackPAN for %s %s", module, version)
+		result, err := r.backpan.Lookup(ctx, module, version)
+		if err != nil && !found {
+			// Not indexed anywhere: the module may be a package that only
+			// some distribution's provides lists
+			r.log.Infof("  Looking up the distribution providing %s", module)
+			if provider, perr := r.backpan.Provider(ctx, module); perr == nil {
+				result, err, viaProvider = provider, nil, true
+			} else {
+				r.log.Debugf("  %s: %v", module, perr)
+			}
+		}
+		if err != nil {
+			// Last resort: a tarball already in the backpan directory
+			if local, lerr := r.backpan.LookupLocal(module); lerr == nil {
+				result, err, viaLocal = local, nil, true
+			} else {
+				r.log.Debugf("  %s: %v", module, lerr)
+			}
+		}
 		if err != nil {
-			return fmt.Errorf("resolving %s: %w", module, err)
+			return &Error{Kind: KindUnresolved, Module: module, Err: err}
 		}
 		downloadURL = result.DownloadURL
 		pathname = extractPathname(downloadURL)
+		if result.Pathname != "" {
+			pathname = result.Pathname
+		}
 		source = "backpan"
-		r.logFn("  Found on BackPAN: %s", pathname)
+		origin = "from BackPAN"
+		switch {
+		case viaProvider:
+			origin = "from the distribution MetaCPAN lists as providing it"
+		case viaLocal:
+			origin = "from a local tarball in " + r.backpan.Dir()
+		}
+		if viaLocal {
+			// Curated tarballs have no release date to check
+			r.log.Infof("  Found locally: %s", pathname)
+		} else if err := r.checkBackPANAge(result, pathname); err != nil {
+			return &Error{Kind: KindUnresolved, Module: module, Err: err}
+		} else if r.preferBackPAN && isExact(version) {
+			r.log.Infof("  Found on BackPAN: %s", pathname)
+		} else {
+			r.log.Warnf("%s: not on CPAN, using %s from BackPAN", module, pathname)
+		}
+	}
+	r.emit(Event{Kind: EventFound, Module: module, Version: version, Pathname: pathname, Source: source})
+
+	var meta *extractor.MetaFile
+	if pinned {
+		meta = pin.meta
+	} else if (r.metaAPI || r.lazyDownload) && !viaLocal {
+		meta = r.releaseMeta(ctx, pathname)
+		if meta != nil && meta.ConfigureSkipped && r.lazyDownload && !r.metaAPI {
+			r.log.Infof("  Downloading %s to run its configure script", distNameFromPath(pathname))
+			meta = nil
+		}
+	}
+	if meta == nil {
+		var err error
+		if meta, err = r.fetchMeta(ctx, module, version, pathname, downloadURL, source); err != nil {
+			return err
+		}
+	}
+
+	if viaProvider || viaLocal || oldest != nil {
+		entry, ok := meta.Provides[module]
+		if !ok {
+			return &Error{Kind: KindUnresolved, Module: module, Err: fmt.Errorf("not provided by %s", distNameFromPath(pathname))}
+		}
+		if !r.satisfiedBy(module, string(entry.Version), version) {
+			return &Error{Kind: KindUnresolved, Module: module, Err: fmt.Errorf("%s provides version %s, want %s", distNameFromPath(pathname), entry.Version, version)}
+		}
+	}
+
+	d := newDist(module, pathname, source, meta)
+	d.Phase = phase
+	d.Reason = reason(module, version, requester, origin)
+	d.ConfigureSkipped = meta.ConfigureSkipped
+	if fromPath := distNameFromPath(pathname); d.Name != fromPath {
+		r.log.Infof("  Using META name %s instead of %s from the pathname", d.Name, fromPath)
+	}
+	if r.includeDevelop {
+		for mod, ver := range meta.Develop {
+			if _, ok := d.Requirements[mod]; !ok {
+				d.Requirements[mod] = ver
+				d.ReqPhases[mod] = dist.PhaseDevelop
+			}
+		}
+	}
+
+	// Mark as resolved (before recursing to handle circular deps)
+	r.resolved[module] = d
+	r.emit(Event{Kind: EventResolved, Module: module, Version: version, Pathname: pathname, Source: source, Dist: d.Name})
+	// Also mark by all provided modules
+	for mod, ver := range d.Provides {
+		other, exists := r.resolved[mod]
+		if !exists {
+			r.resolved[mod] = d
+			continue
+		}
+		if other.Name != d.Name && other.Provides[mod] != ver {
+			r.log.Warnf("%s is provided by both %s (%s) and %s (%s); keeping %s",
+				mod, other.Name, other.Provides[mod], d.Name, ver, other.Name)
+		}
+	}
+
+	if r.shallow[module] {
+		r.log.Infof("  Not following prerequisites of shallow module %s", module)
+		return nil
+	}
+	if r.noTransitive {
+		r.log.Infof("  Not following prerequisites of %s: direct dependencies only", module)
+		return nil
+	}
+
+	// Resolve dependencies
+	for depMod, depVer := range d.Requirements {
+		if err := r.resolveOne(ctx, depMod, depVer, phase, d.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// oldestRelease returns the oldest release satisfying version of the
+// distribution MetaCPAN lists as providing module, or nil if there is
+// none or MetaCPAN cannot list them.
+func (r *Resolver) oldestRelease(ctx context.Context, module, version string) *index.BackPANResult {
+	releases, err := r.backpan.Releases(ctx, module)
+	if err != nil {
+		r.log.Debugf("  Listing releases for %s: %v", module, err)
+		return nil
+	}
+	var oldest *index.BackPANResult
+	for i := range releases {
+		rel := &releases[i]
+		if rel.DownloadURL == "" || !satisfies(rel.Version, version) {
+			continue
+		}
+		if oldest == nil || dist.CompareVersions(rel.Version, oldest.Version) < 0 {
+			oldest = rel
+		}
+	}
+	return oldest
+}
+
+// reason describes why a distribution was chosen for module, for
+// dist.Dist.Reason.
+func reason(module, version, requester, origin string) string {
+	if version == "" || version == "0" {
+		version = "(any version)"
+	}
+	by := "requested directly"
+	if requester != "" {
+		by = "required by " + requester
+	}
+	return fmt.Sprintf("%s %s %s; %s", module, version, by, origin)
+}
+
+// loadPins downloads and extracts the distributions set by SetPinnedDists
+// and indexes them by the modules they provide. A dist whose META lists no
+// provides is indexed by the module named after it (Foo-Bar -> Foo::Bar).
+func (r *Resolver) loadPins(ctx context.Context) error {
+	if r.pins != nil || len(r.pinned) == 0 {
+		return nil
+	}
+	r.pins = make(map[string]pinnedDist)
+	for _, pathname := range r.pinned {
+		job := downloader.Job{
+			URL:      downloader.TarballURL(r.cpanIndex.Mirror(), pathname),
+			DestPath: r.downloader.CachePath(pathname),
+			Source:   "cpan",
+		}
+		if result := r.downloader.DownloadContext(ctx, []downloader.Job{job})[0]; result.Error != nil {
+			return &Error{Kind: KindDownload, Module: pathname, Err: result.Error}
+		}
+		meta, err := r.extractor.ExtractWithConfigure(ctx, job.DestPath)
+		if err != nil {
+			return fmt.Errorf("pinned %s: %w", pathname, err)
+		}
+
+		modules := make([]string, 0, len(meta.Provides))
+		for mod := range meta.Provides {
+			modules = append(modules, mod)
+		}
+		sort.Strings(modules)
+		if len(modules) == 0 {
+			name := dist.BaseName(distNameFromPath(pathname))
+			modules = append(modules, strings.ReplaceAll(name, "-", "::"))
+		}
+		for _, mod := range modules {
+			if other, ok := r.pins[mod]; ok {
+				return fmt.Errorf("%s is provided by both pinned %s and %s", mod, other.pathname, pathname)
+			}
+			r.pins[mod] = pinnedDist{pathname: pathname, meta: meta}
+		}
+		r.log.Infof("Pinned %s for %s", pathname, strings.Join(modules, ", "))
+	}
+	return nil
+}
+
+// checkBackPANAge enforces SetMaxBackPANAge on a BackPAN lookup result.
+// Releases without a usable date are let through with a warning.
+func (r *Resolver) checkBackPANAge(result *index.BackPANResult, pathname string) error {
+	if r.maxBackPANAge <= 0 {
+		return nil
 	}
+	released, err := result.Released()
+	if err != nil {
+		r.log.Warnf("%s: %v, cannot check BackPAN age", pathname, err)
+		return nil
+	}
+	if age := time.Since(released); age > r.maxBackPANAge {
+		return fmt.Errorf("BackPAN release %s is %.1f years old (released %s), older than the allowed %.1f years",
+			distNameFromPath(pathname), age.Hours()/24/365, released.Format("2006-01-02"), r.maxBackPANAge.Hours()/24/365)
+	}
+	return nil
+}
 
-	// Download the tarball
+// fetchMeta downloads a distribution tarball and extracts its metadata.
+func (r *Resolver) fetchMeta(ctx context.Context, module, version, pathname, downloadURL, source string) (*extractor.MetaFile, error) {
 	var destPath string
 	if source == "cpan" {
 		destPath = r.downloader.CachePath(pathname)
@@ -124,57 +734,124 @@ func (r *Resolver) resolveOne(module, version string) error {
 		DestPath: destPath,
 		Source:   source,
 	}}
-	results := r.downloader.Download(jobs)
+	results := r.downloader.DownloadContext(ctx, jobs)
 	if results[0].Error != nil {
-		return fmt.Errorf("downloading %s: %w", module, results[0].Error)
+		return nil, &Error{Kind: KindDownload, Module: module, Err: results[0].Error}
 	}
+	r.emit(Event{Kind: EventDownloaded, Module: module, Version: version, Pathname: pathname, Source: source})
 
 	// Extract META (with configure to resolve dynamic prerequisites)
-	meta, err := r.extractor.ExtractWithConfigure(destPath)
+	meta, err := r.extractor.ExtractWithConfigure(ctx, destPath)
+	r.emit(Event{Kind: EventExtracted, Module: module, Version: version, Pathname: pathname, Source: source})
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return nil, ctxErr
+	}
 	if err != nil {
-		r.logFn("  Warning: %v, using minimal metadata", err)
+		r.log.Warnf("%s: %v, using minimal metadata", module, err)
 		meta = &extractor.MetaFile{
 			Name:         extractor.FlexVersion(distNameFromPath(pathname)),
 			Provides:     map[string]extractor.ProvidesEntry{module: {Version: extractor.FlexVersion(version)}},
 			Requirements: map[string]string{},
 		}
+	} else {
+		if meta.MetaSpec != "" || meta.GeneratedBy != "" {
+			r.log.Infof("  META spec %s, generated by %s", meta.MetaSpec, meta.GeneratedBy)
+		}
+		if meta.SerializationBackend != "" {
+			r.log.Debugf("  META serialized by %s", meta.SerializationBackend)
+		}
+		for _, w := range meta.Warnings {
+			r.log.Warnf("%s: %s", module, w)
+		}
+		if meta.ConfigureSkipped {
+			r.log.Warnf("%s: offline, skipped configure and used static META; dynamic prerequisites may be missing", module)
+		}
+	}
+
+	return meta, nil
+}
+
+// releaseMeta builds metadata from the MetaCPAN release API, returning nil
+// if it is unavailable.
+func (r *Resolver) releaseMeta(ctx context.Context, pathname string) *extractor.MetaFile {
+	author := dist.CPANIndex{Pathname: pathname}.Author()
+	name := distNameFromPath(pathname)
+	release, err := r.backpan.Release(ctx, author, name)
+	if err != nil {
+		r.log.Infof("  MetaCPAN metadata unavailable for %s: %v", name, err)
+		return nil
+	}
+
+	meta := &extractor.MetaFile{
+		Name:             extractor.FlexVersion(release.Distribution),
+		Version:          extractor.FlexVersion(release.Version),
+		Provides:         make(map[string]extractor.ProvidesEntry),
+		Prereqs:          make(map[string]map[string]interface{}),
+		ConfigureSkipped: release.Dynamic(),
+	}
+	for _, mod := range release.Provides {
+		meta.Provides[mod] = extractor.ProvidesEntry{Version: extractor.FlexVersion(release.Version)}
+	}
+	for _, dep := range release.Dependencies {
+		if meta.Prereqs[dep.Phase] == nil {
+			meta.Prereqs[dep.Phase] = make(map[string]interface{})
+		}
+		deps, _ := meta.Prereqs[dep.Phase][dep.Relationship].(map[string]interface{})
+		if deps == nil {
+			deps = make(map[string]interface{})
+			meta.Prereqs[dep.Phase][dep.Relationship] = deps
+		}
+		deps[dep.Module] = dep.Version
 	}
+	r.extractor.Flatten(meta)
 
-	// Create Dist
+	r.log.Infof("  Using MetaCPAN metadata for %s", name)
+	if meta.ConfigureSkipped {
+		r.log.Infof("  %s has dynamic prerequisites, which MetaCPAN metadata may not list", name)
+	}
+	return meta
+}
+
+// newDist builds a Dist from extracted metadata. Provides come from META;
+// the requested module is only added (at the dist version) when META does not
+// list it, so a more specific per-module version is never overwritten.
+// The name comes from META's name and version when present, since the
+// tarball file name may spell it differently.
+func newDist(module, pathname, source string, meta *extractor.MetaFile) *dist.Dist {
 	d := &dist.Dist{
-		Name:         distNameFromPath(pathname),
+		Name:         distName(pathname, meta),
 		Pathname:     pathname,
 		Provides:     make(map[string]string),
 		Requirements: meta.Requirements,
+		ReqPhases:    make(map[string]dist.Phase, len(meta.Phases)),
 		Source:       source,
 	}
 
-	// Populate provides
+	for mod, phase := range meta.Phases {
+		d.ReqPhases[mod] = dist.Phase(phase)
+	}
 	for mod, entry := range meta.Provides {
 		d.Provides[mod] = string(entry.Version)
 	}
-	// Ensure the main module is in provides
-	if _, ok := d.Provides[module]; !ok {
+	if _, ok := meta.Provides[module]; !ok {
 		d.Provides[module] = string(meta.Version)
 	}
 
-	// Mark as resolved (before recursing to handle circular deps)
-	r.resolved[module] = d
-	// Also mark by all provided modules
-	for mod := range d.Provides {
-		if _, exists := r.resolved[mod]; !exists {
-			r.resolved[mod] = d
-		}
-	}
+	return d
+}
 
-	// Resolve dependencies
-	for depMod, depVer := range d.Requirements {
-		if err := r.resolveOne(depMod, depVer); err != nil {
-			return err
-		}
+func formatOptions(options map[string]string) string {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	return nil
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s => %s", k, options[k])
+	}
+	return strings.Join(parts, ", ")
 }
 
 func extractPathname(url string) string {
@@ -188,11 +865,21 @@ func extractPathname(url string) string {
 	return parts[len(parts)-1]
 }
 
+// distName returns META's name-version, falling back to the name derived
+// from pathname when META lacks either part.
+func distName(pathname string, meta *extractor.MetaFile) string {
+	if meta.Name == "" || meta.Version == "" {
+		return distNameFromPath(pathname)
+	}
+	return strings.ReplaceAll(string(meta.Name), "::", "-") + "-" + string(meta.Version)
+}
+
 func distNameFromPath(pathname string) string {
 	// A/AU/AUTHOR/Dist-Name-1.23.tar.gz -> Dist-Name-1.23
 	base := filepath.Base(pathname)
 	base = strings.TrimSuffix(base, ".tar.gz")
 	base = strings.TrimSuffix(base, ".tgz")
+	base = strings.TrimSuffix(base, ".tar")
 	return base
 }
 
@@ -300,12 +987,88 @@ var coreModules = map[string]bool{
 	"encoding": true, "encoding::warnings": true,
 }
 
+// skipCore reports whether module is left out of resolution as part of perl.
+func (r *Resolver) skipCore(module string) bool {
+	if r.includeCore {
+		return module == "perl"
+	}
+	return isCore(module)
+}
+
+// skipNamespace reports whether module is in a namespace excluded with
+// SetSkipNamespaces.
+func (r *Resolver) skipNamespace(module string) bool {
+	for _, ns := range r.skipNamespaces {
+		if module == ns || strings.HasPrefix(module, ns+"::") {
+			return true
+		}
+	}
+	return false
+}
+
 func isCore(module string) bool {
 	return coreModules[module]
 }
 
+// constraint returns the version constraint the resolver enforces for want.
+// With upgrade set, only its lower bounds are kept.
+func (r *Resolver) constraint(want string) string {
+	if !r.upgrade {
+		return want
+	}
+	return minimumOf(want)
+}
+
+// withConstraint returns want combined with the constraint set for module
+// by SetConstraints. Bounds already part of want are not repeated.
+func (r *Resolver) withConstraint(module, want string) string {
+	c, ok := r.constraints[module]
+	if !ok {
+		return want
+	}
+	return dist.CombineConstraints(want, c)
+}
+
+// minimumOf reduces a version constraint to its lower bounds: exact pins
+// become ">=" and upper bounds and exclusions are dropped.
+func minimumOf(want string) string {
+	var mins []string
+	for _, c := range strings.Split(want, ",") {
+		c = strings.TrimSpace(c)
+		switch {
+		case c == "" || c == "0":
+		case strings.HasPrefix(c, "<"), strings.HasPrefix(c, "!="):
+		case strings.HasPrefix(c, "=="):
+			mins = append(mins, ">= "+strings.TrimSpace(c[2:]))
+		case strings.HasPrefix(c, "~"):
+			mins = append(mins, ">= "+strings.TrimSpace(c[1:]))
+		default:
+			mins = append(mins, c)
+		}
+	}
+	if len(mins) == 0 {
+		return "0"
+	}
+	return strings.Join(mins, ", ")
+}
+
+// isExact reports whether want pins a single version, e.g. "== 1.23".
+func isExact(want string) bool {
+	return strings.HasPrefix(strings.TrimSpace(want), "==") && !strings.Contains(want, ",")
+}
+
 var versionRe = regexp.MustCompile(`^v?(\d+(?:\.\d+)*)`)
 
+// satisfiedBy is satisfies for module, warning once per module when have
+// only satisfies want because the version of module is undef.
+func (r *Resolver) satisfiedBy(module, have, want string) bool {
+	if have == "undef" && want != "" && want != "0" && !r.undefSeen[module] {
+		r.undefSeen[module] = true
+		r.log.Warnf("%s has an undef version, accepting it for %s", module, want)
+	}
+	return satisfies(have, want)
+}
+
 func satisfies(have, want string) bool {
 	if want == "" || want == "0" {
 		return true
@@ -335,31 +1098,13 @@ func satisfiesOne(have, want string) bool {
 		return true
 	}
 
-	var op, wantVer string
-	if strings.HasPrefix(want, ">=") {
-		op = ">="
-		wantVer = strings.TrimSpace(want[2:])
-	} else if strings.HasPrefix(want, "<=") {
-		op = "<="
-		wantVer = strings.TrimSpace(want[2:])
-	} else if strings.HasPrefix(want, "!=") {
-		op = "!="
-		wantVer = strings.TrimSpace(want[2:])
-	} else if strings.HasPrefix(want, ">") {
-		op = ">"
-		wantVer = strings.TrimSpace(want[1:])
-	} else if strings.HasPrefix(want, "<") {
-		op = "<"
-		wantVer = strings.TrimSpace(want[1:])
-	} else if strings.HasPrefix(want, "==") {
-		op = "=="
-		wantVer = strings.TrimSpace(want[2:])
-	} else {
-		op = ">="
-		wantVer = want
+	if strings.HasPrefix(want, "~") {
+		return satisfies(have, dist.ExpandTilde(want))
 	}
 
-	cmp := compareVersions(have, wantVer)
+	op, wantVer := dist.SplitConstraint(want)
+
+	cmp := dist.CompareVersions(have, wantVer)
 	switch op {
 	case ">=":
 		return cmp >= 0
@@ -376,78 +1121,3 @@ func satisfiesOne(have, want string) bool {
 	}
 	return true
 }
-
-func compareVersions(a, b string) int {
-	aParts := normalizeVersion(a)
-	bParts := normalizeVersion(b)
-
-	maxLen := len(aParts)
-	if len(bParts) > maxLen {
-		maxLen = len(bParts)
-	}
-
-	for i := 0; i < maxLen; i++ {
-		aVal := 0
-		bVal := 0
-		if i < len(aParts) {
-			aVal = aParts[i]
-		}
-		if i < len(bParts) {
-			bVal = bParts[i]
-		}
-		if aVal < bVal {
-			return -1
-		}
-		if aVal > bVal {
-			return 1
-		}
-	}
-	return 0
-}
-
-// normalizeVersion converts a Perl version string to a slice of integers.
-// Handles both dotted (v3.18.0, 3.18.0) and decimal (3.007004) formats.
-// Decimal format: 3.007004 -> [3, 7, 4] (groups of 3 digits in fractional part)
-// Dotted format: 3.18.0 -> [3, 18, 0]
-func normalizeVersion(v string) []int {
-	v = strings.TrimPrefix(v, "v")
-	if v == "" {
-		return []int{0}
-	}
-
-	parts := strings.Split(v, ".")
-	if len(parts) == 1 {
-		// Just a number like "5"
-		n, _ := strconv.Atoi(parts[0])
-		return []int{n}
-	}
-
-	// Check if this is decimal format (fractional part has many digits, no dots after first)
-	// e.g., 3.007004 vs 3.18.0
-	if len(parts) == 2 && len(parts[1]) > 3 {
-		// Decimal format - split fractional part into groups of 3
-		major, _ := strconv.Atoi(parts[0])
-		result := []int{major}
-
-		frac := parts[1]
-		for len(frac) > 0 {
-			chunk := frac
-			if len(chunk) > 3 {
-				chunk = frac[:3]
-				frac = frac[3:]
-			} else {
-				frac = ""
-			}
-			n, _ := strconv.Atoi(chunk)
-			result = append(result, n)
-		}
-		return result
-	}
-
-	// Dotted format - parse each part as integer
-	result := make([]int, len(parts))
-	for i, p := range parts {
-		result[i], _ = strconv.Atoi(p)
-	}
-	return result
-}
@@ -1,6 +1,30 @@
 package resolver
 
-import "testing"
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/extractor"
+	"github.com/frederic-klein/yacm/internal/index"
+	"github.com/frederic-klein/yacm/internal/logger"
+	"github.com/frederic-klein/yacm/internal/snapshot"
+)
 
 func TestSatisfies(t *testing.T) {
 	tests := []struct {
@@ -32,6 +56,11 @@ func TestSatisfies(t *testing.T) {
 		{"undef", "0", true},
 		{"undef", "1.0", true},  // undef satisfies any version
 		{"undef", ">= 2.0", true},
+		{"1.5", "~1.2", true},
+		{"1.2", "~1.2", true},
+		{"1.1", "~1.2", false},
+		{"2.0", "~1.2", false},
+		{"1.9", "~ 1.2", true},
 		{"", "0", true},
 	}
 
@@ -45,73 +74,289 @@ func TestSatisfies(t *testing.T) {
 	}
 }
 
-func TestCompareVersions(t *testing.T) {
-	tests := []struct {
-		a    string
-		b    string
-		want int
-	}{
-		{"1.0", "1.0", 0},
-		{"1.0", "2.0", -1},
-		{"2.0", "1.0", 1},
-		{"1.10", "1.9", 1},
-		{"1.2.3", "1.2.3", 0},
-		{"1.2.3", "1.2.4", -1},
-		{"1.2.4", "1.2.3", 1},
-		{"v1.0", "1.0", 0},
-		{"1", "1.0", 0},
-		{"1.0", "1", 0},
-		{"1.001", "1.1", 0},
-		// Perl decimal format tests
-		{"3.18.0", "3.007004", 1},  // 3.18.0 > 3.7.4
-		{"3.007004", "3.18.0", -1}, // 3.7.4 < 3.18.0
-		{"3.007004", "3.007004", 0},
-		{"0.080001", "0.08", 1},    // 0.80.1 > 0.8
-		{"2.005005", "2.005", 1},   // 2.5.5 > 2.5
+func TestResolver_Resolve_Cancelled(t *testing.T) {
+	// Arrange: Cancel while looking up Moo's dependency on MetaCPAN
+	env := newTestEnv(t)
+	env.addIndexed("Moo", "2.0", "H/HA/HAARG/Moo-2.0.tar.gz",
+		metaJSON("Moo", "Moo", "2.0", map[string]string{"Role::Tiny": "1.0"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env.onLookup = func(string) { cancel() }
+	res := env.resolver()
+
+	// Act
+	dists, err := res.Resolve(ctx, []dist.VersionReq{{Module: "Moo", Version: "0"}})
+
+	// Assert
+	if err != context.Canceled {
+		t.Fatalf("Resolve() error = %v, want context.Canceled", err)
+	}
+	if len(dists) == 0 || dists[0].Name != "Moo-2.0" {
+		t.Errorf("partial dists = %v, want Moo-2.0", dists)
 	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
-			got := compareVersions(tt.a, tt.b)
-			if got != tt.want {
-				t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
-			}
-		})
+func TestResolver_Resolve_MetaAPI(t *testing.T) {
+	// Arrange: No tarballs are available, only MetaCPAN release metadata
+	env := newTestEnv(t)
+	env.packages = []string{
+		"Moo\t2.0\tH/HA/HAARG/Moo-2.0.tar.gz",
+		"Role::Tiny\t2.1\tH/HA/HAARG/Role-Tiny-2.1.tar.gz",
+	}
+	env.releases["HAARG/Moo-2.0"] = `{
+		"name": "Moo-2.0", "distribution": "Moo", "version": "2.0",
+		"provides": ["Moo", "Moo::Role"],
+		"dependency": [
+			{"module": "Role::Tiny", "version": "1.0", "phase": "runtime", "relationship": "requires"},
+			{"module": "Test::Fatal", "version": "0", "phase": "test", "relationship": "requires"}
+		]
+	}`
+	env.releases["HAARG/Role-Tiny-2.1"] = `{"release": {
+		"name": "Role-Tiny-2.1", "distribution": "Role-Tiny", "version": "2.1",
+		"provides": ["Role::Tiny"], "dependency": []
+	}}`
+	res := env.resolver()
+	res.SetMetaAPI(true)
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Moo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	byName := make(map[string]*dist.Dist)
+	for _, d := range dists {
+		byName[d.Name] = d
+	}
+	moo, ok := byName["Moo-2.0"]
+	if !ok {
+		t.Fatalf("Moo-2.0 not resolved, got %v", byName)
+	}
+	if moo.Requirements["Role::Tiny"] != "1.0" {
+		t.Errorf("Moo requirements = %v, want Role::Tiny 1.0", moo.Requirements)
+	}
+	if _, ok := moo.Requirements["Test::Fatal"]; ok {
+		t.Error("test-phase dependency should not be a requirement")
+	}
+	if moo.Provides["Moo::Role"] != "2.0" {
+		t.Errorf("Moo provides = %v, want Moo::Role 2.0", moo.Provides)
+	}
+	if _, ok := byName["Role-Tiny-2.1"]; !ok {
+		t.Errorf("Role-Tiny-2.1 not resolved, got %v", byName)
 	}
 }
 
-func TestNormalizeVersion(t *testing.T) {
+func TestResolver_SetLazyDownload(t *testing.T) {
+	// Arrange: Foo has static MetaCPAN metadata, Bar sets dynamic_config and
+	// Baz has no metadata; all three tarballs are available
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		metaJSON("Foo", "Foo", "1.0", map[string]string{"Bar": "0", "Baz": "0"}))
+	env.addIndexed("Bar", "2.0", "A/AU/AUTHOR/Bar-2.0.tar.gz",
+		metaJSON("Bar", "Bar", "2.0", map[string]string{"Baz": "1.0"}))
+	env.addIndexed("Baz", "1.5", "A/AU/AUTHOR/Baz-1.5.tar.gz",
+		metaJSON("Baz", "Baz", "1.5", nil))
+	env.releases["AUTHOR/Foo-1.0"] = `{
+		"name": "Foo-1.0", "distribution": "Foo", "version": "1.0", "provides": ["Foo"],
+		"dependency": [
+			{"module": "Bar", "version": "0", "phase": "runtime", "relationship": "requires"},
+			{"module": "Baz", "version": "0", "phase": "runtime", "relationship": "requires"}
+		],
+		"metadata": {"dynamic_config": 0}
+	}`
+	env.releases["AUTHOR/Bar-2.0"] = `{
+		"name": "Bar-2.0", "distribution": "Bar", "version": "2.0", "provides": ["Bar"],
+		"dependency": [], "metadata": {"dynamic_config": 1}
+	}`
+	res := env.resolver()
+	res.SetLazyDownload(true)
+	var downloaded []string
+	res.SetObserver(func(e Event) {
+		if e.Kind == EventDownloaded {
+			downloaded = append(downloaded, e.Module)
+		}
+	})
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	sort.Strings(downloaded)
+	if want := []string{"Bar", "Baz"}; strings.Join(downloaded, " ") != strings.Join(want, " ") {
+		t.Errorf("downloaded %v, want %v", downloaded, want)
+	}
+	for _, d := range dists {
+		if d.Name == "Bar-2.0" && d.Requirements["Baz"] != "1.0" {
+			t.Errorf("Bar requirements = %v, want Baz 1.0 from its tarball", d.Requirements)
+		}
+	}
+	if len(dists) != 3 {
+		t.Errorf("resolved %d distributions, want 3", len(dists))
+	}
+}
+
+func TestResolver_SetMetaCPANWorkers(t *testing.T) {
+	// Arrange: Foo and Bar are pinned to BackPAN releases, Baz's pin is
+	// satisfied by the CPAN index
+	env := newTestEnv(t)
+	env.addBackPAN("Foo", "== 1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz", metaJSON("Foo", "Foo", "1.0", nil))
+	env.addBackPAN("Bar", "== 2.0", "A/AU/AUTHOR/Bar-2.0.tar.gz", metaJSON("Bar", "Bar", "2.0", nil))
+	env.addIndexed("Baz", "1.0", "A/AU/AUTHOR/Baz-1.0.tar.gz", metaJSON("Baz", "Baz", "1.0", nil))
+	env.addIndexed("Foo", "1.5", "A/AU/AUTHOR/Foo-1.5.tar.gz", metaJSON("Foo", "Foo", "1.5", nil))
+	var mu sync.Mutex
+	var lookups []string
+	env.onLookup = func(module string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups = append(lookups, module)
+	}
+	res := env.resolver()
+	res.SetMetaCPANWorkers(2)
+	beforeWalk := -1
+	res.SetObserver(func(e Event) {
+		if e.Kind == EventStarted && beforeWalk < 0 {
+			beforeWalk = len(lookups)
+		}
+	})
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{
+		{Module: "Foo", Version: "== 1.0"},
+		{Module: "Bar", Version: "== 2.0"},
+		{Module: "Baz", Version: "== 1.0"},
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(dists) != 3 {
+		t.Errorf("resolved %d distributions, want 3", len(dists))
+	}
+	sort.Strings(lookups)
+	if got := strings.Join(lookups, " "); got != "Bar Foo" {
+		t.Errorf("MetaCPAN lookups = %q, want each BackPAN pin once", got)
+	}
+	if beforeWalk != 2 {
+		t.Errorf("%d lookups done before resolving, want both pins prefetched", beforeWalk)
+	}
+}
+
+func TestResolver_SetCyclePolicy(t *testing.T) {
+	// Arrange: Foo requires Bar, which requires Baz, which requires Foo
 	tests := []struct {
-		input string
-		want  []int
+		name        string
+		policy      CyclePolicy
+		wantWarning string
+		wantErr     string
 	}{
-		{"1.0", []int{1, 0}},
-		{"3.18.0", []int{3, 18, 0}},
-		{"3.007004", []int{3, 7, 4}},   // Decimal format
-		{"0.080001", []int{0, 80, 1}},  // Decimal format
-		{"2.005005", []int{2, 5, 5}},   // Decimal format
-		{"v1.2.3", []int{1, 2, 3}},
-		{"5", []int{5}},
-		{"", []int{0}},
+		{name: "skip", policy: CycleSkip},
+		{name: "warn", policy: CycleWarn, wantWarning: "Skipping circular dependency: Foo -> Bar -> Baz -> Foo"},
+		{name: "error", policy: CycleError, wantErr: "resolving Foo: circular dependency Foo -> Bar -> Baz -> Foo"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			got := normalizeVersion(tt.input)
-			if len(got) != len(tt.want) {
-				t.Errorf("normalizeVersion(%q) = %v, want %v", tt.input, got, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", map[string]string{"Bar": "0"}))
+			env.addIndexed("Bar", "1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+				metaJSON("Bar", "Bar", "1.0", map[string]string{"Baz": "0"}))
+			env.addIndexed("Baz", "1.0", "A/AU/AUTHOR/Baz-1.0.tar.gz",
+				metaJSON("Baz", "Baz", "1.0", map[string]string{"Foo": "0"}))
+			res := env.resolver()
+			var logs bytes.Buffer
+			res.log = logger.New(&logs, logger.LevelWarn)
+			res.SetCyclePolicy(tt.policy)
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}})
+
+			// Assert
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+				}
 				return
 			}
-			for i := range got {
-				if got[i] != tt.want[i] {
-					t.Errorf("normalizeVersion(%q) = %v, want %v", tt.input, got, tt.want)
-					return
-				}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if len(dists) != 3 {
+				t.Errorf("resolved %d distributions, want 3", len(dists))
+			}
+			if tt.wantWarning == "" && logs.Len() > 0 {
+				t.Errorf("unexpected warnings:\n%s", logs.String())
+			}
+			if tt.wantWarning != "" && !strings.Contains(logs.String(), tt.wantWarning) {
+				t.Errorf("warnings =\n%s\nwant %q", logs.String(), tt.wantWarning)
 			}
 		})
 	}
 }
 
+func TestResolver_SetCyclePolicy_DistLevel(t *testing.T) {
+	// Arrange: Foo requires Bar, which requires Foo::Util from the Foo distribution
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"},"Foo::Util":{"file":"lib/Foo/Util.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"0"}}}}`)
+	env.packages = append(env.packages, "Foo::Util\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz")
+	env.addIndexed("Bar", "1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+		metaJSON("Bar", "Bar", "1.0", map[string]string{"Foo::Util": "0"}))
+	res := env.resolver()
+	var logs bytes.Buffer
+	res.log = logger.New(&logs, logger.LevelWarn)
+	res.SetCyclePolicy(CycleWarn)
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	names := make(map[string]bool)
+	for _, d := range dists {
+		names[d.Name] = true
+	}
+	if len(names) != 2 || !names["Foo-1.0"] || !names["Bar-1.0"] {
+		t.Errorf("resolved %v, want Foo-1.0 and Bar-1.0", names)
+	}
+	if want := "Skipping circular dependency: Foo -> Bar -> Foo::Util"; !strings.Contains(logs.String(), want) {
+		t.Errorf("warnings =\n%s\nwant %q", logs.String(), want)
+	}
+}
+
+func TestResolver_Resolve_UndefVersionWarnedOnce(t *testing.T) {
+	// Arrange: Foo and Bar both require a minimum version of Undef, whose
+	// version is undef
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		metaJSON("Foo", "Foo", "1.0", map[string]string{"Bar": "0", "Undef": "1.0"}))
+	env.addIndexed("Bar", "1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+		metaJSON("Bar", "Bar", "1.0", map[string]string{"Undef": "2.0"}))
+	env.addIndexed("Undef", "undef", "A/AU/AUTHOR/Undef-1.0.tar.gz",
+		metaJSON("Undef", "Undef", "undef", nil))
+	res := env.resolver()
+	var logs bytes.Buffer
+	res.log = logger.New(&logs, logger.LevelWarn)
+
+	// Act
+	_, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}, {Module: "Undef", Version: "0.5"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := strings.Count(logs.String(), "Undef has an undef version"); got != 1 {
+		t.Errorf("warned %d times about Undef, want once:\n%s", got, logs.String())
+	}
+}
+
 func TestIsCore(t *testing.T) {
 	cores := []string{"perl", "strict", "warnings", "Exporter", "Carp"}
 	for _, mod := range cores {
@@ -128,6 +373,33 @@ func TestIsCore(t *testing.T) {
 	}
 }
 
+func TestIsCoreFor(t *testing.T) {
+	tests := []struct {
+		module string
+		perl   string
+		want   bool
+	}{
+		{"strict", "5.8", true},
+		{"Sub::Util", "5.20", false},
+		{"Sub::Util", "5.22", true},
+		{"Sub::Util", "5.036", true},
+		{"parent", "5.10.0", false},
+		{"parent", "5.010001", true},
+		{"Pod::Parser", "5.30", true},
+		{"Pod::Parser", "5.32", false},
+		{"Pod::Parser", "", true},
+		{"Moo", "5.36", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.module+"_"+tt.perl, func(t *testing.T) {
+			if got := IsCoreFor(tt.module, tt.perl); got != tt.want {
+				t.Errorf("IsCoreFor(%q, %q) = %v, want %v", tt.module, tt.perl, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDistNameFromPath(t *testing.T) {
 	tests := []struct {
 		path string
@@ -136,6 +408,7 @@ func TestDistNameFromPath(t *testing.T) {
 		{"M/MA/MAKAMAKA/JSON-2.0.tar.gz", "JSON-2.0"},
 		{"H/HA/HAARG/Moo-2.005005.tar.gz", "Moo-2.005005"},
 		{"S/SH/SHAY/Perl-Dist-1.23.tgz", "Perl-Dist-1.23"},
+		{"A/AU/AUTHOR/Plain-1.0.tar", "Plain-1.0"},
 	}
 
 	for _, tt := range tests {
@@ -147,3 +420,1076 @@ func TestDistNameFromPath(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDist_MetaProvidesVersionWins(t *testing.T) {
+	// Arrange: libwww-perl provides LWP at a version different from the dist version
+	meta := &extractor.MetaFile{
+		Name:    "libwww-perl",
+		Version: "6.72",
+		Provides: map[string]extractor.ProvidesEntry{
+			"LWP":            {File: "lib/LWP.pm", Version: "6.72001"},
+			"LWP::UserAgent": {File: "lib/LWP/UserAgent.pm", Version: "6.72"},
+		},
+		Requirements: map[string]string{},
+	}
+
+	// Act
+	d := newDist("LWP", "O/OA/OALDERS/libwww-perl-6.72.tar.gz", "cpan", meta)
+
+	// Assert
+	if d.Name != "libwww-perl-6.72" {
+		t.Errorf("Name = %q, want libwww-perl-6.72", d.Name)
+	}
+	if d.Provides["LWP"] != "6.72001" {
+		t.Errorf("Provides[LWP] = %q, want 6.72001 (from META provides)", d.Provides["LWP"])
+	}
+}
+
+func TestNewDist_NameFromMeta(t *testing.T) {
+	tests := []struct {
+		name     string
+		pathname string
+		meta     extractor.MetaFile
+		want     string
+	}{
+		{
+			name:     "matching",
+			pathname: "H/HA/HAARG/Moo-2.0.tar.gz",
+			meta:     extractor.MetaFile{Name: "Moo", Version: "2.0"},
+			want:     "Moo-2.0",
+		},
+		{
+			name:     "underscore in file name",
+			pathname: "A/AU/AUTHOR/Foo_Bar-1.0.tar.gz",
+			meta:     extractor.MetaFile{Name: "Foo-Bar", Version: "1.0"},
+			want:     "Foo-Bar-1.0",
+		},
+		{
+			name:     "module-style META name",
+			pathname: "A/AU/AUTHOR/Foo-Bar-1.0.tgz",
+			meta:     extractor.MetaFile{Name: "Foo::Bar", Version: "1.0"},
+			want:     "Foo-Bar-1.0",
+		},
+		{
+			name:     "META without version",
+			pathname: "A/AU/AUTHOR/Foo_Bar-1.0.tar.gz",
+			meta:     extractor.MetaFile{Name: "Foo-Bar"},
+			want:     "Foo_Bar-1.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			d := newDist("Foo::Bar", tt.pathname, "cpan", &tt.meta)
+
+			// Assert
+			if d.Name != tt.want {
+				t.Errorf("Name = %q, want %q", d.Name, tt.want)
+			}
+			if d.Pathname != tt.pathname {
+				t.Errorf("Pathname = %q, want %q", d.Pathname, tt.pathname)
+			}
+		})
+	}
+}
+
+func TestNewDist_AddsMissingModule(t *testing.T) {
+	// Arrange: META without a provides section
+	meta := &extractor.MetaFile{
+		Name:         "Foo-Bar",
+		Version:      "1.5",
+		Requirements: map[string]string{},
+	}
+
+	// Act
+	d := newDist("Foo::Bar", "A/AU/AUTHOR/Foo-Bar-1.5.tar.gz", "cpan", meta)
+
+	// Assert
+	if d.Provides["Foo::Bar"] != "1.5" {
+		t.Errorf("Provides[Foo::Bar] = %q, want 1.5", d.Provides["Foo::Bar"])
+	}
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	// Arrange: Moo requires Role::Tiny
+	env := newTestEnv(t)
+	env.addIndexed("Moo", "2.0", "H/HA/HAARG/Moo-2.0.tar.gz",
+		metaJSON("Moo", "Moo", "2.0", map[string]string{"Role::Tiny": "1.0", "strict": "0"}))
+	env.addIndexed("Role::Tiny", "2.1", "H/HA/HAARG/Role-Tiny-2.1.tar.gz",
+		metaJSON("Role-Tiny", "Role::Tiny", "2.1", nil))
+	res := env.resolver()
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Moo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	names := make(map[string]bool)
+	for _, d := range dists {
+		names[d.Name] = true
+	}
+	if !names["Moo-2.0"] || !names["Role-Tiny-2.1"] {
+		t.Errorf("resolved dists = %v, want Moo-2.0 and Role-Tiny-2.1", names)
+	}
+}
+
+func TestResolver_Resolve_IncludeCoreModules(t *testing.T) {
+	tests := []struct {
+		name        string
+		includeCore bool
+		wantScalar  bool
+	}{
+		{name: "core skipped", includeCore: false, wantScalar: false},
+		{name: "core included", includeCore: true, wantScalar: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: Foo requires perl and the dual-life Scalar::Util
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", map[string]string{"perl": "5.008", "Scalar::Util": "1.50"}))
+			env.addIndexed("Scalar::Util", "1.63", "P/PE/PEVANS/Scalar-List-Utils-1.63.tar.gz",
+				metaJSON("Scalar-List-Utils", "Scalar::Util", "1.63", nil))
+			res := env.resolver()
+			res.SetIncludeCoreModules(tt.includeCore)
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			gotScalar := false
+			for _, d := range dists {
+				if d.Name == "Scalar-List-Utils-1.63" {
+					gotScalar = true
+				}
+			}
+			if gotScalar != tt.wantScalar {
+				t.Errorf("Scalar-List-Utils resolved = %v, want %v", gotScalar, tt.wantScalar)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_SkipNamespaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		wantDists  []string
+	}{
+		{name: "nothing skipped", namespaces: nil, wantDists: []string{"Acme-Foo-1.0", "Bar-1.0", "Foo-1.0"}},
+		{name: "Acme skipped", namespaces: []string{"Acme::"}, wantDists: []string{"Foo-1.0"}},
+		{name: "without trailing colons", namespaces: []string{"Acme"}, wantDists: []string{"Foo-1.0"}},
+		{name: "prefix of another namespace", namespaces: []string{"Acm::"}, wantDists: []string{"Acme-Foo-1.0", "Bar-1.0", "Foo-1.0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: Foo requires Acme::Foo, which requires Bar
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", map[string]string{"Acme::Foo": "0"}))
+			env.addIndexed("Acme::Foo", "1.0", "A/AU/AUTHOR/Acme-Foo-1.0.tar.gz",
+				metaJSON("Acme-Foo", "Acme::Foo", "1.0", map[string]string{"Bar": "0"}))
+			env.addIndexed("Bar", "1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+				metaJSON("Bar", "Bar", "1.0", nil))
+			res := env.resolver()
+			res.SetSkipNamespaces(tt.namespaces)
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{
+				{Module: "Foo", Version: "0"},
+				{Module: "Acme::Foo", Version: "0"},
+			})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			var got []string
+			for _, d := range dists {
+				got = append(got, d.Name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(tt.wantDists, " ") {
+				t.Errorf("resolved %v, want %v", got, tt.wantDists)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_Constraints(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints map[string]string
+		wantDists   []string
+	}{
+		{name: "no constraints", constraints: nil, wantDists: []string{"Bar-2.0", "Foo-1.0"}},
+		{name: "transitive dep narrowed", constraints: map[string]string{"Bar": "< 2"}, wantDists: []string{"Bar-1.5", "Foo-1.0"}},
+		{name: "unrelated module", constraints: map[string]string{"Baz": "< 2"}, wantDists: []string{"Bar-2.0", "Foo-1.0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: Foo requires Bar >= 1.0, the index has Bar 2.0 and
+			// BackPAN has Bar 1.5
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", map[string]string{"Bar": ">= 1.0"}))
+			env.addIndexed("Bar", "2.0", "A/AU/AUTHOR/Bar-2.0.tar.gz",
+				metaJSON("Bar", "Bar", "2.0", nil))
+			env.addBackPAN("Bar", ">= 1.0, < 2", "A/AU/AUTHOR/Bar-1.5.tar.gz",
+				metaJSON("Bar", "Bar", "1.5", nil))
+			res := env.resolver()
+			res.SetConstraints(tt.constraints)
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			var got []string
+			for _, d := range dists {
+				got = append(got, d.Name)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantDists, " ") {
+				t.Errorf("resolved %v, want %v", got, tt.wantDists)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_ProvidingDist(t *testing.T) {
+	tests := []struct {
+		name     string
+		provides string // module the release's META provides
+		version  string
+		wantErr  bool
+	}{
+		{name: "provided", provides: "Foo::Util", version: "0"},
+		{name: "version too low", provides: "Foo::Util", version: "2.0", wantErr: true},
+		{name: "not in provides", provides: "Foo", version: "0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: Foo::Util is in neither the index nor download_url,
+			// but MetaCPAN's module endpoint places it in Foo-1.0
+			env := newTestEnv(t)
+			env.addIndexed("Bar", "1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+				metaJSON("Bar", "Bar", "1.0", nil))
+			env.modules["Foo::Util"] = `{"author":"AUTHOR","release":"Foo-1.0"}`
+			env.releases["AUTHOR/Foo-1.0"] = `{"name":"Foo-1.0","distribution":"Foo","version":"1.0",` +
+				`"download_url":"http://mirror.invalid/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz"}`
+			writeTarball(t, filepath.Join(env.backpanDir, "Foo-1.0.tar.gz"), "Foo-1.0",
+				metaJSON("Foo", tt.provides, "1.0", map[string]string{"Bar": "0"}))
+			res := env.resolver()
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo::Util", Version: tt.version}})
+
+			// Assert
+			if tt.wantErr {
+				var resErr *Error
+				if !errors.As(err, &resErr) || resErr.Kind != KindUnresolved || resErr.Module != "Foo::Util" {
+					t.Fatalf("Resolve() error = %v, want unresolved Foo::Util", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			var got []string
+			for _, d := range dists {
+				got = append(got, d.Name+" "+d.Pathname)
+			}
+			want := "Bar-1.0 A/AU/AUTHOR/Bar-1.0.tar.gz,Foo-1.0 A/AU/AUTHOR/Foo-1.0.tar.gz"
+			if strings.Join(got, ",") != want {
+				t.Errorf("resolved %v, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_LocalTarball(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		version string
+		wantErr bool
+	}{
+		{name: "provided", file: "A/AU/AUTHOR/Foo-Internal-1.0.tar.gz", version: "1.0"},
+		{name: "version too low", file: "A/AU/AUTHOR/Foo-Internal-1.0.tar.gz", version: "2.0", wantErr: true},
+		{name: "no author pathname", file: "Foo-Internal-1.0.tar.gz", version: "1.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: Foo::Internal is unknown to the index and MetaCPAN,
+			// but a curated tarball in the backpan directory provides it
+			env := newTestEnv(t)
+			env.addIndexed("Bar", "1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+				metaJSON("Bar", "Bar", "1.0", nil))
+			writeTarball(t, filepath.Join(env.backpanDir, filepath.FromSlash(tt.file)), "Foo-Internal-1.0",
+				metaJSON("Foo-Internal", "Foo::Internal", "1.0", map[string]string{"Bar": "0"}))
+			res := env.resolver()
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo::Internal", Version: tt.version}})
+
+			// Assert
+			if tt.wantErr {
+				var resErr *Error
+				if !errors.As(err, &resErr) || resErr.Kind != KindUnresolved || resErr.Module != "Foo::Internal" {
+					t.Fatalf("Resolve() error = %v, want unresolved Foo::Internal", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			var got []string
+			for _, d := range dists {
+				got = append(got, d.Name+" "+d.Pathname)
+			}
+			want := "Bar-1.0 A/AU/AUTHOR/Bar-1.0.tar.gz,Foo-Internal-1.0 A/AU/AUTHOR/Foo-Internal-1.0.tar.gz"
+			if strings.Join(got, ",") != want {
+				t.Errorf("resolved %v, want %s", got, want)
+			}
+			if reason := dists[1].Reason; !strings.Contains(reason, "from a local tarball in "+env.backpanDir) {
+				t.Errorf("Reason = %q, want it to name the backpan directory", reason)
+			}
+		})
+	}
+}
+
+func TestResolver_SetVersionPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  VersionPolicy
+		version string
+		want    string
+	}{
+		{name: "latest", policy: VersionLatest, version: ">= 1.2", want: "Foo-2.0 A/AU/AUTHOR/Foo-2.0.tar.gz"},
+		{name: "minimum", policy: VersionMinimum, version: ">= 1.2", want: "Foo-1.5 A/AU/AUTHOR/Foo-1.5.tar.gz"},
+		{name: "minimum of any version", policy: VersionMinimum, version: "0", want: "Foo-1.0 O/OL/OLDAUTHOR/Foo-1.0.tar.gz"},
+		{name: "minimum within range", policy: VersionMinimum, version: ">= 1.0, != 1.0", want: "Foo-1.5 A/AU/AUTHOR/Foo-1.5.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: the index lists Foo 2.0, MetaCPAN knows 1.0, 1.5 and 2.0
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "2.0", "A/AU/AUTHOR/Foo-2.0.tar.gz", metaJSON("Foo", "Foo", "2.0", nil))
+			env.modules["Foo"] = `{"author":"AUTHOR","release":"Foo-2.0","distribution":"Foo"}`
+			env.releases["versions/Foo"] = `{"releases":[` +
+				`{"version":"2.0","download_url":"http://mirror.invalid/authors/id/A/AU/AUTHOR/Foo-2.0.tar.gz","status":"latest"},` +
+				`{"version":"1.5","download_url":"http://mirror.invalid/authors/id/A/AU/AUTHOR/Foo-1.5.tar.gz","status":"cpan"},` +
+				`{"version":"1.0","download_url":"http://backpan.invalid/authors/id/O/OL/OLDAUTHOR/Foo-1.0.tar.gz","status":"backpan"}]}`
+			writeTarball(t, filepath.Join(env.backpanDir, "Foo-1.5.tar.gz"), "Foo-1.5", metaJSON("Foo", "Foo", "1.5", nil))
+			writeTarball(t, filepath.Join(env.backpanDir, "Foo-1.0.tar.gz"), "Foo-1.0", metaJSON("Foo", "Foo", "1.0", nil))
+			res := env.resolver()
+			res.SetVersionPolicy(tt.policy)
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: tt.version}})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if len(dists) != 1 || dists[0].Name+" "+dists[0].Pathname != tt.want {
+				t.Errorf("resolved %+v, want %s", dists, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_FuzzyCase(t *testing.T) {
+	// Arrange: the requirement spells JSON::PP with the wrong case
+	env := newTestEnv(t)
+	env.addIndexed("JSON::PP", "4.16", "I/IS/ISHIGAKI/JSON-PP-4.16.tar.gz",
+		metaJSON("JSON-PP", "JSON::PP", "4.16", nil))
+	res := env.resolver()
+	var logs bytes.Buffer
+	res.log = logger.New(&logs, logger.LevelWarn)
+	res.cpanIndex.SetLogger(res.log)
+	res.cpanIndex.SetFuzzyCase(true)
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "JSON::pp", Version: "4.0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(dists) != 1 || dists[0].Name != "JSON-PP-4.16" {
+		t.Errorf("dists = %v, want JSON-PP-4.16", dists)
+	}
+	if want := "JSON::pp is not in the index; using JSON::PP"; !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %q, want warning containing %q", logs.String(), want)
+	}
+}
+
+func TestResolver_SetObserver(t *testing.T) {
+	// Arrange: Moo requires Role::Tiny, which requires the core module strict
+	env := newTestEnv(t)
+	env.addIndexed("Moo", "2.0", "H/HA/HAARG/Moo-2.0.tar.gz",
+		metaJSON("Moo", "Moo", "2.0", map[string]string{"Role::Tiny": "1.0"}))
+	env.addIndexed("Role::Tiny", "2.1", "H/HA/HAARG/Role-Tiny-2.1.tar.gz",
+		metaJSON("Role-Tiny", "Role::Tiny", "2.1", map[string]string{"strict": "0"}))
+	res := env.resolver()
+	var events []string
+	res.SetObserver(func(e Event) {
+		events = append(events, fmt.Sprintf("%s %s %s%s", e.Kind, e.Module, e.Source, e.Reason))
+	})
+
+	// Act
+	_, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Moo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	want := []string{
+		"started Moo ",
+		"found Moo cpan",
+		"downloaded Moo cpan",
+		"extracted Moo cpan",
+		"resolved Moo cpan",
+		"started Role::Tiny ",
+		"found Role::Tiny cpan",
+		"downloaded Role::Tiny cpan",
+		"extracted Role::Tiny cpan",
+		"resolved Role::Tiny cpan",
+		"skipped strict core",
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events =\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestResolver_Resolve_PinnedDists(t *testing.T) {
+	// Arrange: the index has Foo 1.0; a patched Foo-1.23 tarball is pinned
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		metaJSON("Foo", "Foo", "1.0", nil))
+	env.addIndexed("Bar", "1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+		metaJSON("Bar", "Bar", "1.0", map[string]string{"Foo::Util": "0"}))
+	writeTarball(t, filepath.Join(env.cacheDir, "M/ME/ME/Foo-1.23.tar.gz"), "Foo-1.23", `{"name":"Foo","version":"1.23",
+		"provides":{"Foo":{"file":"lib/Foo.pm","version":"1.23"},"Foo::Util":{"file":"lib/Foo/Util.pm","version":"1.23"}}}`)
+	res := env.resolver()
+	res.SetPinnedDists([]string{"M/ME/ME/Foo-1.23.tar.gz"})
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Bar", Version: "0"}, {Module: "Foo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	pathnames := make(map[string]bool)
+	for _, d := range dists {
+		pathnames[d.Pathname] = true
+	}
+	if !pathnames["M/ME/ME/Foo-1.23.tar.gz"] || pathnames["A/AU/AUTHOR/Foo-1.0.tar.gz"] {
+		t.Errorf("resolved pathnames = %v, want the pinned Foo-1.23 and not Foo-1.0", pathnames)
+	}
+}
+
+func TestResolver_TopLevel(t *testing.T) {
+	// Arrange: Moo requires Role::Tiny, only Moo and JSON are requested
+	env := newTestEnv(t)
+	env.addIndexed("Moo", "2.0", "H/HA/HAARG/Moo-2.0.tar.gz",
+		metaJSON("Moo", "Moo", "2.0", map[string]string{"Role::Tiny": "1.0"}))
+	env.addIndexed("Role::Tiny", "2.1", "H/HA/HAARG/Role-Tiny-2.1.tar.gz",
+		metaJSON("Role-Tiny", "Role::Tiny", "2.1", nil))
+	env.addIndexed("JSON", "4.0", "I/IS/ISHIGAKI/JSON-4.0.tar.gz",
+		metaJSON("JSON", "JSON", "4.0", nil))
+	res := env.resolver()
+
+	// Act
+	_, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Moo", Version: "0"}, {Module: "JSON", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := strings.Join(res.TopLevel(), ","); got != "JSON,Moo" {
+		t.Errorf("TopLevel() = %s, want JSON,Moo (not Role::Tiny)", got)
+	}
+}
+
+func TestResolver_Resolve_MetaVersionOverridesIndex(t *testing.T) {
+	// Arrange: the index lists JSON at 2.0 but the tarball's META says 2.1
+	env := newTestEnv(t)
+	env.addIndexed("JSON", "2.0", "I/IS/ISHIGAKI/JSON-2.0.tar.gz",
+		metaJSON("JSON", "JSON", "2.1", nil))
+	res := env.resolver()
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "JSON", Version: "2.0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := snapshot.NewEmitter(&buf).Emit(dists); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "      JSON 2.1\n") {
+		t.Errorf("snapshot =\n%s\nwant provides JSON 2.1 from META", buf.String())
+	}
+}
+
+func TestResolver_Resolve_ValidatesPins(t *testing.T) {
+	// Arrange: MetaCPAN answers the == 2.0 pin with a 1.0 release
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		metaJSON("Foo", "Foo", "1.0", nil))
+	env.addBackPAN("Foo", "== 2.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		metaJSON("Foo", "Foo", "1.0", nil))
+	res := env.resolver()
+
+	// Act
+	_, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "== 2.0"}})
+
+	// Assert
+	if err == nil {
+		t.Fatal("Resolve() should report the unsatisfied pin")
+	}
+	if !strings.Contains(err.Error(), "Foo == 2.0 (resolved 1.0 from Foo-1.0)") {
+		t.Errorf("error = %q, want it to name the unsatisfied pin", err)
+	}
+	var resErr *Error
+	if !errors.As(err, &resErr) || resErr.Kind != KindConflict || resErr.Module != "Foo" {
+		t.Errorf("error = %#v, want conflict Error for Foo", err)
+	}
+}
+
+func TestResolver_Resolve_MaxBackPANAge(t *testing.T) {
+	tests := []struct {
+		name    string
+		date    string
+		wantErr bool
+	}{
+		{name: "ancient release rejected", date: "2005-03-01T12:00:00", wantErr: true},
+		{name: "recent release accepted", date: time.Now().AddDate(-1, 0, 0).UTC().Format("2006-01-02T15:04:05")},
+		{name: "missing date accepted", date: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: the pinned Foo 1.0 is only on BackPAN
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "2.0", "A/AU/AUTHOR/Foo-2.0.tar.gz",
+				metaJSON("Foo", "Foo", "2.0", nil))
+			env.addBackPAN("Foo", "== 1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", nil))
+			result := env.backpan["Foo == 1.0"]
+			result.Date = tt.date
+			env.backpan["Foo == 1.0"] = result
+			res := env.resolver()
+			res.SetMaxBackPANAge(10 * 365 * 24 * time.Hour)
+
+			// Act
+			_, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "== 1.0"}})
+
+			// Assert
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Resolve() error = %v", err)
+				}
+				return
+			}
+			var resErr *Error
+			if !errors.As(err, &resErr) || resErr.Module != "Foo" {
+				t.Fatalf("error = %v, want *Error for Foo", err)
+			}
+			if !strings.Contains(err.Error(), "Foo-1.0 is") || !strings.Contains(err.Error(), "released 2005-03-01") {
+				t.Errorf("error = %q, want it to name the release and its age", err)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_Reason(t *testing.T) {
+	// Arrange: Foo requires Baz from CPAN and an older Bar only on BackPAN
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		metaJSON("Foo", "Foo", "1.0", map[string]string{"Bar": "== 1.0", "Baz": "1.5"}))
+	env.addIndexed("Bar", "2.0", "A/AU/AUTHOR/Bar-2.0.tar.gz",
+		metaJSON("Bar", "Bar", "2.0", nil))
+	env.addBackPAN("Bar", "== 1.0", "A/AU/AUTHOR/Bar-1.0.tar.gz",
+		metaJSON("Bar", "Bar", "1.0", nil))
+	env.addIndexed("Baz", "1.6", "A/AU/AUTHOR/Baz-1.6.tar.gz",
+		metaJSON("Baz", "Baz", "1.6", nil))
+	res := env.resolver()
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	want := map[string]string{
+		"Foo-1.0": "Foo (any version) requested directly; from CPAN index",
+		"Bar-1.0": "Bar == 1.0 required by Foo-1.0; from BackPAN",
+		"Baz-1.6": "Baz 1.5 required by Foo-1.0; from CPAN index",
+	}
+	if len(dists) != len(want) {
+		t.Fatalf("resolved %d distributions, want %d", len(dists), len(want))
+	}
+	for _, d := range dists {
+		if d.Reason != want[d.Name] {
+			t.Errorf("%s Reason = %q, want %q", d.Name, d.Reason, want[d.Name])
+		}
+	}
+}
+
+func TestResolver_Resolve_PreferBackPAN(t *testing.T) {
+	tests := []struct {
+		name        string
+		prefer      bool
+		wantFoo     string
+		wantLookups []string
+	}{
+		{name: "index by default", prefer: false, wantFoo: "A/AU/AUTHOR/Foo-1.0.tar.gz", wantLookups: nil},
+		{name: "MetaCPAN for exact pins", prefer: true, wantFoo: "B/BO/BOB/Foo-1.0.tar.gz", wantLookups: []string{"Foo"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: the index and MetaCPAN disagree on the Foo 1.0
+			// tarball; Bar is not pinned exactly
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", nil))
+			env.addBackPAN("Foo", "== 1.0", "B/BO/BOB/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", nil))
+			env.addIndexed("Bar", "2.0", "A/AU/AUTHOR/Bar-2.0.tar.gz",
+				metaJSON("Bar", "Bar", "2.0", nil))
+			var lookups []string
+			env.onLookup = func(module string) { lookups = append(lookups, module) }
+			res := env.resolver()
+			res.SetPreferBackPAN(tt.prefer)
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{
+				{Module: "Foo", Version: "== 1.0"},
+				{Module: "Bar", Version: "1.0"},
+			})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			got := make(map[string]string)
+			for _, d := range dists {
+				got[d.Name] = d.Pathname
+			}
+			if got["Foo-1.0"] != tt.wantFoo {
+				t.Errorf("Foo pathname = %q, want %q", got["Foo-1.0"], tt.wantFoo)
+			}
+			if got["Bar-2.0"] != "A/AU/AUTHOR/Bar-2.0.tar.gz" {
+				t.Errorf("Bar pathname = %q, want it from the index", got["Bar-2.0"])
+			}
+			if strings.Join(lookups, ",") != strings.Join(tt.wantLookups, ",") {
+				t.Errorf("MetaCPAN lookups = %v, want %v", lookups, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_StableOrder(t *testing.T) {
+	// Arrange: App requires several dists, one of which provides two modules
+	env := newTestEnv(t)
+	env.addIndexed("App", "1.0", "A/AU/AUTHOR/App-1.0.tar.gz",
+		metaJSON("App", "App", "1.0", map[string]string{"Zed": "0", "Mid": "0", "Alpha": "0", "Alpha::Util": "0"}))
+	for _, mod := range []string{"Zed", "Mid", "Alpha"} {
+		env.addIndexed(mod, "1.0", "A/AU/AUTHOR/"+mod+"-1.0.tar.gz", metaJSON(mod, mod, "1.0", nil))
+	}
+	env.packages = append(env.packages, "Alpha::Util\t1.0\tA/AU/AUTHOR/Alpha-1.0.tar.gz")
+
+	var first []string
+	for run := 0; run < 10; run++ {
+		res := env.resolver()
+
+		// Act
+		dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "App", Version: "0"}})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		var names []string
+		for _, d := range dists {
+			names = append(names, d.Name)
+		}
+		if !sort.StringsAreSorted(names) {
+			t.Fatalf("Resolve() order = %v, want sorted by name", names)
+		}
+		if run == 0 {
+			first = names
+		} else if strings.Join(names, ",") != strings.Join(first, ",") {
+			t.Fatalf("run %d order = %v, want %v", run, names, first)
+		}
+	}
+}
+
+func TestResolver_Resolve_ShallowModules(t *testing.T) {
+	// Arrange: App requires Framework, which requires Plugin
+	env := newTestEnv(t)
+	env.addIndexed("App", "1.0", "A/AU/AUTHOR/App-1.0.tar.gz",
+		metaJSON("App", "App", "1.0", map[string]string{"Framework": "0"}))
+	env.addIndexed("Framework", "3.0", "A/AU/AUTHOR/Framework-3.0.tar.gz",
+		metaJSON("Framework", "Framework", "3.0", map[string]string{"Plugin": "0"}))
+	env.addIndexed("Plugin", "1.0", "A/AU/AUTHOR/Plugin-1.0.tar.gz",
+		metaJSON("Plugin", "Plugin", "1.0", nil))
+	res := env.resolver()
+	res.SetShallowModules([]string{"Framework"})
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "App", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	names := make(map[string]bool)
+	for _, d := range dists {
+		names[d.Name] = true
+	}
+	if !names["App-1.0"] || !names["Framework-3.0"] {
+		t.Errorf("resolved dists = %v, want App-1.0 and Framework-3.0", names)
+	}
+	if names["Plugin-1.0"] {
+		t.Errorf("resolved dists = %v, want Plugin-1.0 not followed", names)
+	}
+}
+
+func TestResolver_SetNoTransitive(t *testing.T) {
+	// Arrange: App and Tool are requested; App requires Framework, which
+	// requires Plugin
+	env := newTestEnv(t)
+	env.addIndexed("App", "1.0", "A/AU/AUTHOR/App-1.0.tar.gz",
+		metaJSON("App", "App", "1.0", map[string]string{"Framework": "2.0"}))
+	env.addIndexed("Tool", "0.5", "A/AU/AUTHOR/Tool-0.5.tar.gz",
+		metaJSON("Tool", "Tool", "0.5", nil))
+	env.addIndexed("Framework", "3.0", "A/AU/AUTHOR/Framework-3.0.tar.gz",
+		metaJSON("Framework", "Framework", "3.0", map[string]string{"Plugin": "0"}))
+	env.addIndexed("Plugin", "1.0", "A/AU/AUTHOR/Plugin-1.0.tar.gz",
+		metaJSON("Plugin", "Plugin", "1.0", nil))
+	res := env.resolver()
+	res.SetNoTransitive(true)
+
+	// Act
+	dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "App", Version: "0"}, {Module: "Tool", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	var names []string
+	for _, d := range dists {
+		names = append(names, d.Name)
+		if d.Name == "App-1.0" && d.Requirements["Framework"] != "2.0" {
+			t.Errorf("App requirements = %v, want Framework 2.0 kept", d.Requirements)
+		}
+	}
+	if got := strings.Join(names, ","); got != "App-1.0,Tool-0.5" {
+		t.Errorf("resolved dists = %s, want App-1.0,Tool-0.5", got)
+	}
+}
+
+func TestResolver_Resolve_CollectErrors(t *testing.T) {
+	// Arrange: two unknown modules around a resolvable one
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		metaJSON("Foo", "Foo", "1.0", nil))
+	res := env.resolver()
+	var logs bytes.Buffer
+	res.log = logger.New(&logs, logger.LevelError)
+	res.SetCollectErrors(true)
+	reqs := []dist.VersionReq{
+		{Module: "No::Such::Module", Version: "0"},
+		{Module: "Foo", Version: "0"},
+		{Module: "Also::Missing", Version: "0"},
+	}
+
+	// Act
+	dists, err := res.Resolve(context.Background(), reqs)
+
+	// Assert
+	if err == nil {
+		t.Fatal("Resolve() should report the failed requirements")
+	}
+	for _, module := range []string{"No::Such::Module", "Also::Missing"} {
+		if !strings.Contains(err.Error(), module) {
+			t.Errorf("error = %q, want it to name %s", err, module)
+		}
+	}
+	if len(dists) != 1 || dists[0].Name != "Foo-1.0" {
+		t.Errorf("resolved %d dists, want Foo-1.0 only", len(dists))
+	}
+	if logs.Len() > 0 {
+		t.Errorf("failures logged besides the returned error:\n%s", logs.String())
+	}
+}
+
+func TestResolver_Resolve_DuplicateProvides(t *testing.T) {
+	// Arrange: Foo and its dependency Bar both ship Shared, at different versions
+	env := newTestEnv(t)
+	env.addIndexed("Foo", "1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz", `{"name":"Foo","version":"1.0",
+		"provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"},"Shared":{"file":"lib/Shared.pm","version":"1.0"}},
+		"prereqs":{"runtime":{"requires":{"Bar":"0"}}}}`)
+	env.addIndexed("Bar", "1.0", "B/BA/BARAUTHOR/Bar-1.0.tar.gz", `{"name":"Bar","version":"1.0",
+		"provides":{"Bar":{"file":"lib/Bar.pm","version":"1.0"},"Shared":{"file":"lib/Shared.pm","version":"2.0"}}}`)
+	res := env.resolver()
+	var logs bytes.Buffer
+	res.log = logger.New(&logs, logger.LevelWarn)
+
+	// Act
+	_, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "0"}})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	want := "Shared is provided by both Foo-1.0 (1.0) and Bar-1.0 (2.0)"
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %q, want warning containing %q", logs.String(), want)
+	}
+}
+
+func TestResolver_Resolve_Upgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		upgrade bool
+		want    string
+	}{
+		{name: "exact pin honored", upgrade: false, want: "Foo-1.0"},
+		{name: "upgrade to CPAN", upgrade: true, want: "Foo-2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: CPAN has Foo 2.0, BackPAN has the pinned 1.0
+			env := newTestEnv(t)
+			env.addIndexed("Foo", "2.0", "A/AU/AUTHOR/Foo-2.0.tar.gz",
+				metaJSON("Foo", "Foo", "2.0", nil))
+			env.addBackPAN("Foo", "== 1.0", "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				metaJSON("Foo", "Foo", "1.0", nil))
+			res := env.resolver()
+			res.SetUpgrade(tt.upgrade)
+
+			// Act
+			dists, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "Foo", Version: "== 1.0"}})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if len(dists) != 1 || dists[0].Name != tt.want {
+				t.Errorf("resolved %v, want %s", dists, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinimumOf(t *testing.T) {
+	tests := []struct {
+		want string
+		min  string
+	}{
+		{"", "0"},
+		{"1.0", "1.0"},
+		{"== 1.0", ">= 1.0"},
+		{">= 1.0, < 2.0", ">= 1.0"},
+		{"> 1.0, != 1.5", "> 1.0"},
+		{"< 2.0", "0"},
+		{"~1.2", ">= 1.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := minimumOf(tt.want); got != tt.min {
+				t.Errorf("minimumOf(%q) = %q, want %q", tt.want, got, tt.min)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_Unresolved(t *testing.T) {
+	// Arrange: Module neither in the index nor on MetaCPAN
+	env := newTestEnv(t)
+	res := env.resolver()
+
+	// Act
+	_, err := res.Resolve(context.Background(), []dist.VersionReq{{Module: "No::Such::Module", Version: "0"}})
+
+	// Assert
+	var resErr *Error
+	if !errors.As(err, &resErr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	if resErr.Kind != KindUnresolved || resErr.Module != "No::Such::Module" {
+		t.Errorf("error = %+v, want unresolved No::Such::Module", resErr)
+	}
+}
+
+// testEnv is a resolver test fixture backed by a pre-populated CPAN index
+// cache, pre-downloaded tarballs and a mock MetaCPAN API.
+type testEnv struct {
+	t          *testing.T
+	cacheDir   string
+	backpanDir string
+	mirror     string
+	packages   []string
+	backpan    map[string]index.BackPANResult // "Module version" -> result
+	onLookup   func(module string)            // called on every MetaCPAN request
+	releases   map[string]string              // "AUTHOR/Name-1.0" -> release JSON
+	modules    map[string]string              // module -> MetaCPAN module JSON
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return &testEnv{
+		t:          t,
+		cacheDir:   t.TempDir(),
+		backpanDir: t.TempDir(),
+		mirror:     "http://mirror.invalid",
+		backpan:    make(map[string]index.BackPANResult),
+		releases:   make(map[string]string),
+		modules:    make(map[string]string),
+	}
+}
+
+// addIndexed adds a CPAN index entry and a cached tarball with the given META.json.
+func (e *testEnv) addIndexed(module, version, pathname, metaJSON string) {
+	e.t.Helper()
+	e.packages = append(e.packages, fmt.Sprintf("%s\t%s\t%s", module, version, pathname))
+	writeTarball(e.t, filepath.Join(e.cacheDir, pathname), distNameFromPath(pathname), metaJSON)
+}
+
+// addBackPAN registers a MetaCPAN download_url answer for module at the given
+// version constraint and stores the tarball in the backpan directory.
+func (e *testEnv) addBackPAN(module, version, pathname, metaJSON string) {
+	e.t.Helper()
+	url := e.mirror + "/authors/id/" + pathname
+	e.backpan[module+" "+version] = index.BackPANResult{DownloadURL: url, Version: version}
+	writeTarball(e.t, filepath.Join(e.backpanDir, filepath.Base(pathname)), distNameFromPath(pathname), metaJSON)
+}
+
+func (e *testEnv) metacpanHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if release, ok := strings.CutPrefix(r.URL.Path, "/v1/release/"); ok {
+			body, found := e.releases[release]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+			return
+		}
+
+		if module, ok := strings.CutPrefix(r.URL.Path, "/v1/module/"); ok {
+			body, found := e.modules[module]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+			return
+		}
+
+		module := strings.TrimPrefix(r.URL.Path, "/v1/download_url/")
+		if e.onLookup != nil {
+			e.onLookup(module)
+		}
+		result, ok := e.backpan[module+" "+r.URL.Query().Get("version")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// resolver builds a Resolver over the fixture.
+func (e *testEnv) resolver() *Resolver {
+	e.t.Helper()
+
+	content := "File: 02packages.details.txt\n\n" + strings.Join(e.packages, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(e.cacheDir, "02packages.details.txt"), []byte(content), 0644); err != nil {
+		e.t.Fatal(err)
+	}
+	cpan := index.NewCPANIndex(e.mirror, e.cacheDir)
+	if err := cpan.Load(context.Background()); err != nil {
+		e.t.Fatal(err)
+	}
+
+	server := httptest.NewServer(e.metacpanHandler())
+	e.t.Cleanup(server.Close)
+	backpan := index.NewBackPANIndex(e.backpanDir)
+	backpan.SetAPIURL(server.URL)
+
+	dl := downloader.NewDownloader(1, e.cacheDir)
+	return NewResolver(cpan, backpan, dl, extractor.NewExtractor(""), nil)
+}
+
+func writeTarball(t *testing.T, path, distName, metaJSON string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	hdr := &tar.Header{Name: distName + "/META.json", Mode: 0644, Size: int64(len(metaJSON))}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(metaJSON)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// metaJSON renders a minimal META.json providing module at version with
+// the given runtime requirements.
+func metaJSON(name, module, version string, requires map[string]string) string {
+	meta := map[string]interface{}{
+		"name":    name,
+		"version": version,
+		"provides": map[string]interface{}{
+			module: map[string]string{"file": "lib/" + strings.ReplaceAll(module, "::", "/") + ".pm", "version": version},
+		},
+		"prereqs": map[string]interface{}{
+			"runtime": map[string]interface{}{"requires": requires},
+		},
+	}
+	data, _ := json.Marshal(meta)
+	return string(data)
+}
@@ -0,0 +1,36 @@
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// Dedup returns dists with every distribution listed once, keeping the
+// first of each pathname and of each name. Repeats of the same
+// distribution, as returned for one providing several modules, are dropped
+// silently. A different distribution colliding on pathname or on name is
+// dropped too and described in the returned list, as it points to a
+// resolution bug or two releases of the same name.
+func Dedup(dists []*dist.Dist) ([]*dist.Dist, []string) {
+	byPathname := make(map[string]*dist.Dist)
+	byName := make(map[string]*dist.Dist)
+	var unique []*dist.Dist
+	var dropped []string
+	for _, d := range dists {
+		if kept, ok := byPathname[d.Pathname]; ok {
+			if kept.Name != d.Name {
+				dropped = append(dropped, fmt.Sprintf("%s has the same pathname %s as %s; dropped", d.Name, d.Pathname, kept.Name))
+			}
+			continue
+		}
+		if kept, ok := byName[d.Name]; ok {
+			dropped = append(dropped, fmt.Sprintf("%s from %s has the same name as the one from %s; dropped", d.Name, d.Pathname, kept.Pathname))
+			continue
+		}
+		byPathname[d.Pathname] = d
+		byName[d.Name] = d
+		unique = append(unique, d)
+	}
+	return unique, dropped
+}
@@ -0,0 +1,57 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestDedup(t *testing.T) {
+	foo := &dist.Dist{Name: "Foo-1.0", Pathname: "A/AU/AUTHOR/Foo-1.0.tar.gz"}
+	bar := &dist.Dist{Name: "Bar-1.0", Pathname: "A/AU/AUTHOR/Bar-1.0.tar.gz"}
+
+	tests := []struct {
+		name        string
+		dists       []*dist.Dist
+		wantNames   []string
+		wantDropped []string
+	}{
+		{
+			name:      "identical pathname",
+			dists:     []*dist.Dist{foo, foo, bar, {Name: "Foo-1.0", Pathname: "A/AU/AUTHOR/Foo-1.0.tar.gz"}},
+			wantNames: []string{"Foo-1.0", "Bar-1.0"},
+		},
+		{
+			name:        "pathname collision",
+			dists:       []*dist.Dist{foo, {Name: "Foo-Fork-1.0", Pathname: "A/AU/AUTHOR/Foo-1.0.tar.gz"}},
+			wantNames:   []string{"Foo-1.0"},
+			wantDropped: []string{"Foo-Fork-1.0 has the same pathname A/AU/AUTHOR/Foo-1.0.tar.gz as Foo-1.0; dropped"},
+		},
+		{
+			name:        "name collision",
+			dists:       []*dist.Dist{foo, bar, {Name: "Foo-1.0", Pathname: "B/BO/BOB/Foo-1.0.tar.gz"}},
+			wantNames:   []string{"Foo-1.0", "Bar-1.0"},
+			wantDropped: []string{"Foo-1.0 from B/BO/BOB/Foo-1.0.tar.gz has the same name as the one from A/AU/AUTHOR/Foo-1.0.tar.gz; dropped"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			unique, dropped := Dedup(tt.dists)
+
+			// Assert
+			var names []string
+			for _, d := range unique {
+				names = append(names, d.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("Dedup() kept %v, want %v", names, tt.wantNames)
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("Dedup() dropped %q, want %q", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package snapshot
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// ReverseDeps maps every required module to the names of the distributions
+// requiring it. A distribution requiring a module it provides itself is ignored.
+func ReverseDeps(dists []*dist.Dist) map[string][]string {
+	rdeps := make(map[string][]string)
+	for _, d := range dists {
+		for mod := range d.Requirements {
+			if _, self := d.Provides[mod]; self {
+				continue
+			}
+			rdeps[mod] = append(rdeps[mod], d.Name)
+		}
+	}
+	for mod := range rdeps {
+		sort.Strings(rdeps[mod])
+	}
+	return rdeps
+}
+
+// TopLevel returns pinned requirements for the distributions that no other
+// distribution depends on, one per distribution, sorted by module name.
+// Each is pinned to the provided version of the distribution's main module.
+// Distributions depending on each other, directly or through others, count
+// as one: when nothing outside them depends on any of them, all are
+// top-level.
+func TopLevel(dists []*dist.Dist) []dist.VersionReq {
+	deps := dependencies(dists)
+	component := components(dists, deps)
+	required := make(map[int]bool)
+	for d, providers := range deps {
+		for _, p := range providers {
+			if component[p] != component[d] {
+				required[component[p]] = true
+			}
+		}
+	}
+
+	var reqs []dist.VersionReq
+	for _, d := range dists {
+		if required[component[d]] || len(d.Provides) == 0 {
+			continue
+		}
+
+		mod := mainModule(d)
+		version := "0"
+		if v := d.Provides[mod]; v != "" && v != "undef" {
+			version = "== " + v
+		}
+		reqs = append(reqs, dist.VersionReq{Module: mod, Version: version})
+	}
+
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].Module < reqs[j].Module
+	})
+	return reqs
+}
+
+// dependencies maps each distribution to the distributions providing the
+// modules it requires. Requirements it provides itself or that no
+// distribution provides are ignored.
+func dependencies(dists []*dist.Dist) map[*dist.Dist][]*dist.Dist {
+	providers := make(map[string][]*dist.Dist)
+	for _, d := range dists {
+		for mod := range d.Provides {
+			providers[mod] = append(providers[mod], d)
+		}
+	}
+
+	deps := make(map[*dist.Dist][]*dist.Dist, len(dists))
+	for _, d := range dists {
+		for mod := range d.Requirements {
+			for _, p := range providers[mod] {
+				if p != d {
+					deps[d] = append(deps[d], p)
+				}
+			}
+		}
+	}
+	return deps
+}
+
+// components numbers the strongly connected components of the dependency
+// graph using Tarjan's algorithm: distributions depending on each other,
+// directly or indirectly, get the same number.
+func components(dists []*dist.Dist, deps map[*dist.Dist][]*dist.Dist) map[*dist.Dist]int {
+	index := make(map[*dist.Dist]int, len(dists))
+	lowlink := make(map[*dist.Dist]int, len(dists))
+	onStack := make(map[*dist.Dist]bool, len(dists))
+	component := make(map[*dist.Dist]int, len(dists))
+	var stack []*dist.Dist
+	next, count := 0, 0
+
+	var visit func(d *dist.Dist)
+	visit = func(d *dist.Dist) {
+		index[d], lowlink[d] = next, next
+		next++
+		stack = append(stack, d)
+		onStack[d] = true
+
+		for _, p := range deps[d] {
+			if _, seen := index[p]; !seen {
+				visit(p)
+				lowlink[d] = min(lowlink[d], lowlink[p])
+			} else if onStack[p] {
+				lowlink[d] = min(lowlink[d], index[p])
+			}
+		}
+
+		if lowlink[d] == index[d] {
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component[top] = count
+				if top == d {
+					break
+				}
+			}
+			count++
+		}
+	}
+
+	for _, d := range dists {
+		if _, seen := index[d]; !seen {
+			visit(d)
+		}
+	}
+	return component
+}
+
+// mainModule picks the module named after the distribution (Foo-Bar-1.0 ->
+// Foo::Bar) if provided, otherwise the alphabetically first provided module.
+func mainModule(d *dist.Dist) string {
+	name := dist.BaseName(d.Name)
+	mod := strings.ReplaceAll(name, "-", "::")
+	if _, ok := d.Provides[mod]; ok {
+		return mod
+	}
+	return sortedKeys(d.Provides)[0]
+}
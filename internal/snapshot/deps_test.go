@@ -0,0 +1,101 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func testDists() []*dist.Dist {
+	return []*dist.Dist{
+		{
+			Name:         "Moo-2.005005",
+			Provides:     map[string]string{"Moo": "2.005005", "Moo::Role": "2.005005"},
+			Requirements: map[string]string{"Role::Tiny": "2.0", "perl": "5.006"},
+		},
+		{
+			Name:         "Role-Tiny-2.002004",
+			Provides:     map[string]string{"Role::Tiny": "2.002004"},
+			Requirements: map[string]string{},
+		},
+		{
+			Name:         "libwww-perl-6.72",
+			Provides:     map[string]string{"LWP": "6.72", "LWP::UserAgent": "6.72"},
+			Requirements: map[string]string{"LWP::UserAgent": "0"},
+		},
+		{
+			Name:         "Undef-Version-1.0",
+			Provides:     map[string]string{"Undef::Version": "undef"},
+			Requirements: map[string]string{},
+		},
+	}
+}
+
+func TestReverseDeps(t *testing.T) {
+	rdeps := ReverseDeps(testDists())
+
+	want := map[string][]string{
+		"Role::Tiny": {"Moo-2.005005"},
+		"perl":       {"Moo-2.005005"},
+	}
+	if !reflect.DeepEqual(rdeps, want) {
+		t.Errorf("ReverseDeps() = %v, want %v", rdeps, want)
+	}
+}
+
+func TestTopLevel(t *testing.T) {
+	reqs := TopLevel(testDists())
+
+	want := []dist.VersionReq{
+		{Module: "LWP", Version: "== 6.72"},
+		{Module: "Moo", Version: "== 2.005005"},
+		{Module: "Undef::Version", Version: "0"},
+	}
+	if !reflect.DeepEqual(reqs, want) {
+		t.Errorf("TopLevel() = %+v, want %+v", reqs, want)
+	}
+}
+
+func TestTopLevel_Cycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		dists []*dist.Dist
+		want  []dist.VersionReq
+	}{
+		{
+			name: "two top-level dists requiring each other",
+			dists: []*dist.Dist{
+				{Name: "Foo-1.0", Provides: map[string]string{"Foo": "1.0"}, Requirements: map[string]string{"Bar": "0"}},
+				{Name: "Bar-2.0", Provides: map[string]string{"Bar": "2.0"}, Requirements: map[string]string{"Foo": "0"}},
+			},
+			want: []dist.VersionReq{
+				{Module: "Bar", Version: "== 2.0"},
+				{Module: "Foo", Version: "== 1.0"},
+			},
+		},
+		{
+			name: "cycle required from outside",
+			dists: []*dist.Dist{
+				{Name: "App-1.0", Provides: map[string]string{"App": "1.0"}, Requirements: map[string]string{"Foo": "0"}},
+				{Name: "Foo-1.0", Provides: map[string]string{"Foo": "1.0"}, Requirements: map[string]string{"Bar": "0"}},
+				{Name: "Bar-2.0", Provides: map[string]string{"Bar": "2.0"}, Requirements: map[string]string{"Foo": "0"}},
+			},
+			want: []dist.VersionReq{
+				{Module: "App", Version: "== 1.0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			reqs := TopLevel(tt.dists)
+
+			// Assert
+			if !reflect.DeepEqual(reqs, tt.want) {
+				t.Errorf("TopLevel() = %+v, want %+v", reqs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package snapshot
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// Diff describes how the distributions of snapshot b differ from those of
+// a, one line per distribution, sorted by name. Distributions are matched
+// by name without version, so an upgrade is one change:
+//
+//   - Foo-1.0 (A/AU/AUTHOR/Foo-1.0.tar.gz)
+//   - Bar-2.0 (A/AU/AUTHOR/Bar-2.0.tar.gz)
+//     ~ Baz-1.0 -> Baz-1.1
+//     ~ Qux-1.0: requirements + Moo 2.0, - Mouse 0
+//
+// An empty result means both list the same distributions with the same
+// provides and requirements.
+func Diff(a, b []*dist.Dist) []string {
+	before, after := byBaseName(a), byBaseName(b)
+	keys := make(map[string]bool, len(before)+len(after))
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []string
+	for _, k := range sorted {
+		old, ok := before[k]
+		d, found := after[k]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+ %s (%s)", d.Name, d.Pathname))
+		case !found:
+			changes = append(changes, fmt.Sprintf("- %s (%s)", old.Name, old.Pathname))
+		case old.Name != d.Name:
+			changes = append(changes, fmt.Sprintf("~ %s -> %s", old.Name, d.Name))
+		default:
+			var what []string
+			if old.Pathname != d.Pathname {
+				what = append(what, fmt.Sprintf("pathname %s -> %s", old.Pathname, d.Pathname))
+			}
+			if diff := diffVersions(old.Provides, d.Provides); diff != "" {
+				what = append(what, "provides "+diff)
+			}
+			if diff := diffVersions(old.Requirements, d.Requirements); diff != "" {
+				what = append(what, "requirements "+diff)
+			}
+			if len(what) > 0 {
+				changes = append(changes, fmt.Sprintf("~ %s: %s", d.Name, strings.Join(what, "; ")))
+			}
+		}
+	}
+	return changes
+}
+
+// byBaseName maps distributions by name without version. A second
+// distribution with the same base name is keyed by its full name.
+func byBaseName(dists []*dist.Dist) map[string]*dist.Dist {
+	m := make(map[string]*dist.Dist, len(dists))
+	for _, d := range dists {
+		key := dist.BaseName(d.Name)
+		if _, taken := m[key]; taken {
+			key = d.Name
+		}
+		m[key] = d
+	}
+	return m
+}
+
+// diffVersions lists the modules added to, removed from or changed between
+// two module -> version maps, e.g. "+ Moo 2.0, - Mouse 0, Foo 1.0 -> 1.1".
+func diffVersions(a, b map[string]string) string {
+	if maps.Equal(a, b) {
+		return ""
+	}
+	merged := make(map[string]string, len(a)+len(b))
+	maps.Copy(merged, a)
+	maps.Copy(merged, b)
+
+	var parts []string
+	for _, mod := range sortedKeys(merged) {
+		old, ok := a[mod]
+		ver, found := b[mod]
+		switch {
+		case !ok:
+			parts = append(parts, fmt.Sprintf("+ %s %s", mod, ver))
+		case !found:
+			parts = append(parts, fmt.Sprintf("- %s %s", mod, old))
+		case old != ver:
+			parts = append(parts, fmt.Sprintf("%s %s -> %s", mod, old, ver))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
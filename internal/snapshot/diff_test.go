@@ -0,0 +1,60 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestDiff(t *testing.T) {
+	foo := &dist.Dist{Name: "Foo-1.0", Pathname: "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		Provides: map[string]string{"Foo": "1.0"}, Requirements: map[string]string{"Mouse": "0"}}
+	bar := &dist.Dist{Name: "Bar-2.0", Pathname: "A/AU/AUTHOR/Bar-2.0.tar.gz",
+		Provides: map[string]string{"Bar": "2.0"}}
+
+	tests := []struct {
+		name string
+		a, b []*dist.Dist
+		want []string
+	}{
+		{name: "equal", a: []*dist.Dist{foo, bar}, b: []*dist.Dist{bar, foo}},
+		{
+			name: "added and removed",
+			a:    []*dist.Dist{foo},
+			b:    []*dist.Dist{bar},
+			want: []string{"+ Bar-2.0 (A/AU/AUTHOR/Bar-2.0.tar.gz)", "- Foo-1.0 (A/AU/AUTHOR/Foo-1.0.tar.gz)"},
+		},
+		{
+			name: "upgraded",
+			a:    []*dist.Dist{foo},
+			b:    []*dist.Dist{{Name: "Foo-1.1", Pathname: "A/AU/AUTHOR/Foo-1.1.tar.gz", Provides: map[string]string{"Foo": "1.1"}}},
+			want: []string{"~ Foo-1.0 -> Foo-1.1"},
+		},
+		{
+			name: "requirements changed",
+			a:    []*dist.Dist{foo},
+			b: []*dist.Dist{{Name: "Foo-1.0", Pathname: "A/AU/AUTHOR/Foo-1.0.tar.gz",
+				Provides: map[string]string{"Foo": "1.0", "Foo::Util": "1.0"}, Requirements: map[string]string{"Moo": "2.0"}}},
+			want: []string{"~ Foo-1.0: provides + Foo::Util 1.0; requirements + Moo 2.0, - Mouse 0"},
+		},
+		{
+			name: "moved",
+			a:    []*dist.Dist{bar},
+			b:    []*dist.Dist{{Name: "Bar-2.0", Pathname: "O/OT/OTHER/Bar-2.0.tar.gz", Provides: map[string]string{"Bar": "2.0"}}},
+			want: []string{"~ Bar-2.0: pathname A/AU/AUTHOR/Bar-2.0.tar.gz -> O/OT/OTHER/Bar-2.0.tar.gz"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			got := Diff(tt.a, tt.b)
+
+			// Assert
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
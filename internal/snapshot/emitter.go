@@ -13,7 +13,11 @@ const header = "# carton snapshot format: version 1.0\n"
 
 // Emitter writes snapshot files in Carton v1.0 format.
 type Emitter struct {
-	w io.Writer
+	w             io.Writer
+	comments      []string
+	provenance    *Provenance
+	phaseComments bool
+	preserve      bool
 }
 
 // NewEmitter creates a new snapshot emitter.
@@ -21,6 +25,32 @@ func NewEmitter(w io.Writer) *Emitter {
 	return &Emitter{w: w}
 }
 
+// AddComment adds a comment line written right after the format header.
+// Carton ignores comment lines, so the snapshot stays compatible.
+func (e *Emitter) AddComment(text string) {
+	e.comments = append(e.comments, text)
+}
+
+// SetProvenance writes p as a comment after the format header. Without it
+// the output is exactly what Carton writes.
+func (e *Emitter) SetProvenance(p Provenance) {
+	e.provenance = &p
+}
+
+// SetPhaseComments annotates each requirement line with the META phase
+// that declared it as a trailing comment, e.g. "      Test::More 0  # build".
+// Carton ignores the comment; requirements of unknown phase are left bare.
+func (e *Emitter) SetPhaseComments(enabled bool) {
+	e.phaseComments = enabled
+}
+
+// SetPreserveRanges writes requirement versions exactly as given, e.g. a
+// range such as ">= 1.0, < 2.0" read back from a snapshot, instead of
+// reducing them to their minimum version. Carton reads such lines as is.
+func (e *Emitter) SetPreserveRanges(enabled bool) {
+	e.preserve = enabled
+}
+
 // Emit writes distributions to the snapshot in Carton v1.0 format.
 func (e *Emitter) Emit(dists []*dist.Dist) error {
 	// Sort distributions alphabetically by name
@@ -34,6 +64,16 @@ func (e *Emitter) Emit(dists []*dist.Dist) error {
 		return err
 	}
 
+	comments := e.comments
+	if e.provenance != nil {
+		comments = append([]string{e.provenance.String()}, comments...)
+	}
+	for _, c := range comments {
+		if _, err := fmt.Fprintf(e.w, "# %s\n", c); err != nil {
+			return err
+		}
+	}
+
 	if _, err := fmt.Fprint(e.w, "DISTRIBUTIONS\n"); err != nil {
 		return err
 	}
@@ -47,6 +87,29 @@ func (e *Emitter) Emit(dists []*dist.Dist) error {
 	return nil
 }
 
+// EmitModuleList writes a flat "Module::Name version" line for every module
+// provided by dists, sorted by module name. A module provided by several
+// distributions is listed once, with its highest version.
+func (e *Emitter) EmitModuleList(dists []*dist.Dist) error {
+	versions := make(map[string]string)
+	for _, d := range dists {
+		for mod, ver := range d.Provides {
+			have, ok := versions[mod]
+			if !ok || have == "" || (ver != "" && dist.CompareVersions(ver, have) > 0) {
+				versions[mod] = ver
+			}
+		}
+	}
+
+	for _, mod := range sortedKeys(versions) {
+		if _, err := fmt.Fprintf(e.w, "%s %s\n", mod, normalizeProvidesVersion(versions[mod])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (e *Emitter) emitDist(d *dist.Dist) error {
 	// Distribution name with 2-space indent
 	if _, err := fmt.Fprintf(e.w, "  %s\n", d.Name); err != nil {
@@ -66,10 +129,7 @@ func (e *Emitter) emitDist(d *dist.Dist) error {
 
 		modules := sortedKeys(d.Provides)
 		for _, mod := range modules {
-			ver := d.Provides[mod]
-			if ver == "" {
-				ver = "undef"
-			}
+			ver := normalizeProvidesVersion(d.Provides[mod])
 			if _, err := fmt.Fprintf(e.w, "      %s %s\n", mod, ver); err != nil {
 				return err
 			}
@@ -86,8 +146,16 @@ func (e *Emitter) emitDist(d *dist.Dist) error {
 		for _, mod := range modules {
 			ver := d.Requirements[mod]
 			// Normalize version requirement for snapshot
-			ver = normalizeVersion(ver)
-			if _, err := fmt.Fprintf(e.w, "      %s %s\n", mod, ver); err != nil {
+			if e.preserve {
+				ver = preserveVersion(ver)
+			} else {
+				ver = normalizeVersion(ver)
+			}
+			line := fmt.Sprintf("      %s %s", mod, ver)
+			if phase := d.ReqPhases[mod]; e.phaseComments && phase != "" {
+				line += "  # " + string(phase)
+			}
+			if _, err := fmt.Fprintln(e.w, line); err != nil {
 				return err
 			}
 		}
@@ -122,10 +190,41 @@ func normalizeVersion(v string) string {
 	v = strings.TrimPrefix(v, ">")
 	v = strings.TrimPrefix(v, "==")
 	v = strings.TrimPrefix(v, "=")
+	v = strings.TrimPrefix(v, "~")
 	v = strings.TrimSpace(v)
 
 	if v == "" {
 		return "0"
 	}
+	return canonicalVersion(v)
+}
+
+// preserveVersion renders a requirement version for SetPreserveRanges:
+// unchanged apart from surrounding space, or "0" if empty.
+func preserveVersion(v string) string {
+	if v = strings.TrimSpace(v); v == "" {
+		return "0"
+	}
+	return v
+}
+
+// normalizeProvidesVersion renders a provided module's version like
+// requirement versions, with "undef" for a module without one.
+func normalizeProvidesVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" || v == "undef" {
+		return "undef"
+	}
+	return canonicalVersion(v)
+}
+
+// canonicalVersion drops the "v" of a dotted version with at least three
+// parts, e.g. v2.5.0 -> 2.5.0, so dotted versions are written one way.
+// Shorter v-strings such as v1.2 keep it, as 1.2 would be a decimal
+// version with a different value.
+func canonicalVersion(v string) string {
+	if rest, ok := strings.CutPrefix(v, "v"); ok && strings.Count(rest, ".") >= 2 {
+		return rest
+	}
 	return v
 }
@@ -2,7 +2,10 @@ package snapshot
 
 import (
 	"bytes"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/frederic-klein/yacm/internal/dist"
 )
@@ -90,6 +93,34 @@ DISTRIBUTIONS
     pathname: Z/ZE/ZEBRA/Zebra-1.0.tar.gz
     provides:
       Zebra 1.0
+`,
+		},
+		{
+			name: "normalized provides versions",
+			dists: []*dist.Dist{
+				{
+					Name:     "Foo-v2.5.0",
+					Pathname: "A/AU/AUTHOR/Foo-v2.5.0.tar.gz",
+					Provides: map[string]string{
+						"Foo":        "v2.5.0",
+						"Foo::Short": "v1.2",
+						"Foo::Undef": "",
+						"Foo::Old":   "2.005000",
+					},
+					Requirements: map[string]string{"Bar": ">= v1.0.0"},
+				},
+			},
+			want: `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  Foo-v2.5.0
+    pathname: A/AU/AUTHOR/Foo-v2.5.0.tar.gz
+    provides:
+      Foo 2.5.0
+      Foo::Old 2.005000
+      Foo::Short v1.2
+      Foo::Undef undef
+    requirements:
+      Bar 1.0.0
 `,
 		},
 	}
@@ -109,6 +140,155 @@ DISTRIBUTIONS
 	}
 }
 
+func TestEmitter_AddComment(t *testing.T) {
+	var buf bytes.Buffer
+	emitter := NewEmitter(&buf)
+	emitter.AddComment("INCOMPLETE: resolution was interrupted")
+
+	if err := emitter.Emit(nil); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+
+	want := "# carton snapshot format: version 1.0\n# INCOMPLETE: resolution was interrupted\nDISTRIBUTIONS\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Emit() = %q, want %q", got, want)
+	}
+}
+
+func TestEmitter_SetProvenance(t *testing.T) {
+	tests := []struct {
+		name string
+		prov Provenance
+		want string
+	}{
+		{
+			name: "with index date",
+			prov: Provenance{Yacm: "1.2.0", Index: "https://cpan.example.org/modules/02packages.details.txt.gz", IndexDate: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			want: "# provenance: yacm=1.2.0 index=https://cpan.example.org/modules/02packages.details.txt.gz index-date=2024-01-02T03:04:05Z\n",
+		},
+		{
+			name: "without index date",
+			prov: Provenance{Yacm: "dev", Index: "https://cpan.example.org/modules/02packages.details.txt.gz"},
+			want: "# provenance: yacm=dev index=https://cpan.example.org/modules/02packages.details.txt.gz\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var buf bytes.Buffer
+			emitter := NewEmitter(&buf)
+			emitter.SetProvenance(tt.prov)
+
+			// Act
+			err := emitter.Emit(nil)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Emit() error = %v", err)
+			}
+			want := header + tt.want + "DISTRIBUTIONS\n"
+			if got := buf.String(); got != want {
+				t.Errorf("Emit() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEmitter_SetPhaseComments(t *testing.T) {
+	d := &dist.Dist{
+		Name:         "Foo-1.0",
+		Pathname:     "A/AU/AUTHOR/Foo-1.0.tar.gz",
+		Provides:     map[string]string{"Foo": "1.0"},
+		Requirements: map[string]string{"Bar": "1.5", "ExtUtils::MakeMaker": "0", "Test::More": "0.98"},
+		ReqPhases:    map[string]dist.Phase{"Bar": dist.PhaseRuntime, "ExtUtils::MakeMaker": dist.PhaseConfigure},
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		want    string
+	}{
+		{
+			name: "off",
+			want: "      Bar 1.5\n      ExtUtils::MakeMaker 0\n      Test::More 0.98\n",
+		},
+		{
+			name:    "on",
+			enabled: true,
+			want:    "      Bar 1.5  # runtime\n      ExtUtils::MakeMaker 0  # configure\n      Test::More 0.98\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var buf bytes.Buffer
+			emitter := NewEmitter(&buf)
+			emitter.SetPhaseComments(tt.enabled)
+
+			// Act
+			err := emitter.Emit([]*dist.Dist{d})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Emit() error = %v", err)
+			}
+			if !strings.HasSuffix(buf.String(), "    requirements:\n"+tt.want) {
+				t.Errorf("Emit() =\n%s\nwant requirements\n%s", buf.String(), tt.want)
+			}
+
+			// The parser reads the annotated snapshot back unchanged
+			parsed, err := NewParser(&buf).Parse()
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(parsed) != 1 || !reflect.DeepEqual(parsed[0].Requirements, d.Requirements) {
+				t.Errorf("Parse() requirements = %v, want %v", parsed, d.Requirements)
+			}
+		})
+	}
+}
+
+func TestEmitter_EmitModuleList(t *testing.T) {
+	// Arrange: two dists that both provide JSON::PP
+	dists := []*dist.Dist{
+		{
+			Name:     "JSON-PP-4.16",
+			Pathname: "I/IS/ISHIGAKI/JSON-PP-4.16.tar.gz",
+			Provides: map[string]string{
+				"JSON::PP":          "4.16",
+				"JSON::PP::Boolean": "",
+			},
+		},
+		{
+			Name:     "JSON-PP-Compat-2.27",
+			Pathname: "M/MA/MAKAMAKA/JSON-PP-Compat-2.27.tar.gz",
+			Provides: map[string]string{
+				"JSON::PP":          "4.02",
+				"JSON::PP::Boolean": "4.02",
+				"JSON::PP::Compat":  "2.27",
+			},
+		},
+	}
+	var buf bytes.Buffer
+
+	// Act
+	err := NewEmitter(&buf).EmitModuleList(dists)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("EmitModuleList() error = %v", err)
+	}
+	want := `JSON::PP 4.16
+JSON::PP::Boolean 4.02
+JSON::PP::Compat 2.27
+`
+	if got := buf.String(); got != want {
+		t.Errorf("EmitModuleList() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
 func TestNormalizeVersion(t *testing.T) {
 	tests := []struct {
 		input string
@@ -121,6 +301,9 @@ func TestNormalizeVersion(t *testing.T) {
 		{">= 1.0, < 2.0", "1.0"},
 		{"> 1.0", "1.0"},
 		{"== 1.0", "1.0"},
+		{"~1.2", "1.2"},
+		{">= v1.2.3", "1.2.3"},
+		{"v1.2", "v1.2"},
 	}
 
 	for _, tt := range tests {
@@ -20,7 +20,8 @@ var (
 
 // Parser reads snapshot files in Carton v1.0 format.
 type Parser struct {
-	r io.Reader
+	r          io.Reader
+	provenance *Provenance
 }
 
 // NewParser creates a new snapshot parser.
@@ -28,30 +29,47 @@ func NewParser(r io.Reader) *Parser {
 	return &Parser{r: r}
 }
 
-// Parse reads distributions from a snapshot file.
+// Parse reads distributions from a snapshot file. Comment lines, indented
+// or not, and blank lines are skipped. A distribution without a pathname or
+// a provides section is an error.
 func (p *Parser) Parse() ([]*dist.Dist, error) {
 	var dists []*dist.Dist
 	var current *dist.Dist
-	var inProvides, inRequirements bool
+	var inProvides, inRequirements, hasProvides bool
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		if current.Pathname == "" {
+			return fmt.Errorf("distribution %s: missing pathname", current.Name)
+		}
+		if !hasProvides {
+			return fmt.Errorf("distribution %s: missing provides section", current.Name)
+		}
+		dists = append(dists, current)
+		return nil
+	}
 
 	scanner := bufio.NewScanner(p.r)
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		// Skip header and DISTRIBUTIONS line
-		if strings.HasPrefix(line, "#") || line == "DISTRIBUTIONS" {
-			continue
+		// Skip comments, blank lines and the DISTRIBUTIONS line
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") && current == nil {
+			if prov, ok := parseProvenance(line[1:]); ok {
+				p.provenance = prov
+			}
 		}
-
-		// Empty line
-		if line == "" {
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || line == "DISTRIBUTIONS" {
 			continue
 		}
 
 		// Distribution name (2-space indent)
 		if matches := distNameRe.FindStringSubmatch(line); matches != nil {
-			if current != nil {
-				dists = append(dists, current)
+			if err := finish(); err != nil {
+				return nil, err
 			}
 			current = &dist.Dist{
 				Name:         matches[1],
@@ -60,6 +78,7 @@ func (p *Parser) Parse() ([]*dist.Dist, error) {
 			}
 			inProvides = false
 			inRequirements = false
+			hasProvides = false
 			continue
 		}
 
@@ -77,6 +96,7 @@ func (p *Parser) Parse() ([]*dist.Dist, error) {
 		if providesRe.MatchString(line) {
 			inProvides = true
 			inRequirements = false
+			hasProvides = true
 			continue
 		}
 		if requiresRe.MatchString(line) {
@@ -88,7 +108,9 @@ func (p *Parser) Parse() ([]*dist.Dist, error) {
 		// Module version entries (6-space indent)
 		if matches := moduleVerRe.FindStringSubmatch(line); matches != nil {
 			module := matches[1]
-			version := matches[2]
+			// Drop a trailing comment, e.g. the phase from SetPhaseComments
+			version, _, _ := strings.Cut(matches[2], " #")
+			version = strings.TrimSpace(version)
 			if inProvides {
 				current.Provides[module] = version
 			} else if inRequirements {
@@ -97,14 +119,20 @@ func (p *Parser) Parse() ([]*dist.Dist, error) {
 		}
 	}
 
-	// Don't forget the last distribution
-	if current != nil {
-		dists = append(dists, current)
-	}
-
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("reading snapshot: %w", err)
 	}
 
+	// Don't forget the last distribution
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
 	return dists, nil
 }
+
+// Provenance returns the provenance comment read by Parse, or nil if the
+// snapshot has none.
+func (p *Parser) Provenance() *Provenance {
+	return p.provenance
+}
@@ -1,8 +1,10 @@
 package snapshot
 
 import (
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParser_Parse(t *testing.T) {
@@ -98,3 +100,167 @@ DISTRIBUTIONS
 		t.Errorf("round trip failed:\ngot:\n%s\nwant:\n%s", output, input)
 	}
 }
+
+func TestParser_RoundTrip_VersionRange(t *testing.T) {
+	// Arrange: a requirement with a multi-clause range, one with a phase comment
+	input := `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  Alpha-1.0
+    pathname: A/AL/ALPHA/Alpha-1.0.tar.gz
+    provides:
+      Alpha 1.0
+    requirements:
+      Beta >= 1.0, < 2.0, != 1.5
+      Gamma >= 0.5, < 1  # runtime
+`
+	want := map[string]string{"Beta": ">= 1.0, < 2.0, != 1.5", "Gamma": ">= 0.5, < 1"}
+
+	// Act: parse, emit preserving ranges, parse again
+	dists, err := NewParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var buf strings.Builder
+	emitter := NewEmitter(&buf)
+	emitter.SetPreserveRanges(true)
+	if err := emitter.Emit(dists); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+	reparsed, err := NewParser(strings.NewReader(buf.String())).Parse()
+	if err != nil {
+		t.Fatalf("Parse() of emitted snapshot error = %v", err)
+	}
+
+	// Assert
+	if !reflect.DeepEqual(dists[0].Requirements, want) {
+		t.Errorf("Parse() requirements = %v, want %v", dists[0].Requirements, want)
+	}
+	if len(reparsed) != 1 || !reflect.DeepEqual(reparsed[0].Requirements, want) {
+		t.Errorf("round trip requirements = %v, want %v", reparsed[0].Requirements, want)
+	}
+	if !strings.Contains(buf.String(), "      Beta >= 1.0, < 2.0, != 1.5\n") {
+		t.Errorf("Emit() did not keep the range:\n%s", buf.String())
+	}
+}
+
+func TestParser_Parse_IndentedComment(t *testing.T) {
+	// Arrange
+	input := `# carton snapshot format: version 1.0
+DISTRIBUTIONS
+  # pinned for the legacy API
+  JSON-2.0
+    pathname: M/MA/MAKAMAKA/JSON-2.0.tar.gz
+    # provides follow
+    provides:
+      JSON 2.0
+  
+`
+
+	// Act
+	dists, err := NewParser(strings.NewReader(input)).Parse()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(dists) != 1 || dists[0].Provides["JSON"] != "2.0" {
+		t.Errorf("Parse() = %+v, want JSON-2.0 providing JSON 2.0", dists)
+	}
+}
+
+func TestParser_Parse_Provenance(t *testing.T) {
+	dists := "DISTRIBUTIONS\n  JSON-2.0\n    pathname: M/MA/MAKAMAKA/JSON-2.0.tar.gz\n    provides:\n      JSON 2.0\n"
+	tests := []struct {
+		name  string
+		input string
+		want  *Provenance
+	}{
+		{
+			name:  "carton snapshot",
+			input: header + dists,
+			want:  nil,
+		},
+		{
+			name:  "with provenance",
+			input: header + "# provenance: yacm=1.2.0 index=https://cpan.example.org/02packages.details.txt.gz index-date=2024-01-02T03:04:05Z\n" + dists,
+			want:  &Provenance{Yacm: "1.2.0", Index: "https://cpan.example.org/02packages.details.txt.gz", IndexDate: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+		{
+			name:  "unknown fields and bad date",
+			input: header + "# provenance: yacm=dev index-date=yesterday future=1\n" + dists,
+			want:  &Provenance{Yacm: "dev"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			parser := NewParser(strings.NewReader(tt.input))
+
+			// Act
+			got, err := parser.Parse()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(got) != 1 || got[0].Name != "JSON-2.0" {
+				t.Errorf("Parse() = %+v, want JSON-2.0", got)
+			}
+			prov := parser.Provenance()
+			if (prov == nil) != (tt.want == nil) {
+				t.Fatalf("Provenance() = %+v, want %+v", prov, tt.want)
+			}
+			if prov != nil && (prov.Yacm != tt.want.Yacm || prov.Index != tt.want.Index || !prov.IndexDate.Equal(tt.want.IndexDate)) {
+				t.Errorf("Provenance() = %+v, want %+v", prov, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_Parse_InvalidDist(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name: "missing pathname",
+			input: `DISTRIBUTIONS
+  JSON-2.0
+    provides:
+      JSON 2.0
+  Moo-2.0
+    pathname: H/HA/HAARG/Moo-2.0.tar.gz
+    provides:
+      Moo 2.0
+`,
+			wantErr: "distribution JSON-2.0: missing pathname",
+		},
+		{
+			name: "missing provides",
+			input: `DISTRIBUTIONS
+  Moo-2.0
+    pathname: H/HA/HAARG/Moo-2.0.tar.gz
+    requirements:
+      Role::Tiny 2.0
+`,
+			wantErr: "distribution Moo-2.0: missing provides section",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			dists, err := NewParser(strings.NewReader(tt.input)).Parse()
+
+			// Assert
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+			if dists != nil {
+				t.Errorf("Parse() dists = %v, want nil", dists)
+			}
+		})
+	}
+}
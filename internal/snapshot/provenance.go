@@ -0,0 +1,49 @@
+package snapshot
+
+import (
+	"strings"
+	"time"
+)
+
+const provenancePrefix = "provenance: "
+
+// Provenance records what produced a snapshot. It is written as a comment
+// after the format header, so Carton ignores it.
+type Provenance struct {
+	Yacm      string    // yacm version
+	Index     string    // URL of the 02packages index resolved against
+	IndexDate time.Time // the index's Last-Updated time; zero if unknown
+}
+
+// String formats p as the comment text, e.g.
+// "provenance: yacm=1.2.0 index=https://... index-date=2024-01-02T03:04:05Z".
+func (p Provenance) String() string {
+	fields := []string{provenancePrefix + "yacm=" + p.Yacm, "index=" + p.Index}
+	if !p.IndexDate.IsZero() {
+		fields = append(fields, "index-date="+p.IndexDate.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(fields, " ")
+}
+
+// parseProvenance reads a provenance comment, without the leading "#". It
+// is only informational, so unknown fields and an unparsable date are
+// ignored rather than failing the snapshot.
+func parseProvenance(comment string) (*Provenance, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(comment), provenancePrefix)
+	if !ok {
+		return nil, false
+	}
+	var p Provenance
+	for _, field := range strings.Fields(rest) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "yacm":
+			p.Yacm = value
+		case "index":
+			p.Index = value
+		case "index-date":
+			p.IndexDate, _ = time.Parse(time.RFC3339, value)
+		}
+	}
+	return &p, true
+}
@@ -0,0 +1,81 @@
+package snapshot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+// TopoSort returns distributions in install order: every distribution appears
+// after the distributions providing the modules it requires. Ties are broken
+// alphabetically by name so the order is stable. Requirements that no
+// distribution provides (core modules, perl itself) are ignored.
+// An error naming the involved distributions is returned if they form a cycle.
+func TopoSort(dists []*dist.Dist) ([]*dist.Dist, error) {
+	providers := make(map[string]*dist.Dist)
+	for _, d := range dists {
+		for mod := range d.Provides {
+			if _, ok := providers[mod]; !ok {
+				providers[mod] = d
+			}
+		}
+	}
+
+	// dependents[p] lists the dists that must come after p
+	dependents := make(map[*dist.Dist][]*dist.Dist)
+	indegree := make(map[*dist.Dist]int, len(dists))
+	for _, d := range dists {
+		indegree[d] = 0
+	}
+	for _, d := range dists {
+		seen := make(map[*dist.Dist]bool)
+		for mod := range d.Requirements {
+			p, ok := providers[mod]
+			if !ok || p == d || seen[p] {
+				continue
+			}
+			seen[p] = true
+			dependents[p] = append(dependents[p], d)
+			indegree[d]++
+		}
+	}
+
+	var ready []*dist.Dist
+	for d, n := range indegree {
+		if n == 0 {
+			ready = append(ready, d)
+		}
+	}
+
+	sorted := make([]*dist.Dist, 0, len(indegree))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool {
+			return ready[i].Name < ready[j].Name
+		})
+		d := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, d)
+
+		for _, dep := range dependents[d] {
+			indegree[dep]--
+			if indegree[dep] == 0 {
+				ready = append(ready, dep)
+			}
+		}
+	}
+
+	if len(sorted) < len(indegree) {
+		var cyclic []string
+		for d, n := range indegree {
+			if n > 0 {
+				cyclic = append(cyclic, d.Name)
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, fmt.Errorf("dependency cycle among: %s", strings.Join(cyclic, ", "))
+	}
+
+	return sorted, nil
+}
@@ -0,0 +1,77 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestTopoSort(t *testing.T) {
+	// Arrange: Moo -> Role::Tiny -> Exporter::Tiny, plus an independent dist
+	dists := []*dist.Dist{
+		{
+			Name:         "Moo-2.0",
+			Provides:     map[string]string{"Moo": "2.0"},
+			Requirements: map[string]string{"Role::Tiny": "2.0", "perl": "5.006"},
+		},
+		{
+			Name:         "Role-Tiny-2.0",
+			Provides:     map[string]string{"Role::Tiny": "2.0"},
+			Requirements: map[string]string{"Exporter::Tiny": "0"},
+		},
+		{
+			Name:         "Exporter-Tiny-1.0",
+			Provides:     map[string]string{"Exporter::Tiny": "1.0"},
+			Requirements: map[string]string{},
+		},
+		{
+			Name:         "Alpha-1.0",
+			Provides:     map[string]string{"Alpha": "1.0"},
+			Requirements: map[string]string{},
+		},
+	}
+
+	// Act
+	sorted, err := TopoSort(dists)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("TopoSort() error = %v", err)
+	}
+	want := []string{"Alpha-1.0", "Exporter-Tiny-1.0", "Role-Tiny-2.0", "Moo-2.0"}
+	if len(sorted) != len(want) {
+		t.Fatalf("got %d dists, want %d", len(sorted), len(want))
+	}
+	for i, name := range want {
+		if sorted[i].Name != name {
+			t.Errorf("position %d = %q, want %q", i, sorted[i].Name, name)
+		}
+	}
+}
+
+func TestTopoSort_Cycle(t *testing.T) {
+	// Arrange
+	dists := []*dist.Dist{
+		{
+			Name:         "A-1.0",
+			Provides:     map[string]string{"A": "1.0"},
+			Requirements: map[string]string{"B": "0"},
+		},
+		{
+			Name:         "B-1.0",
+			Provides:     map[string]string{"B": "1.0"},
+			Requirements: map[string]string{"A": "0"},
+		},
+	}
+
+	// Act
+	_, err := TopoSort(dists)
+
+	// Assert
+	if err == nil {
+		t.Fatal("TopoSort() should report a cycle")
+	}
+	if got, want := err.Error(), "dependency cycle among: A-1.0, B-1.0"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,581 @@
+// Package yacm resolves Perl module dependencies from CPAN and BackPAN and
+// writes snapshots compatible with Carton and Carmel. The yacm command is a
+// thin wrapper around Generate.
+package yacm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/cpanfile"
+	"github.com/frederic-klein/yacm/internal/dist"
+	"github.com/frederic-klein/yacm/internal/downloader"
+	"github.com/frederic-klein/yacm/internal/extractor"
+	"github.com/frederic-klein/yacm/internal/httpclient"
+	"github.com/frederic-klein/yacm/internal/index"
+	"github.com/frederic-klein/yacm/internal/logger"
+	"github.com/frederic-klein/yacm/internal/resolver"
+	"github.com/frederic-klein/yacm/internal/snapshot"
+)
+
+type (
+	// Requirement is a module and version constraint, e.g. from a cpanfile.
+	Requirement = dist.VersionReq
+	// Distribution is a resolved CPAN distribution.
+	Distribution = dist.Dist
+	// Phase is a cpanfile phase such as runtime or test.
+	Phase = dist.Phase
+	// Logger writes leveled progress messages and counts warnings.
+	Logger = logger.Logger
+	// LogLevel selects which messages a Logger writes.
+	LogLevel = logger.Level
+	// Event reports one resolution step, such as a module being resolved.
+	Event = resolver.Event
+	// ConfigureOverride customizes the configure run of one distribution.
+	ConfigureOverride = extractor.ConfigureOverride
+)
+
+// Log levels for NewLogger, from the fewest messages to the most.
+const (
+	LogError = logger.LevelError // errors only
+	LogWarn  = logger.LevelWarn  // warnings and errors, counted for Strict
+	LogInfo  = logger.LevelInfo  // progress information
+	LogDebug = logger.LevelDebug // per-request detail
+)
+
+// NewLogger creates a logger writing messages at or below level to w.
+func NewLogger(w io.Writer, level LogLevel) *Logger {
+	return logger.New(w, level)
+}
+
+// DefaultMirror is the CPAN mirror used when Config.Mirror is empty.
+const DefaultMirror = "https://cpan.metacpan.org"
+
+// DefaultPhases are the cpanfile phases resolved when Config.Phases is empty.
+var DefaultPhases = []string{"runtime", "test", "build", "configure"}
+
+// staleIndexAge is the cached index age after which Generate warns. The
+// warning is a notice and does not count towards Strict.
+const staleIndexAge = 12 * time.Hour
+
+// Config describes one snapshot generation. Zero values select defaults.
+type Config struct {
+	// Context cancels resolution; nil means context.Background().
+	Context context.Context
+	// Timeout bounds the whole generation, index downloads, MetaCPAN
+	// queries and configure runs included; zero means no limit.
+	Timeout time.Duration
+
+	// Cpanfile is the cpanfile parsed when Requirements is nil.
+	Cpanfile string
+	// Requirements are resolved instead of parsing Cpanfile.
+	Requirements map[Phase][]Requirement
+	// ParseWarnings are problems found while reading Requirements, e.g.
+	// unrecognized cpanfile lines; they are logged as warnings and count
+	// towards Strict.
+	ParseWarnings []string
+	// Phases selects which phases are resolved; nil means DefaultPhases.
+	Phases []string
+	// Only, if set, restricts the top-level requirements to these modules,
+	// e.g. to bisect a dependency problem. Their prerequisites are still
+	// resolved.
+	Only []string
+	// WithoutFeatures leaves out the requirements declared in these cpanfile
+	// optional features, like carton install --without; otherwise every
+	// feature is resolved.
+	WithoutFeatures []string
+
+	Mirror        string   // CPAN mirror, DefaultMirror if empty
+	IndexURL      string   // alternative 02packages.details.txt[.gz] URL
+	ExtraIndexes  []string // additional mirrors merged with Mirror's index
+	IndexPriority []string // index URLs in priority order for equal versions
+	RefreshIndex  bool     // download the index even if the cache is fresh
+	FuzzyCase     bool     // match module names case-insensitively as a fallback
+	MetaCPAN      string   // MetaCPAN API URL, the public instance if empty
+	CacheDir      string   // download cache, DefaultCacheDir() if empty
+	BackPANDir    string   // BackPAN tarballs, ./backpan-modules if empty
+	LocalAuthor   string   // CPAN author of curated tarballs directly in BackPANDir
+	Workers       int      // parallel downloads, 5 if zero
+	HTTPClient    *http.Client
+
+	DockerImage       string // run configure in this image
+	ConfigureJobs     int    // concurrent configure runs, 0 for no limit
+	KeepBuild         bool   // keep the directory of a failed configure run
+	Offline           bool
+	IncludeRecommends bool
+	IncludeSuggests   bool
+	IncludeDevelop    bool
+	IncludeCore       bool
+	MetaAPI           bool
+	LazyDownload      bool // MetaCPAN metadata first, tarballs only for dynamic_config
+	Upgrade           bool
+	PreferBackPAN     bool // resolve exact pins via MetaCPAN, never the CPAN index
+	KeepGoing         bool
+	Shallow           []string
+	NoTransitive      bool     // resolve only the top-level modules, see resolver.SetNoTransitive
+	SkipNamespaces    []string // e.g. "Acme::"; matching modules are not resolved
+	PinnedDists       []string // pathnames forced for every module they provide
+	MaxBackPANAge     time.Duration
+
+	// VersionPolicy is "latest" (the default) to use the newest release
+	// satisfying a requirement, or "minimum" to use the oldest.
+	VersionPolicy string
+	// CyclePolicy is "skip" (the default), "warn" or "error" for circular
+	// dependencies, see resolver.SetCyclePolicy.
+	CyclePolicy string
+	// FailFastThreshold gives up on the mirror once this many downloads
+	// failed with a connection error or HTTP 5xx status; zero never does.
+	FailFastThreshold int
+	// CustomPhases resolves META prereqs declared under phases
+	// outside the spec, e.g. "x_runtime", as runtime prereqs; otherwise
+	// they are only warned about.
+	CustomPhases bool
+	// MetaCPANWorkers, if positive, looks up the MetaCPAN download URLs of
+	// exact top-level pins this many at a time before resolving.
+	MetaCPANWorkers int
+	// IndexCacheTTLs maps index URLs, Mirror or one of ExtraIndexes, to
+	// how long their cached index is used; unlisted ones use 24 hours.
+	IndexCacheTTLs map[string]time.Duration
+	// Constraints maps modules to version constraints that are ANDed with
+	// every request for them, top-level or transitive.
+	Constraints map[string]string
+	// ConfigureOverrides customizes configure per distribution name, see
+	// ConfigFile.
+	ConfigureOverrides map[string]ConfigureOverride
+	// PartialOnInterrupt writes what was resolved when Context is cancelled.
+	PartialOnInterrupt bool
+	// Strict fails before writing anything if a warning was logged.
+	Strict bool
+	// PhaseComments annotates each requirement with the META phase that
+	// declared it, as a trailing comment Carton ignores.
+	PhaseComments bool
+	// EmitProvenance adds a comment recording the yacm version and the
+	// index used. Off by default, so the output matches Carton's.
+	EmitProvenance bool
+
+	// Format is "carton" (the default) or "modules".
+	Format string
+	// Output receives the snapshot; nil writes nothing.
+	Output io.Writer
+	// TestOutput, if set, receives the distributions only needed by test
+	// and develop requirements, which are then left out of Output.
+	TestOutput io.Writer
+
+	// Log receives progress messages; nil discards them.
+	Log *Logger
+	// Observer, if set, is called for every resolution Event.
+	Observer func(Event)
+}
+
+// Result describes a finished snapshot generation.
+type Result struct {
+	Distributions     []*Distribution // written to Output
+	TestDistributions []*Distribution // written to TestOutput
+	TopLevel          []string        // modules requested directly
+	Warnings          int             // warnings logged during generation
+	Incomplete        bool            // resolution was interrupted, see PartialOnInterrupt
+}
+
+// CacheDirEnv names the environment variable that overrides the default
+// cache directory, e.g. for an ephemeral or shared cache in CI.
+const CacheDirEnv = "YACM_CACHE_DIR"
+
+// DefaultCacheDir returns $YACM_CACHE_DIR if set, or the cache directory
+// under the user's home.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("getting home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".yacm", "cache"), nil
+}
+
+// Generate parses the requirements, resolves them and writes the snapshot.
+func Generate(cfg Config) (Result, error) {
+	if err := cfg.setDefaults(); err != nil {
+		return Result{}, err
+	}
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		cfg.Context, cancel = context.WithTimeout(cfg.Context, cfg.Timeout)
+		defer cancel()
+	}
+	log := cfg.Log
+	warnings := log.Warnings()
+
+	reqs, err := cfg.requirements(log)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(reqs) == 0 {
+		return Result{}, fmt.Errorf("no requirements found in cpanfile")
+	}
+
+	// Initialize CPAN index
+	log.Infof("Loading CPAN index from %s", cfg.Mirror)
+	cpanIdx := index.NewCPANIndex(cfg.Mirror, cfg.CacheDir)
+	cpanIdx.SetLogger(log)
+	cpanIdx.SetHTTPClient(cfg.HTTPClient)
+	cpanIdx.SetRefresh(cfg.RefreshIndex)
+	cpanIdx.SetCacheTTL(cfg.indexCacheTTL(cfg.Mirror))
+	if cfg.IndexURL != "" {
+		log.Infof("Using index %s", cfg.IndexURL)
+		cpanIdx.SetIndexURL(cfg.IndexURL)
+	}
+	if err := cpanIdx.Load(cfg.Context); err != nil {
+		return Result{}, cfg.failed("loading CPAN index", err)
+	}
+	log.Infof("Loaded index with %d modules", cpanIdx.Count())
+	if age := cpanIdx.CacheAge(); age > staleIndexAge {
+		log.Noticef("CPAN index is %s old; refresh it for the latest modules", formatAge(age))
+	}
+	indexes, err := mergeIndexes(&cfg, cpanIdx, log)
+	if err != nil {
+		return Result{}, err
+	}
+	indexes.SetFuzzyCase(cfg.FuzzyCase)
+
+	// Initialize BackPAN index
+	backpan := index.NewBackPANIndex(cfg.BackPANDir)
+	backpan.SetLogger(log)
+	backpan.SetHTTPClient(cfg.HTTPClient)
+	backpan.SetLocalAuthor(cfg.LocalAuthor)
+	if cfg.MetaCPAN != "" {
+		backpan.SetAPIURL(cfg.MetaCPAN)
+	}
+	if err := backpan.EnsureDir(); err != nil {
+		return Result{}, fmt.Errorf("creating backpan directory: %w", err)
+	}
+
+	// Initialize downloader
+	dl := downloader.NewDownloader(cfg.Workers, cfg.CacheDir)
+	dl.SetLogger(log)
+	dl.SetHTTPClient(cfg.HTTPClient)
+	dl.SetFailFastThreshold(cfg.FailFastThreshold)
+
+	// Initialize extractor (configure runs in Docker if requested)
+	var ext *extractor.Extractor
+	if cfg.DockerImage != "" {
+		log.Infof("Using Docker image for configure: %s", cfg.DockerImage)
+		ext = extractor.NewDockerExtractor(cfg.DockerImage, cpanIdx.Mirror())
+	} else {
+		ext = extractor.NewExtractor(cpanIdx.Mirror())
+	}
+	ext.SetIncludeRecommends(cfg.IncludeRecommends)
+	ext.SetIncludeSuggests(cfg.IncludeSuggests)
+	ext.SetIncludeCustomPhases(cfg.CustomPhases)
+	ext.SetOffline(cfg.Offline)
+	ext.SetConfigureJobs(cfg.ConfigureJobs)
+	ext.SetKeepBuild(cfg.KeepBuild)
+	ext.SetConfigureOverrides(cfg.ConfigureOverrides)
+
+	// Resolve dependencies
+	log.Infof("Resolving dependencies...")
+	res := resolver.NewResolver(indexes, backpan, dl, ext, log)
+	res.SetIncludeDevelop(cfg.IncludeDevelop)
+	res.SetIncludeCoreModules(cfg.IncludeCore)
+	res.SetMetaAPI(cfg.MetaAPI)
+	res.SetLazyDownload(cfg.LazyDownload)
+	res.SetMetaCPANWorkers(cfg.MetaCPANWorkers)
+	res.SetUpgrade(cfg.Upgrade)
+	res.SetPreferBackPAN(cfg.PreferBackPAN)
+	res.SetVersionPolicy(resolver.VersionPolicy(cfg.VersionPolicy))
+	res.SetCyclePolicy(resolver.CyclePolicy(cfg.CyclePolicy))
+	res.SetCollectErrors(cfg.KeepGoing)
+	res.SetShallowModules(cfg.Shallow)
+	res.SetNoTransitive(cfg.NoTransitive)
+	res.SetSkipNamespaces(cfg.SkipNamespaces)
+	res.SetConstraints(cfg.Constraints)
+	res.SetPinnedDists(cfg.PinnedDists)
+	res.SetMaxBackPANAge(cfg.MaxBackPANAge)
+	res.SetObserver(cfg.Observer)
+
+	dists, err := res.Resolve(cfg.Context, reqs)
+	result := Result{TopLevel: res.TopLevel()}
+	if n := dl.Failures(); n > 0 {
+		log.Infof("%d downloads failed with a connection error or HTTP 5xx status", n)
+	}
+	if err != nil {
+		if !cfg.PartialOnInterrupt || cfg.Context.Err() == nil || len(dists) == 0 {
+			return result, cfg.failed("resolving dependencies", err)
+		}
+		log.Warnf("resolution interrupted, writing partial snapshot")
+		result.Incomplete = true
+	}
+
+	log.Infof("Resolved %d distributions", len(dists))
+	uniqueDists, dropped := snapshot.Dedup(dists)
+	for _, msg := range dropped {
+		log.Warnf("%s", msg)
+	}
+	result.Warnings = log.Warnings() - warnings
+	if cfg.Strict && result.Warnings > 0 {
+		return result, fmt.Errorf("strict: %d warning(s) logged", result.Warnings)
+	}
+
+	var prov *snapshot.Provenance
+	if cfg.EmitProvenance {
+		prov = &snapshot.Provenance{
+			Yacm:      httpclient.Version,
+			Index:     cpanIdx.URL(),
+			IndexDate: cpanIdx.LastUpdated(),
+		}
+	}
+
+	result.Distributions = uniqueDists
+	if cfg.TestOutput != nil {
+		result.Distributions, result.TestDistributions = splitTestDists(uniqueDists)
+		if err := cfg.write(cfg.TestOutput, result.TestDistributions, result.Incomplete, prov); err != nil {
+			return result, err
+		}
+	}
+	if cfg.Output != nil {
+		if err := cfg.write(cfg.Output, result.Distributions, result.Incomplete, prov); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (cfg *Config) setDefaults() error {
+	if cfg.Format == "" {
+		cfg.Format = "carton"
+	}
+	if cfg.Format != "carton" && cfg.Format != "modules" {
+		return fmt.Errorf("unknown format %q: want carton or modules", cfg.Format)
+	}
+	if cfg.VersionPolicy == "" {
+		cfg.VersionPolicy = string(resolver.VersionLatest)
+	}
+	switch resolver.VersionPolicy(cfg.VersionPolicy) {
+	case resolver.VersionLatest, resolver.VersionMinimum:
+	default:
+		return fmt.Errorf("unknown version policy %q: want latest or minimum", cfg.VersionPolicy)
+	}
+	if cfg.CyclePolicy == "" {
+		cfg.CyclePolicy = string(resolver.CycleSkip)
+	}
+	switch resolver.CyclePolicy(cfg.CyclePolicy) {
+	case resolver.CycleSkip, resolver.CycleWarn, resolver.CycleError:
+	default:
+		return fmt.Errorf("unknown cycle policy %q: want skip, warn or error", cfg.CyclePolicy)
+	}
+	if cfg.Context == nil {
+		cfg.Context = context.Background()
+	}
+	if cfg.Phases == nil {
+		cfg.Phases = DefaultPhases
+	}
+	if cfg.Mirror == "" {
+		cfg.Mirror = DefaultMirror
+	}
+	if cfg.CacheDir == "" {
+		dir, err := DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		cfg.CacheDir = dir
+	}
+	if cfg.BackPANDir == "" {
+		cfg.BackPANDir = "./backpan-modules"
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 5
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = httpclient.New("")
+	}
+	if cfg.Log == nil {
+		// Still count warnings, for Strict and Result.Warnings
+		cfg.Log = logger.New(io.Discard, logger.LevelError)
+	}
+	return nil
+}
+
+// failed wraps err, the failure of step, noting when cfg.Timeout expired.
+func (cfg *Config) failed(step string, err error) error {
+	if cfg.Timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: timed out after %s: %w", step, cfg.Timeout, err)
+	}
+	return fmt.Errorf("%s: %w", step, err)
+}
+
+// requirements returns the requirements of the selected phases, parsing
+// Cpanfile unless Requirements is set.
+func (cfg *Config) requirements(log *logger.Logger) ([]dist.VersionReq, error) {
+	reqs := cfg.Requirements
+	if reqs == nil {
+		log.Infof("Parsing cpanfile: %s", cfg.Cpanfile)
+		result, err := cpanfile.NewParser().Parse(cfg.Cpanfile)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cpanfile: %w", err)
+		}
+		for _, included := range result.Included {
+			log.Infof("Included cpanfile: %s", included)
+		}
+		for _, w := range result.Warnings {
+			log.Warnf("%s", w)
+		}
+		reqs = result.Requirements
+	} else {
+		for _, w := range cfg.ParseWarnings {
+			log.Warnf("%s", w)
+		}
+	}
+	selected, err := selectPhases(reqs, cfg.Phases, log)
+	if err == nil && len(cfg.WithoutFeatures) > 0 {
+		selected, err = dropFeatures(reqs, selected, cfg.WithoutFeatures, log)
+	}
+	if err != nil || len(cfg.Only) == 0 {
+		return selected, err
+	}
+	return selectModules(selected, cfg.Only, log)
+}
+
+// write emits dists to w in cfg.Format, with prov as a comment if set.
+func (cfg *Config) write(w io.Writer, dists []*dist.Dist, incomplete bool, prov *snapshot.Provenance) error {
+	emitter := snapshot.NewEmitter(w)
+	if prov != nil {
+		emitter.SetProvenance(*prov)
+	}
+	emitter.SetPhaseComments(cfg.PhaseComments)
+	if incomplete {
+		emitter.AddComment("INCOMPLETE: resolution was interrupted, dependencies may be missing")
+	}
+	var err error
+	if cfg.Format == "modules" {
+		err = emitter.EmitModuleList(dists)
+	} else {
+		err = emitter.Emit(dists)
+	}
+	if err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return nil
+}
+
+// selectPhases collects the requirements of the named phases, in the order
+// given. Develop is only included when named explicitly.
+func selectPhases(reqs map[dist.Phase][]dist.VersionReq, names []string, log *logger.Logger) ([]dist.VersionReq, error) {
+	var selected []dist.VersionReq
+	seen := make(map[dist.Phase]bool)
+	for _, name := range names {
+		phase := dist.Phase(strings.ToLower(strings.TrimSpace(name)))
+		switch phase {
+		case dist.PhaseRuntime, dist.PhaseTest, dist.PhaseBuild, dist.PhaseConfigure, dist.PhaseDevelop:
+		default:
+			return nil, fmt.Errorf("unknown phase %q (want runtime, test, build, configure or develop)", name)
+		}
+		if seen[phase] {
+			continue
+		}
+		seen[phase] = true
+		log.Infof("Found %d requirements for phase: %s", len(reqs[phase]), phase)
+		for _, req := range reqs[phase] {
+			req.Phase = phase
+			selected = append(selected, req)
+		}
+	}
+	for phase, skipped := range reqs {
+		if !seen[phase] && len(skipped) > 0 {
+			log.Infof("Skipping %d requirements for phase: %s", len(skipped), phase)
+		}
+	}
+	return selected, nil
+}
+
+// dropFeatures removes the requirements of the named optional features from
+// selected. It is an error if a name matches no feature in any phase of all.
+func dropFeatures(all map[dist.Phase][]dist.VersionReq, selected []dist.VersionReq, names []string, log *logger.Logger) ([]dist.VersionReq, error) {
+	declared := make(map[string]bool)
+	for _, reqs := range all {
+		for _, req := range reqs {
+			declared[req.Feature] = true
+		}
+	}
+	dropped := make(map[string]bool, len(names))
+	var unknown []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || !declared[name] {
+			unknown = append(unknown, name)
+		}
+		dropped[name] = true
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("no such feature in the cpanfile: %s", strings.Join(unknown, ", "))
+	}
+
+	kept := make([]dist.VersionReq, 0, len(selected))
+	for _, req := range selected {
+		if !dropped[req.Feature] {
+			kept = append(kept, req)
+		}
+	}
+	log.Infof("Skipping %d requirements of features: %s", len(selected)-len(kept), strings.Join(names, ", "))
+	return kept, nil
+}
+
+// selectModules keeps the requirements for the named modules. It is an
+// error if a name matches none of reqs.
+func selectModules(reqs []dist.VersionReq, names []string, log *logger.Logger) ([]dist.VersionReq, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[strings.TrimSpace(name)] = true
+	}
+
+	var selected []dist.VersionReq
+	found := make(map[string]bool)
+	for _, req := range reqs {
+		if wanted[req.Module] {
+			selected = append(selected, req)
+			found[req.Module] = true
+		}
+	}
+	var missing []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("not required by the selected phases: %s", strings.Join(missing, ", "))
+	}
+	log.Infof("Resolving only %d of %d requirements", len(selected), len(reqs))
+	return selected, nil
+}
+
+// splitTestDists separates the distributions only pulled in by test or
+// develop requirements from those needed at runtime.
+func splitTestDists(dists []*dist.Dist) (runtime, test []*dist.Dist) {
+	for _, d := range dists {
+		if d.Phase.IsTestOnly() {
+			test = append(test, d)
+		} else {
+			runtime = append(runtime, d)
+		}
+	}
+	return runtime, test
+}
+
+// formatAge renders a duration in whole hours, or days once it exceeds two days.
+func formatAge(age time.Duration) string {
+	hours := int(age.Hours())
+	if hours >= 48 {
+		return fmt.Sprintf("%d days", hours/24)
+	}
+	if hours == 1 {
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d hours", hours)
+}
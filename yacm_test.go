@@ -0,0 +1,568 @@
+package yacm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frederic-klein/yacm/internal/dist"
+)
+
+func TestSelectPhases(t *testing.T) {
+	reqs := map[dist.Phase][]dist.VersionReq{
+		dist.PhaseRuntime: {{Module: "Moo", Version: "2.0"}},
+		dist.PhaseTest:    {{Module: "Test::More", Version: "0.98"}},
+		dist.PhaseDevelop: {{Module: "Perl::Critic", Version: "0"}},
+	}
+	tests := []struct {
+		name    string
+		phases  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "default excludes develop", phases: DefaultPhases, want: []string{"Moo", "Test::More"}},
+		{name: "runtime only", phases: []string{"runtime"}, want: []string{"Moo"}},
+		{name: "develop on request", phases: []string{"runtime", "develop"}, want: []string{"Moo", "Perl::Critic"}},
+		{name: "repeated phase", phases: []string{"test", "TEST"}, want: []string{"Test::More"}},
+		{name: "unknown phase", phases: []string{"install"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			got, err := selectPhases(reqs, tt.phases, nil)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectPhases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var modules []string
+			for _, req := range got {
+				modules = append(modules, req.Module)
+			}
+			if strings.Join(modules, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("selectPhases() = %v, want %v", modules, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropFeatures(t *testing.T) {
+	reqs := map[dist.Phase][]dist.VersionReq{
+		dist.PhaseRuntime: {{Module: "Moo", Version: "2.0"}, {Module: "DBD::SQLite", Feature: "sqlite"}},
+		dist.PhaseTest:    {{Module: "Test::More", Version: "0.98"}, {Module: "Test::DBD", Feature: "sqlite"}},
+		dist.PhaseDevelop: {{Module: "Perl::Critic", Feature: "lint"}},
+	}
+	selected, err := selectPhases(reqs, DefaultPhases, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		without []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "feature in several phases", without: []string{"sqlite"}, want: []string{"Moo", "Test::More"}},
+		{name: "feature of an unselected phase", without: []string{"lint"}, want: []string{"Moo", "DBD::SQLite", "Test::More", "Test::DBD"}},
+		{name: "unknown feature", without: []string{"postgres"}, wantErr: true},
+		{name: "empty name", without: []string{""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			got, err := dropFeatures(reqs, selected, tt.without, nil)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dropFeatures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var modules []string
+			for _, req := range got {
+				modules = append(modules, req.Module)
+			}
+			if strings.Join(modules, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("dropFeatures() = %v, want %v", modules, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultCacheDir(t *testing.T) {
+	home := t.TempDir()
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{name: "home default", env: "", want: filepath.Join(home, ".yacm", "cache")},
+		{name: "env override", env: "/ci/cache", want: "/ci/cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			t.Setenv("HOME", home)
+			t.Setenv(CacheDirEnv, tt.env)
+
+			// Act
+			got, err := DefaultCacheDir()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("DefaultCacheDir() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DefaultCacheDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	// Arrange: a mirror with runtime Foo and test-only Test::Foo, which requires Foo
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Test::Foo\t0.5\tA/AU/AUTHOR/Test-Foo-0.5.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`),
+		"/authors/id/A/AU/AUTHOR/Test-Foo-0.5.tar.gz": tarball(t, "Test-Foo-0.5/META.json",
+			`{"name":"Test-Foo","version":"0.5","provides":{"Test::Foo":{"file":"lib/Test/Foo.pm","version":"0.5"}},"prereqs":{"runtime":{"requires":{"Foo":"0"}}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	var out, testOut bytes.Buffer
+	cfg := Config{
+		Requirements: map[Phase][]Requirement{
+			dist.PhaseTest:    {{Module: "Test::Foo", Version: "0"}},
+			dist.PhaseRuntime: {{Module: "Foo", Version: "0"}},
+		},
+		Mirror:     server.URL,
+		CacheDir:   t.TempDir(),
+		BackPANDir: t.TempDir(),
+		Output:     &out,
+		TestOutput: &testOut,
+	}
+
+	// Act
+	result, err := Generate(cfg)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(result.Distributions) != 1 || result.Distributions[0].Name != "Foo-1.0" {
+		t.Errorf("Distributions = %v, want Foo-1.0", result.Distributions)
+	}
+	if len(result.TestDistributions) != 1 || result.TestDistributions[0].Name != "Test-Foo-0.5" {
+		t.Errorf("TestDistributions = %v, want Test-Foo-0.5", result.TestDistributions)
+	}
+	if got := strings.Join(result.TopLevel, ","); got != "Foo,Test::Foo" {
+		t.Errorf("TopLevel = %s, want Foo,Test::Foo", got)
+	}
+	if !strings.Contains(out.String(), "  Foo-1.0\n") || strings.Contains(out.String(), "Test-Foo") {
+		t.Errorf("Output should hold only Foo-1.0:\n%s", out.String())
+	}
+	if !strings.Contains(testOut.String(), "  Test-Foo-0.5\n") || strings.Contains(testOut.String(), "  Foo-1.0") {
+		t.Errorf("TestOutput should hold only Test-Foo-0.5:\n%s", testOut.String())
+	}
+}
+
+func TestGenerate_Only(t *testing.T) {
+	// Arrange: a cpanfile requiring Foo, which requires Bar, and Baz
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Bar\t2.0\tA/AU/AUTHOR/Bar-2.0.tar.gz\n" +
+		"Baz\t3.0\tA/AU/AUTHOR/Baz-3.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}},"prereqs":{"runtime":{"requires":{"Bar":"0"}}}}`),
+		"/authors/id/A/AU/AUTHOR/Bar-2.0.tar.gz": tarball(t, "Bar-2.0/META.json",
+			`{"name":"Bar","version":"2.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"2.0"}}}`),
+		"/authors/id/A/AU/AUTHOR/Baz-3.0.tar.gz": tarball(t, "Baz-3.0/META.json",
+			`{"name":"Baz","version":"3.0","provides":{"Baz":{"file":"lib/Baz.pm","version":"3.0"}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		only    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "all", want: "Bar-2.0,Baz-3.0,Foo-1.0"},
+		{name: "only Foo", only: []string{"Foo"}, want: "Bar-2.0,Foo-1.0"},
+		{name: "not in the cpanfile", only: []string{"Foo", "Qux"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cfg := Config{
+				Requirements: map[Phase][]Requirement{
+					dist.PhaseRuntime: {{Module: "Foo", Version: "0"}, {Module: "Baz", Version: "0"}},
+				},
+				Only:       tt.only,
+				Mirror:     server.URL,
+				CacheDir:   t.TempDir(),
+				BackPANDir: t.TempDir(),
+				Output:     &out,
+			}
+
+			// Act
+			result, err := Generate(cfg)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "Qux") {
+					t.Errorf("error = %v, want it to name Qux", err)
+				}
+				return
+			}
+			var names []string
+			for _, d := range result.Distributions {
+				names = append(names, d.Name)
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("Distributions = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerate_Strict(t *testing.T) {
+	// Arrange: the index lists Foo 1.0 only; MetaCPAN has Foo 0.5 on BackPAN
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`),
+		"/authors/id/A/AU/AUTHOR/Foo-0.5.tar.gz": tarball(t, "Foo-0.5/META.json",
+			`{"name":"Foo","version":"0.5","provides":{"Foo":{"file":"lib/Foo.pm","version":"0.5"}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+	files["/v1/download_url/Foo"] = []byte(`{"download_url":"` + server.URL + `/authors/id/A/AU/AUTHOR/Foo-0.5.tar.gz","version":"0.5"}`)
+
+	tests := []struct {
+		name     string
+		cpanfile string
+		wantErr  bool
+	}{
+		{name: "no warnings", cpanfile: "requires 'Foo';\n"},
+		{name: "unrecognized cpanfile line", cpanfile: "requires 'Foo';\nfrobnicate 'Foo';\n", wantErr: true},
+		{name: "BackPAN fallback", cpanfile: "requires 'Foo', '== 0.5';\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "cpanfile")
+			if err := os.WriteFile(path, []byte(tt.cpanfile), 0644); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			cfg := Config{
+				Cpanfile:   path,
+				Mirror:     server.URL,
+				MetaCPAN:   server.URL,
+				CacheDir:   t.TempDir(),
+				BackPANDir: t.TempDir(),
+				Strict:     true,
+				Output:     &out,
+			}
+
+			// Act
+			_, err := Generate(cfg)
+
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "strict: 1 warning(s) logged") {
+				t.Errorf("Generate() error = %v, want one strict warning", err)
+			}
+			if tt.wantErr && out.Len() > 0 {
+				t.Errorf("strict failure still wrote a snapshot:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestGenerate_StaleIndexNotCountedByStrict(t *testing.T) {
+	// Arrange: a cached index two days old, still within its TTL
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t,
+			"File: 02packages.details.txt\n\nFoo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n"),
+		"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarball(t, "Foo-1.0/META.json",
+			`{"name":"Foo","version":"1.0","provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`),
+	}
+	server := mirrorServer(files)
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cpanfile")
+	if err := os.WriteFile(path, []byte("requires 'Foo';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := t.TempDir()
+	cfg := Config{
+		Cpanfile:       path,
+		Mirror:         server.URL,
+		CacheDir:       cacheDir,
+		BackPANDir:     t.TempDir(),
+		IndexCacheTTLs: map[string]time.Duration{server.URL: 72 * time.Hour},
+		Strict:         true,
+	}
+	if _, err := Generate(cfg); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	cached, _ := filepath.Glob(filepath.Join(cacheDir, "02packages.details*"))
+	for _, f := range cached {
+		if err := os.Chtimes(f, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var logs bytes.Buffer
+	cfg.Log = NewLogger(&logs, LogWarn)
+
+	// Act
+	_, err := Generate(cfg)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Generate() error = %v, want the stale index not to count under Strict", err)
+	}
+	if !strings.Contains(logs.String(), "Warning: CPAN index is 2 days old") {
+		t.Errorf("logs = %q, want a stale index warning", logs.String())
+	}
+}
+
+func TestGenerate_Offline(t *testing.T) {
+	// Arrange: Foo ships a Makefile.PL, which offline mode does not run
+	tests := []struct {
+		name         string
+		dynamic      string
+		wantWarnings int
+	}{
+		{name: "dynamic_config 1", dynamic: `"dynamic_config":1,`, wantWarnings: 1},
+		{name: "dynamic_config missing", dynamic: "", wantWarnings: 1},
+		{name: "dynamic_config 0", dynamic: `"dynamic_config":0,`, wantWarnings: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			files := map[string][]byte{
+				"/modules/02packages.details.txt.gz": gzipBytes(t,
+					"File: 02packages.details.txt\n\nFoo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n"),
+				"/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz": tarballFiles(t, map[string]string{
+					"Foo-1.0/META.json":   `{"name":"Foo","version":"1.0",` + tt.dynamic + `"provides":{"Foo":{"file":"lib/Foo.pm","version":"1.0"}}}`,
+					"Foo-1.0/Makefile.PL": "use ExtUtils::MakeMaker; WriteMakefile();",
+				}),
+			}
+			server := mirrorServer(files)
+			defer server.Close()
+			cfg := Config{
+				Requirements: map[Phase][]Requirement{dist.PhaseRuntime: {{Module: "Foo", Version: "0"}}},
+				Mirror:       server.URL,
+				CacheDir:     t.TempDir(),
+				BackPANDir:   t.TempDir(),
+				Offline:      true,
+				Output:       io.Discard,
+			}
+
+			// Act
+			result, err := Generate(cfg)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if result.Warnings != tt.wantWarnings {
+				t.Errorf("Warnings = %d, want %d", result.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestGenerate_Timeout(t *testing.T) {
+	// Arrange: a mirror and MetaCPAN API that hang on one path until the
+	// client gives up or rate-limit it for a minute, and a perl whose
+	// configure runs never finish
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "perl"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	packages := "File: 02packages.details.txt\n\n" +
+		"Foo\t1.0\tA/AU/AUTHOR/Foo-1.0.tar.gz\n" +
+		"Bar\t1.0\tA/AU/AUTHOR/Bar-1.0.tar.gz\n"
+	files := map[string][]byte{
+		"/modules/02packages.details.txt.gz": gzipBytes(t, packages),
+		"/authors/id/A/AU/AUTHOR/Bar-1.0.tar.gz": tarballFiles(t, map[string]string{
+			"Bar-1.0/META.json":   `{"name":"Bar","version":"1.0","provides":{"Bar":{"file":"lib/Bar.pm","version":"1.0"}}}`,
+			"Bar-1.0/Makefile.PL": "use ExtUtils::MakeMaker; WriteMakefile();",
+		}),
+	}
+
+	tests := []struct {
+		name   string
+		module string
+		hang   string
+		limit  string
+	}{
+		{name: "tarball download", module: "Foo", hang: "/authors/id/A/AU/AUTHOR/Foo-1.0.tar.gz"},
+		{name: "index download", module: "Foo", hang: "/modules/02packages.details.txt.gz"},
+		{name: "MetaCPAN query", module: "Foo == 0.5", hang: "/v1/download_url/Foo"},
+		{name: "MetaCPAN rate limit", module: "Foo == 0.5", limit: "/v1/download_url/Foo"},
+		{name: "configure run", module: "Bar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == tt.hang {
+					<-r.Context().Done()
+					return
+				}
+				if r.URL.Path == tt.limit {
+					w.Header().Set("Retry-After", "60")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				data, ok := files[r.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write(data)
+			}))
+			defer server.Close()
+			module, version, _ := strings.Cut(tt.module, " ")
+			cfg := Config{
+				Requirements: map[Phase][]Requirement{dist.PhaseRuntime: {{Module: module, Version: version}}},
+				Timeout:      100 * time.Millisecond,
+				Mirror:       server.URL,
+				MetaCPAN:     server.URL,
+				CacheDir:     t.TempDir(),
+				BackPANDir:   t.TempDir(),
+				Output:       io.Discard,
+			}
+
+			// Act
+			start := time.Now()
+			_, err := Generate(cfg)
+
+			// Assert
+			if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+				t.Fatalf("Generate() error = %v, want timed out", err)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Generate() error = %v, want wrapping context.DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Generate() took %s, want prompt failure", elapsed)
+			}
+		})
+	}
+}
+
+func TestGenerate_InvalidFormat(t *testing.T) {
+	// Act
+	_, err := Generate(Config{Format: "json"})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), `unknown format "json"`) {
+		t.Errorf("Generate() error = %v, want unknown format", err)
+	}
+}
+
+func TestGenerate_InvalidVersionPolicy(t *testing.T) {
+	// Act
+	_, err := Generate(Config{VersionPolicy: "oldest"})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), `unknown version policy "oldest"`) {
+		t.Errorf("Generate() error = %v, want unknown version policy", err)
+	}
+}
+
+func TestGenerate_InvalidCyclePolicy(t *testing.T) {
+	// Act
+	_, err := Generate(Config{CyclePolicy: "fail"})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), `unknown cycle policy "fail"`) {
+		t.Errorf("Generate() error = %v, want unknown cycle policy", err)
+	}
+}
+
+// mirrorServer serves files by URL path and answers 404 for anything else.
+func mirrorServer(files map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	return buf.Bytes()
+}
+
+func tarball(t *testing.T, name, content string) []byte {
+	t.Helper()
+
+	return tarballFiles(t, map[string]string{name: content})
+}
+
+func tarballFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}